@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+)
+
+// ErrInvalidAlias wraps rejected custom aliases
+var ErrInvalidAlias = newError(CodeInvalidInput, "invalid alias")
+
+// errAliasTaken is reported when a custom alias already exists
+var errAliasTaken = newError(CodeConflict, "alias already in use")
+
+// maxAliasLength caps custom aliases
+const maxAliasLength = 64
+
+// reservedAliases are the literal paths of LinkRouter, which would shadow
+// links of the same code
+var reservedAliases = []string{"create", "bulk", "export", "import", "move"}
+
+// validateAlias checks that a custom alias can be resolved under /link/.
+// Aliases are made of ASCII letters, digits, '-' and '_'.
+func validateAlias(alias string) error {
+	if len(alias) > maxAliasLength {
+		return fmt.Errorf("%w: longer than %d characters", ErrInvalidAlias, maxAliasLength)
+	}
+	for _, r := range alias {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return fmt.Errorf("%w: %q is not allowed, use letters, digits, '-' and '_'", ErrInvalidAlias, r)
+		}
+	}
+	if slices.Contains(reservedAliases, alias) {
+		return fmt.Errorf("%w: %q is reserved", ErrInvalidAlias, alias)
+	}
+	return nil
+}
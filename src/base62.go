@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
@@ -11,7 +12,7 @@ import (
 const base62Chars = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
 
 // encodeBase62 encodes into a base62 string
-func encodeBase62(num *big.Int) string {
+func encodeBase62(ctx context.Context, num *big.Int) string {
 	if num.Cmp(big.NewInt(0)) == 0 {
 		return "0"
 	}
@@ -25,38 +26,38 @@ func encodeBase62(num *big.Int) string {
 		num.DivMod(num, base, remainder)
 		result = string(base62Chars[remainder.Int64()]) + result
 	}
-	slog.Debug("Encoded value into base62", "original", num, "new", result)
+	slog.DebugContext(ctx, "Encoded value into base62", "original", num, "new", result)
 	return result
 }
 
 // generateShortCode generates a short code from a URL using hashing and base62 encoding
-func generateShortCode(originalURL string) string {
-	nonce, _ := generateNonce() // Nonce avoids getting same output for same input
+func generateShortCode(ctx context.Context, originalURL string) string {
+	nonce, _ := generateNonce(ctx) // Nonce avoids getting same output for same input
 	urlWithNonce := originalURL + nonce
 	hash := sha256.Sum256([]byte(urlWithNonce))
 
 	hashInt := new(big.Int)
 	hashInt.SetBytes(hash[:])
 
-	shortCode := encodeBase62(hashInt)
+	shortCode := encodeBase62(ctx, hashInt)
 
 	if len(shortCode) > 6 {
 		return shortCode[:6]
 	}
-	slog.Debug("Generated short code", "url", originalURL, "code", shortCode)
+	slog.DebugContext(ctx, "Generated short code", "url", originalURL, "code", shortCode)
 	return shortCode
 }
 
 // generateNonce generates a random 16 byte value
-func generateNonce() (string, error) {
+func generateNonce(ctx context.Context) (string, error) {
 	bytes := make([]byte, 16) // 16 bytes = 128 bits
-	slog.Debug("Generating nonce...")
+	slog.DebugContext(ctx, "Generating nonce...")
 	_, err := rand.Read(bytes)
 	if err != nil {
-		slog.Error("Error generating context", "error", err)
+		slog.ErrorContext(ctx, "Error generating context", "error", err)
 		return "", err
 	}
 	hex_val := hex.EncodeToString(bytes)
-	slog.Debug("Generated nonce", "value", hex_val)
+	slog.DebugContext(ctx, "Generated nonce", "value", hex_val)
 	return hex_val, nil
 }
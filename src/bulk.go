@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// maxCodeAttempts bounds how often a colliding generated code is retried
+const maxCodeAttempts = 3
+
+// BulkItem is one link to create in a bulk request
+type BulkItem struct {
+	URL         string         `json:"url" openapi:"required"`
+	CustomAlias string         `json:"customAlias,omitempty"`
+	Owner       string         `json:"owner,omitempty"`
+	Metadata    map[string]any `json:"metadata,omitempty"`
+	Title       string         `json:"title,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Notes       string         `json:"notes,omitempty"`
+	Tags        []string       `json:"tags,omitempty"`
+	FolderID    *int64         `json:"folderId,omitempty"`
+}
+
+// BulkResult reports the outcome of one BulkItem, in request order
+type BulkResult struct {
+	Index int    `json:"index"`
+	URL   string `json:"url"`
+	ID    string `json:"id,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// CreateBulk creates many entries at once. Items are validated individually
+// and failures are reported per item rather than failing the whole batch. All
+// entries are written to PostgreSQL in a single batch and cached in Redis in a
+// single pipeline.
+func (s *Service) CreateBulk(ctx context.Context, items []BulkItem) []BulkResult {
+	results := make([]BulkResult, len(items))
+	createdAt := time.Now().UTC()
+
+	var pending []int
+	aliases := make(map[string]int)
+	details := make([]LinkDetails, len(items))
+	// Items usually share a few folders, each checked once per owner
+	type folderKey struct {
+		id    int64
+		owner string
+	}
+	folderErrs := make(map[folderKey]error)
+	for i, item := range items {
+		results[i] = BulkResult{Index: i, URL: item.URL}
+
+		details[i] = LinkDetails{Title: item.Title, Description: item.Description, Notes: item.Notes, Tags: item.Tags,
+			FolderID: item.FolderID}
+		liftDetails(item.Metadata, &details[i])
+		if err := validateDetails(&details[i]); err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		if item.FolderID != nil {
+			key := folderKey{*item.FolderID, item.Owner}
+			err, checked := folderErrs[key]
+			if !checked {
+				err = s.checkFolder(ctx, item.FolderID, item.Owner)
+				folderErrs[key] = err
+			}
+			if err != nil {
+				results[i].Error = err.Error()
+				continue
+			}
+		}
+
+		normalized, err := s.destinations.Normalize(item.URL)
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		if verdict, blocked := s.screen(ctx, screenStageCreate, normalized); blocked {
+			results[i].Error = fmt.Sprintf("%v by the %s list", ErrBlockedURL, verdict.List)
+			continue
+		}
+		items[i].URL = normalized
+		if item.CustomAlias != "" {
+			if err := validateAlias(item.CustomAlias); err != nil {
+				results[i].Error = err.Error()
+				continue
+			}
+			if first, dup := aliases[item.CustomAlias]; dup {
+				results[i].Error = fmt.Sprintf("alias duplicates item %d", first)
+				continue
+			}
+			aliases[item.CustomAlias] = i
+		}
+		pending = append(pending, i)
+	}
+
+	var created []Entry
+	for attempt := 0; attempt < maxCodeAttempts && len(pending) > 0; attempt++ {
+		entries := make([]Entry, len(pending))
+		for j, i := range pending {
+			code := items[i].CustomAlias
+			if code == "" {
+				code = generateShortCode(ctx, items[i].URL)
+			}
+			entries[j] = Entry{
+				ShortCode:   code,
+				OriginalURL: items[i].URL,
+				Owner:       items[i].Owner,
+				Metadata:    items[i].Metadata,
+				CreatedAt:   createdAt,
+				Details:     details[i],
+			}
+		}
+
+		inserted, err := s.repo.CreateBatch(ctx, entries)
+		if err != nil {
+			slog.ErrorContext(ctx, "Bulk insert failed", "items", len(entries), "error", err)
+			for _, i := range pending {
+				results[i].Error = "failed to store entry"
+			}
+			break
+		}
+
+		var retry []int
+		for j, i := range pending {
+			switch {
+			case inserted[j]:
+				results[i].ID = entries[j].ShortCode
+				created = append(created, entries[j])
+			case items[i].CustomAlias != "":
+				results[i].Error = errAliasTaken.Error()
+			default:
+				// A generated code collided, try again with a fresh one
+				retry = append(retry, i)
+			}
+		}
+		pending = retry
+	}
+	for _, i := range pending {
+		if results[i].ID == "" && results[i].Error == "" {
+			results[i].Error = "failed to generate a unique code"
+		}
+	}
+
+	for _, e := range created {
+		s.emitLinkEvent(ctx, EventLinkCreated, e, "")
+	}
+
+	if err := s.cacheEntries(ctx, created); err != nil {
+		// PostgreSQL is the source of truth; Get repopulates the cache on a miss
+		slog.WarnContext(ctx, "Failed to cache bulk created entries", "error", err)
+	}
+
+	slog.InfoContext(ctx, "Bulk created entries", "requested", len(items), "created", len(created))
+	return results
+}
+
+// cacheEntries writes entries to Redis in one pipeline
+func (s *Service) cacheEntries(ctx context.Context, entries []Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	values := make(map[string]any, len(entries))
+	for _, e := range entries {
+		jsonData, err := json.Marshal(Link{
+			URL:       e.OriginalURL,
+			ShortCode: e.ShortCode,
+			CreatedAt: e.CreatedAt.UTC().Truncate(time.Second),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to marshal data: %w", err)
+		}
+		values[e.ShortCode] = jsonData
+	}
+	return s.redis.SetMany(ctx, values, s.cacheTTL)
+}
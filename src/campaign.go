@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"unicode"
+)
+
+// ErrInvalidCampaign is wrapped by failures to build a campaign URL
+var ErrInvalidCampaign = newError(CodeInvalidInput, "invalid campaign")
+
+const (
+	// maxPresetNameLength bounds the name of a UTM preset
+	maxPresetNameLength = 64
+	// defaultCampaignLimit and maxCampaignLimit bound campaign stats responses
+	defaultCampaignLimit = 50
+	maxCampaignLimit     = 1000
+)
+
+// UTMPreset is a named set of campaign parameters saved by an owner
+type UTMPreset struct {
+	Owner string `json:"owner"`
+	Name  string `json:"name"`
+	UTM
+}
+
+// CampaignStats aggregates the links of one campaign
+type CampaignStats struct {
+	Campaign string `json:"campaign"`
+	Links    int    `json:"links"`
+	Clicks   int64  `json:"clicks"`
+}
+
+// CampaignLink is one link of a campaign
+type CampaignLink struct {
+	ShortCode   string `json:"short_code"`
+	OriginalURL string `json:"original_url"`
+	Source      string `json:"source"`
+	Medium      string `json:"medium"`
+	Clicks      int    `json:"clicks"`
+}
+
+// params lists the query parameter of every field, in the usual order
+func (u UTM) params() [][2]string {
+	return [][2]string{
+		{"utm_source", u.Source},
+		{"utm_medium", u.Medium},
+		{"utm_campaign", u.Campaign},
+		{"utm_term", u.Term},
+		{"utm_content", u.Content},
+	}
+}
+
+// isZero reports whether no field is set
+func (u UTM) isZero() bool {
+	return u == UTM{}
+}
+
+// merge returns u with every field set in override replaced
+func (u UTM) merge(override UTM) UTM {
+	pick := func(base, value string) string {
+		if value != "" {
+			return value
+		}
+		return base
+	}
+	return UTM{
+		Source:   pick(u.Source, override.Source),
+		Medium:   pick(u.Medium, override.Medium),
+		Campaign: pick(u.Campaign, override.Campaign),
+		Term:     pick(u.Term, override.Term),
+		Content:  pick(u.Content, override.Content),
+	}
+}
+
+// validate checks that every field fits a stored utm_* column
+func (u UTM) validate() error {
+	for _, param := range u.params() {
+		if len(param[1]) > maxUTMLength {
+			return fmt.Errorf("%w: %s is longer than %d characters", ErrInvalidCampaign, param[0], maxUTMLength)
+		}
+		if strings.IndexFunc(param[1], unicode.IsControl) >= 0 {
+			return fmt.Errorf("%w: %s contains control characters", ErrInvalidCampaign, param[0])
+		}
+	}
+	return nil
+}
+
+// withUTM adds the set fields of utm to the query of rawURL. Parameters
+// already present in the destination are kept as they are.
+func withUTM(rawURL string, utm UTM) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidURL, err)
+	}
+	existing := u.Query()
+	query := u.RawQuery
+	for _, param := range utm.params() {
+		name, value := param[0], strings.TrimSpace(param[1])
+		if value == "" || existing.Has(name) {
+			continue
+		}
+		if query != "" {
+			query += "&"
+		}
+		query += name + "=" + url.QueryEscape(value)
+	}
+	u.RawQuery = query
+	return u.String(), nil
+}
+
+// campaignFromRequest reads the utm object and utmPreset name of a create
+// request and returns the merged parameters, explicit fields winning over
+// the preset
+func (s *Service) campaignFromRequest(ctx context.Context, req CreateRequest) (UTM, error) {
+	var utm UTM
+	if req.UTM != nil {
+		utm = *req.UTM
+	}
+
+	if name := req.UTMPreset; name != "" {
+		preset, err := s.repo.GetUTMPreset(ctx, req.Owner, name)
+		if err != nil {
+			return UTM{}, fmt.Errorf("failed to load UTM preset: %w", err)
+		}
+		if preset == nil {
+			return UTM{}, fmt.Errorf("%w: unknown preset %q", ErrInvalidCampaign, name)
+		}
+		utm = preset.UTM.merge(utm)
+	}
+	return utm, utm.validate()
+}
+
+// validatePreset checks a preset before it is saved
+func validatePreset(preset UTMPreset) error {
+	if preset.Name == "" || len(preset.Name) > maxPresetNameLength {
+		return fmt.Errorf("%w: preset name must be 1 to %d characters", ErrInvalidCampaign, maxPresetNameLength)
+	}
+	if preset.UTM.isZero() {
+		return fmt.Errorf("%w: preset sets no parameters", ErrInvalidCampaign)
+	}
+	return preset.UTM.validate()
+}
+
+// ListUTMPresets returns the presets of owner ordered by name
+func (s *Service) ListUTMPresets(ctx context.Context, owner string) ([]UTMPreset, error) {
+	return s.repo.ListUTMPresets(ctx, owner)
+}
+
+// SaveUTMPreset creates or replaces a preset
+func (s *Service) SaveUTMPreset(ctx context.Context, preset UTMPreset) error {
+	if err := validatePreset(preset); err != nil {
+		return err
+	}
+	return s.repo.SaveUTMPreset(ctx, preset)
+}
+
+// DeleteUTMPreset removes a preset and reports whether it existed
+func (s *Service) DeleteUTMPreset(ctx context.Context, owner, name string) (bool, error) {
+	return s.repo.DeleteUTMPreset(ctx, owner, name)
+}
+
+// GetCampaignStats groups the links of owner, or of everyone when owner is
+// empty, by utm_campaign
+func (s *Service) GetCampaignStats(ctx context.Context, owner string, limit int) ([]CampaignStats, error) {
+	return s.repo.GetCampaignStats(ctx, owner, limit)
+}
+
+// GetCampaignLinks lists the links of one campaign, most clicked first
+func (s *Service) GetCampaignLinks(ctx context.Context, owner, campaign string, limit int) ([]CampaignLink, error) {
+	return s.repo.GetCampaignLinks(ctx, owner, campaign, limit)
+}
+
+// BackfillCampaigns derives the campaign columns of entries created before
+// they existed
+func (s *Service) BackfillCampaigns(ctx context.Context) {
+	updated, err := s.repo.BackfillCampaigns(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to backfill link campaigns", "updated", updated, "error", err)
+		return
+	}
+	if updated > 0 {
+		slog.InfoContext(ctx, "Backfilled link campaigns", "updated", updated)
+	}
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mahopon/SmolEarl/config"
+	"github.com/mahopon/SmolEarl/infra/db"
+	"github.com/mahopon/SmolEarl/infra/redis"
+	"github.com/mahopon/SmolEarl/screening"
+)
+
+// commandUsage describes the subcommands accepted in place of starting the server
+const commandUsage = `usage:
+  smolearl [flags]               start the server
+  smolearl config print [flags]  print the effective configuration with secrets redacted
+  smolearl links export [options] [-- flags]
+                                 write links as CSV or JSON Lines
+      --format csv|jsonl  --out FILE  --owner OWNER  --tag TAG
+      --created-after DATE  --created-before DATE
+  smolearl links import [options] [-- flags]
+                                 read links from CSV or JSON Lines
+      --format csv|jsonl  --in FILE  --on-conflict skip|overwrite|fail
+      --start-line N  --checkpoint FILE
+`
+
+// runCommand dispatches a CLI subcommand and returns the process exit code
+func runCommand(args []string, stdout, stderr io.Writer) int {
+	switch args[0] {
+	case "config":
+		return runConfigCommand(args[1:], stdout, stderr)
+	case "links":
+		return runLinksCommand(args[1:], stdout, stderr)
+	case "help":
+		fmt.Fprint(stdout, commandUsage)
+		return 0
+	default:
+		fmt.Fprintf(stderr, "unknown command %q\n%s", args[0], commandUsage)
+		return 2
+	}
+}
+
+// runConfigCommand handles "config print"
+func runConfigCommand(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] != "print" {
+		fmt.Fprint(stderr, commandUsage)
+		return 2
+	}
+	if err := config.PrintEffective(stdout, args[1:]); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// runLinksCommand handles "links export" and "links import". Arguments after
+// "--" are configuration flags, as accepted by the server.
+func runLinksCommand(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || (args[0] != "export" && args[0] != "import") {
+		fmt.Fprint(stderr, commandUsage)
+		return 2
+	}
+	sub, args := args[0], args[1:]
+	var configArgs []string
+	for i, arg := range args {
+		if arg == "--" {
+			args, configArgs = args[:i], args[i+1:]
+			break
+		}
+	}
+
+	fs := flag.NewFlagSet("links "+sub, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	format := fs.String("format", "", "csv or jsonl, derived from the file extension when omitted")
+	var run func(ctx context.Context, service *Service) error
+	switch sub {
+	case "export":
+		out := fs.String("out", "", "output file, stdout when omitted")
+		owner := fs.String("owner", "", "only export links of this owner")
+		tag := fs.String("tag", "", "only export links with this tag")
+		after := fs.String("created-after", "", "only export links created at or after this time")
+		before := fs.String("created-before", "", "only export links created before this time")
+		run = func(ctx context.Context, service *Service) error {
+			filter, err := parseExportFilter(map[string][]string{
+				"owner": {*owner}, "tag": {*tag}, "created_after": {*after}, "created_before": {*before},
+			})
+			if err != nil {
+				return err
+			}
+			return exportLinks(ctx, service, formatFor(*format, *out), *out, filter, stdout, stderr)
+		}
+	case "import":
+		in := fs.String("in", "", "input file, stdin when omitted")
+		onConflict := fs.String("on-conflict", ConflictSkip, "skip, overwrite or fail on existing short codes")
+		startLine := fs.Int("start-line", -1, "skip records on or before this line")
+		checkpoint := fs.String("checkpoint", "", "file recording the last committed line, to resume an interrupted import")
+		run = func(ctx context.Context, service *Service) error {
+			opts := ImportOptions{Format: formatFor(*format, *in), OnConflict: *onConflict, StartLine: *startLine}
+			return importLinks(ctx, service, opts, *in, *checkpoint, stdout, stderr)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(stderr, "unexpected argument %q\n", fs.Arg(0))
+		return 2
+	}
+
+	ctx := context.Background()
+	service, closeService, err := newCommandService(ctx, configArgs)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	defer closeService()
+
+	if err := run(ctx, service); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// formatFor returns format, or the format implied by the file extension
+func formatFor(format, path string) string {
+	if format != "" {
+		return format
+	}
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return FormatCSV
+	}
+	return FormatJSONL
+}
+
+// newCommandService connects a Service to the configured stores for use by
+// a one-off command
+func newCommandService(ctx context.Context, args []string) (*Service, func(), error) {
+	cfg, err := config.LoadConfig(ctx, args)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+	redisClient, err := redis.InitRedis(cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to initialize Redis: %w", err)
+	}
+	dbClient, err := db.InitPostgres(cfg)
+	if err != nil {
+		redisClient.Close()
+		return nil, nil, fmt.Errorf("failed to initialize PostgreSQL: %w", err)
+	}
+	if err := dbClient.InitSchema(); err != nil {
+		dbClient.ClosePostgres()
+		redisClient.Close()
+		return nil, nil, fmt.Errorf("failed to initialize schema: %w", err)
+	}
+
+	repo := NewEntryRepository(dbClient)
+	service := NewService()
+	service.SetRepository(repo)
+	service.SetRedis(redisClient)
+	// Events are only queued here; a running server delivers them
+	service.SetWebhooks(newWebhookDispatcher(repo, webhookOptions(cfg), nil))
+	service.SetCacheTTL(cfg.RedisCacheTTL)
+	service.SetDestinationValidator(newDestinationValidator(cfg))
+	if cfg.BlocklistFile != "" || cfg.HashPrefixFile != "" {
+		screener, err := screening.New(cfg.BlocklistFile, cfg.HashPrefixFile)
+		if err != nil {
+			dbClient.ClosePostgres()
+			redisClient.Close()
+			return nil, nil, fmt.Errorf("failed to initialize URL screening: %w", err)
+		}
+		service.SetScreener(screener, nil)
+	}
+	return service, func() {
+		dbClient.ClosePostgres()
+		redisClient.Close()
+	}, nil
+}
+
+// exportLinks writes the links matching filter to path, or stdout
+func exportLinks(ctx context.Context, service *Service, format, path string, filter ExportFilter, stdout, stderr io.Writer) error {
+	if !validFormat(format) {
+		return fmt.Errorf("format must be csv or jsonl")
+	}
+	w := stdout
+	if path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	count, err := service.ExportLinks(ctx, w, format, filter)
+	if err != nil {
+		return err
+	}
+	if f, ok := w.(*os.File); ok && path != "" {
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(stderr, "exported %d links\n", count)
+	return nil
+}
+
+// importLinks reads links from path, or stdin, and prints the report. With a
+// checkpoint file the last committed line is recorded after every batch and
+// used as the start line of the next run; it is removed once a run completes.
+func importLinks(ctx context.Context, service *Service, opts ImportOptions, path, checkpoint string, stdout, stderr io.Writer) error {
+	if !validFormat(opts.Format) {
+		return fmt.Errorf("format must be csv or jsonl")
+	}
+	if !validConflictMode(opts.OnConflict) {
+		return fmt.Errorf("on-conflict must be skip, overwrite or fail")
+	}
+	if opts.StartLine < 0 {
+		opts.StartLine = 0
+		if checkpoint != "" {
+			line, err := readCheckpoint(checkpoint)
+			if err != nil {
+				return err
+			}
+			opts.StartLine = line
+		}
+	}
+	if opts.StartLine > 0 {
+		fmt.Fprintf(stderr, "resuming after line %d\n", opts.StartLine)
+	}
+
+	var r io.Reader = os.Stdin
+	if path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var checkpointErr error
+	onCommit := func(line int) {
+		if checkpoint != "" && checkpointErr == nil {
+			checkpointErr = writeCheckpoint(checkpoint, line)
+		}
+	}
+	report, err := service.ImportLinks(ctx, r, opts, onCommit)
+	printReport(stdout, report)
+	if err != nil {
+		return fmt.Errorf("import stopped, resume after line %d: %w", report.LastLine, err)
+	}
+	if checkpointErr != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", checkpointErr)
+	}
+	if report.Aborted {
+		return fmt.Errorf("import aborted on a conflicting short code, resume after line %d", report.LastLine)
+	}
+	if checkpoint != "" {
+		if err := os.Remove(checkpoint); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// printReport writes a human readable summary of an import
+func printReport(w io.Writer, report ImportReport) {
+	for _, e := range report.Errors {
+		fmt.Fprintf(w, "line %d: %s\n", e.Line, e.Error)
+	}
+	if report.Failed > len(report.Errors) {
+		fmt.Fprintf(w, "... %d more errors\n", report.Failed-len(report.Errors))
+	}
+	fmt.Fprintf(w, "processed %d, created %d, overwritten %d, skipped %d, failed %d, last line %d\n",
+		report.Processed, report.Created, report.Overwritten, report.Skipped, report.Failed, report.LastLine)
+}
+
+// readCheckpoint returns the line stored in a checkpoint file, or 0 if the
+// file does not exist
+func readCheckpoint(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	line, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid checkpoint %s: %w", path, err)
+	}
+	return line, nil
+}
+
+// writeCheckpoint atomically replaces the checkpoint file with line
+func writeCheckpoint(path string, line int) error {
+	tmp := fmt.Sprintf("%s.tmp.%d", path, time.Now().UnixNano())
+	if err := os.WriteFile(tmp, []byte(strconv.Itoa(line)+"\n"), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// isCommand reports whether the process was started with a subcommand
+func isCommand(args []string) bool {
+	return len(args) > 0 && len(args[0]) > 0 && args[0][0] != '-'
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+	"net/netip"
+	"net/url"
+	"time"
+)
+
+// Visit is the raw request information captured when a link is resolved
+type Visit struct {
+	IP        netip.Addr
+	UserAgent string
+	Referer   string
+	Query     url.Values
+	// AcceptLanguage is the raw Accept-Language header
+	AcceptLanguage string
+	At             time.Time
+
+	// Variant is the destination variant of a split link remembered by the
+	// visitor's cookie, and once resolved the variant served
+	Variant string
+}
+
+// Click is a resolve event enriched for analytics, stored in click_events
+type Click struct {
+	ShortCode  string
+	OccurredAt time.Time
+	Country    string
+	Region     string
+	City       string
+
+	Browser        string
+	BrowserVersion string
+	OS             string
+	Device         string
+	Bot            bool
+	BotName        string
+
+	ReferrerDomain string
+	Channel        string
+	UTM            UTM
+
+	Variant string
+}
+
+// CountryCount is the number of clicks from one country
+type CountryCount struct {
+	Country string `json:"country"`
+	Clicks  int    `json:"clicks"`
+}
+
+// newVisit captures the analytics relevant parts of r
+func newVisit(r *http.Request, ips *ClientIPResolver) Visit {
+	return Visit{
+		IP:             ips.ClientIP(r),
+		UserAgent:      r.UserAgent(),
+		Referer:        r.Referer(),
+		AcceptLanguage: r.Header.Get("Accept-Language"),
+		Query:          r.URL.Query(),
+		At:             time.Now().UTC(),
+	}
+}
+
+// BreakdownItem is the number of clicks sharing one value of a dimension
+type BreakdownItem struct {
+	Name   string `json:"name"`
+	Clicks int    `json:"clicks"`
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+
+	"github.com/mahopon/SmolEarl/infra/redis"
+)
+
+const (
+	// clickStreamChannel is the Redis channel recorded clicks are published on
+	clickStreamChannel = "smolearl:clicks"
+	// clickStreamBuffer is how many clicks a slow subscriber may lag behind
+	// before further clicks are dropped for it
+	clickStreamBuffer = 256
+)
+
+// clickStream fans recorded clicks out to live subscribers. Clicks travel
+// through Redis pub/sub so subscribers see the clicks of every instance.
+type clickStream struct {
+	redis *redis.Redis
+}
+
+// newClickStream creates a clickStream on r
+func newClickStream(r *redis.Redis) *clickStream {
+	return &clickStream{redis: r}
+}
+
+// Publish sends click to the current subscribers
+func (c *clickStream) Publish(ctx context.Context, click Click) error {
+	payload, err := json.Marshal(click)
+	if err != nil {
+		return err
+	}
+	return c.redis.Publish(ctx, clickStreamChannel, payload)
+}
+
+// Subscribe returns the clicks published until ctx is done, after which the
+// channel is closed. Clicks are dropped rather than blocking when the
+// subscriber falls behind.
+func (c *clickStream) Subscribe(ctx context.Context) (<-chan Click, error) {
+	sub := c.redis.Subscribe(ctx, clickStreamChannel)
+	// Wait for the subscription so no click published after returning is lost
+	if _, err := sub.Receive(ctx); err != nil {
+		sub.Close()
+		return nil, err
+	}
+
+	clicks := make(chan Click, clickStreamBuffer)
+	go func() {
+		defer close(clicks)
+		defer sub.Close()
+		messages := sub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				var click Click
+				if err := json.Unmarshal([]byte(msg.Payload), &click); err != nil {
+					slog.WarnContext(ctx, "Ignoring malformed click message", "error", err)
+					continue
+				}
+				select {
+				case clicks <- click:
+				default:
+				}
+			}
+		}
+	}()
+	return clicks, nil
+}
+
+// SetClickStream publishes recorded clicks to stream
+func (s *Service) SetClickStream(stream *clickStream) {
+	s.clickStream = stream
+}
+
+// SubscribeClicks returns the clicks recorded by any instance until ctx is
+// done
+func (s *Service) SubscribeClicks(ctx context.Context) (<-chan Click, error) {
+	if s.clickStream == nil {
+		return nil, ErrClickStreamDisabled
+	}
+	return s.clickStream.Subscribe(ctx)
+}
@@ -1,72 +1,134 @@
 package config
 
 import (
-	"log"
-	"os"
+	"time"
 
-	"github.com/joho/godotenv"
+	"github.com/mahopon/SmolEarl/secrets"
 )
 
-// Config holds all application configuration
+// Config holds all application configuration.
+//
+// Every field is tagged with the key used in config files and on the command
+// line (underscores become dashes for flags), the environment variable that
+// overrides it and its default value. Fields tagged secret are redacted when
+// the configuration is printed and may be supplied by the configured secret
+// provider under their env name.
 type Config struct {
-	Port            string
-	Host            string
-	RedisHost       string
-	RedisPort       string
-	RedisPass       string
-	RedisDB         string
-	DBHost          string
-	DBPort          string
-	DBUser          string
-	DBPassword      string
-	DBName          string
-	AppName         string
-	AppVersion      string
-	KafkaBroker     string
-	KafkaClickTopic string
-	KafkaAsync      bool
-	PrometheusPort  string
-}
+	Port             int           `key:"port" env:"PORT" default:"8000"`
+	Host             string        `key:"host" env:"HOST" default:"localhost"`
+	HTTPReadTimeout  time.Duration `key:"http_read_timeout" env:"HTTP_READ_TIMEOUT" default:"10s"`
+	HTTPWriteTimeout time.Duration `key:"http_write_timeout" env:"HTTP_WRITE_TIMEOUT" default:"30s"`
+	HTTPIdleTimeout  time.Duration `key:"http_idle_timeout" env:"HTTP_IDLE_TIMEOUT" default:"120s"`
 
-// LoadConfig loads configuration from .env file
-func LoadConfig() *Config {
-	// Load .env file
-	err := godotenv.Load()
-	if err != nil {
-		log.Println("No .env file found, using environment variables")
-	}
-
-	// Load configuration with defaults
-	config := &Config{
-		Port:            getEnv("PORT", "8000"),
-		Host:            getEnv("HOST", "localhost"),
-		RedisHost:       getEnv("REDIS_HOST", "localhost"),
-		RedisPort:       getEnv("REDIS_PORT", "6379"),
-		RedisPass:       getEnv("REDIS_PASSWORD", ""),
-		RedisDB:         getEnv("REDIS_DB", "0"),
-		DBHost:          getEnv("POSTGRES_HOST", "localhost"),
-		DBPort:          getEnv("POSTGRES_PORT", "5432"),
-		DBUser:          getEnv("POSTGRES_USER", "postgres"),
-		DBPassword:      getEnv("POSTGRES_PASSWORD", "postgres"),
-		DBName:          getEnv("POSTGRES_DB", "smolearl"),
-		AppName:         getEnv("APP_NAME", "SmolEarl"),
-		AppVersion:      getEnv("APP_VERSION", "1.0.0"),
-		KafkaBroker:     getEnv("KAFKA_BROKER", "localhost:9092"),
-		KafkaClickTopic: getEnv("KAFKA_CLICK_TOPIC", "click-events"),
-		KafkaAsync:      getEnv("KAFKA_ASYNC", "true") == "true",
-		PrometheusPort:  getEnv("PROMETHEUS_PORT", "9090"),
-	}
-
-	return config
-}
+	// PublicBaseURL is the externally visible prefix of short links, e.g.
+	// https://smol.example/link
+	PublicBaseURL string `key:"public_base_url" env:"PUBLIC_BASE_URL" default:"http://localhost:8000/link"`
+	// SelfHosts are further host names serving this instance. Links to them,
+	// or to the host of PublicBaseURL, are rejected to avoid redirect loops.
+	SelfHosts []string `key:"self_hosts" env:"SELF_HOSTS"`
 
-// getEnv returns the value of an environment variable or a default value
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
-	}
-	return defaultValue
-}
+	URLAllowedSchemes []string `key:"url_allowed_schemes" env:"URL_ALLOWED_SCHEMES" default:"http,https"`
+	URLMaxLength      int      `key:"url_max_length" env:"URL_MAX_LENGTH" default:"2048"`
+
+	// BlocklistFile is a YAML file of denied domains and URL patterns and
+	// HashPrefixFile lists hex SHA-256 prefixes of Safe Browsing style URL
+	// expressions. Both are reloaded when they change.
+	BlocklistFile           string        `key:"blocklist_file" env:"BLOCKLIST_FILE"`
+	HashPrefixFile          string        `key:"hash_prefix_file" env:"HASH_PREFIX_FILE"`
+	BlocklistReloadInterval time.Duration `key:"blocklist_reload_interval" env:"BLOCKLIST_RELOAD_INTERVAL" default:"30s"`
+
+	RedisHost     string        `key:"redis_host" env:"REDIS_HOST" default:"localhost"`
+	RedisPort     int           `key:"redis_port" env:"REDIS_PORT" default:"6379"`
+	RedisPass     string        `key:"redis_password" env:"REDIS_PASSWORD" secret:"true"`
+	RedisDB       int           `key:"redis_db" env:"REDIS_DB" default:"0"`
+	RedisCacheTTL time.Duration `key:"redis_cache_ttl" env:"REDIS_CACHE_TTL" default:"24h"`
+
+	DBHost     string `key:"postgres_host" env:"POSTGRES_HOST" default:"localhost"`
+	DBPort     int    `key:"postgres_port" env:"POSTGRES_PORT" default:"5432"`
+	DBUser     string `key:"postgres_user" env:"POSTGRES_USER" default:"postgres"`
+	DBPassword string `key:"postgres_password" env:"POSTGRES_PASSWORD" default:"postgres" secret:"true"`
+	DBName     string `key:"postgres_db" env:"POSTGRES_DB" default:"smolearl"`
+	DBSSLMode  string `key:"postgres_sslmode" env:"POSTGRES_SSLMODE" default:"disable"`
+	DBMaxConns int    `key:"postgres_max_conns" env:"POSTGRES_MAX_CONNS" default:"0"`
+
+	AppName    string `key:"app_name" env:"APP_NAME" default:"SmolEarl"`
+	AppVersion string `key:"app_version" env:"APP_VERSION" default:"1.0.0"`
+
+	KafkaBroker     string `key:"kafka_broker" env:"KAFKA_BROKER" default:"localhost:9092"`
+	KafkaClickTopic string `key:"kafka_click_topic" env:"KAFKA_CLICK_TOPIC" default:"click-events"`
+	KafkaAsync      bool   `key:"kafka_async" env:"KAFKA_ASYNC" default:"true"`
+
+	// PrometheusPort serves /metrics on a dedicated listener when non-zero,
+	// otherwise metrics share the main HTTP port
+	PrometheusPort int `key:"prometheus_port" env:"PROMETHEUS_PORT" default:"0"`
+
+	LogLevel  string `key:"log_level" env:"LOG_LEVEL" default:"info"`
+	LogFormat string `key:"log_format" env:"LOG_FORMAT" default:"json"`
+
+	CORSAllowedOrigins   []string `key:"cors_allowed_origins" env:"CORS_ALLOWED_ORIGINS" default:"*"`
+	CORSAllowedMethods   []string `key:"cors_allowed_methods" env:"CORS_ALLOWED_METHODS" default:"GET,POST,PUT,PATCH,DELETE,OPTIONS"`
+	CORSAllowedHeaders   []string `key:"cors_allowed_headers" env:"CORS_ALLOWED_HEADERS" default:"Content-Type,Authorization,X-Request-ID"`
+	CORSMaxAge           int      `key:"cors_max_age" env:"CORS_MAX_AGE" default:"600"`
+	CORSAllowCredentials bool     `key:"cors_allow_credentials" env:"CORS_ALLOW_CREDENTIALS" default:"false"`
 
-// Global configuration instance
-var AppConfig = LoadConfig()
+	// BulkMaxItems caps the number of links a single POST /link/bulk creates
+	BulkMaxItems int `key:"bulk_max_items" env:"BULK_MAX_ITEMS" default:"1000"`
+
+	// VisitorPersistInterval controls how often unique visitor HyperLogLogs
+	// are copied from Redis to PostgreSQL
+	VisitorPersistInterval time.Duration `key:"visitor_persist_interval" env:"VISITOR_PERSIST_INTERVAL" default:"5m"`
+
+	// GeoIPDatabase is a GeoLite2/GeoIP2 City .mmdb file; geolocation is
+	// disabled when empty
+	GeoIPDatabase  string   `key:"geoip_database" env:"GEOIP_DATABASE"`
+	TrustedProxies []string `key:"trusted_proxies" env:"TRUSTED_PROXIES"`
+
+	// IOSAppIDs are the TEAMID.bundle.id of iOS apps allowed to open short
+	// links as universal links
+	IOSAppIDs []string `key:"ios_app_ids" env:"IOS_APP_IDS"`
+	// AndroidPackage and AndroidCertFingerprints identify the Android app
+	// verified to open short links as App Links
+	AndroidPackage          string   `key:"android_package" env:"ANDROID_PACKAGE"`
+	AndroidCertFingerprints []string `key:"android_cert_fingerprints" env:"ANDROID_CERT_FINGERPRINTS"`
+
+	// Webhook deliveries are attempted by WebhookWorkers workers, each with
+	// WebhookTimeout, and retried with exponential backoff from WebhookBackoff
+	// until WebhookMaxAttempts. Clicks are sent in batches every
+	// WebhookClickBatchInterval. Endpoints on private addresses are refused
+	// unless WebhookAllowPrivate is set.
+	WebhookWorkers            int           `key:"webhook_workers" env:"WEBHOOK_WORKERS" default:"4"`
+	WebhookTimeout            time.Duration `key:"webhook_timeout" env:"WEBHOOK_TIMEOUT" default:"10s"`
+	WebhookBackoff            time.Duration `key:"webhook_backoff" env:"WEBHOOK_BACKOFF" default:"30s"`
+	WebhookMaxAttempts        int           `key:"webhook_max_attempts" env:"WEBHOOK_MAX_ATTEMPTS" default:"8"`
+	WebhookClickBatchInterval time.Duration `key:"webhook_click_batch_interval" env:"WEBHOOK_CLICK_BATCH_INTERVAL" default:"10s"`
+	WebhookAllowPrivate       bool          `key:"webhook_allow_private" env:"WEBHOOK_ALLOW_PRIVATE" default:"false"`
+
+	// GRPCPort serves the gRPC API when non-zero. Calls must carry one of
+	// GRPCTokens as a bearer token when any are set, and calls without a
+	// deadline get GRPCDefaultDeadline.
+	GRPCPort            int           `key:"grpc_port" env:"GRPC_PORT" default:"0"`
+	GRPCTokens          []string      `key:"grpc_tokens" env:"GRPC_TOKENS" secret:"true"`
+	GRPCDefaultDeadline time.Duration `key:"grpc_default_deadline" env:"GRPC_DEFAULT_DEADLINE" default:"10s"`
+
+	// ShutdownTimeout bounds how long in-flight requests and webhook
+	// deliveries may take to finish on SIGINT or SIGTERM
+	ShutdownTimeout time.Duration `key:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" default:"30s"`
+
+	// QRLogo is a PNG drawn in the center of QR codes requested with logo=true
+	QRLogo string `key:"qr_logo" env:"QR_LOGO"`
+
+	SecretProvider    string        `key:"secret_provider" env:"SECRET_PROVIDER" default:"env"`
+	SecretsDir        string        `key:"secrets_dir" env:"SECRETS_DIR" default:"/etc/smolearl/secrets"`
+	VaultAddr         string        `key:"vault_addr" env:"VAULT_ADDR"`
+	VaultToken        string        `key:"vault_token" env:"VAULT_TOKEN" secret:"true"`
+	VaultRoleID       string        `key:"vault_role_id" env:"VAULT_ROLE_ID"`
+	VaultSecretID     string        `key:"vault_secret_id" env:"VAULT_SECRET_ID" secret:"true"`
+	VaultAuthMount    string        `key:"vault_auth_mount" env:"VAULT_AUTH_MOUNT" default:"approle"`
+	VaultMount        string        `key:"vault_mount" env:"VAULT_MOUNT" default:"secret"`
+	VaultPath         string        `key:"vault_path" env:"VAULT_PATH" default:"smolearl"`
+	VaultPollInterval time.Duration `key:"vault_poll_interval" env:"VAULT_POLL_INTERVAL" default:"1m"`
+
+	// Secrets is the provider the secret fields were resolved from. Providers
+	// implementing secrets.Rotator report later changes to those values.
+	Secrets secrets.Provider
+}
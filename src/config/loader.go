@@ -0,0 +1,461 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/mahopon/SmolEarl/secrets"
+	"github.com/pelletier/go-toml/v2"
+	"go.yaml.in/yaml/v3"
+)
+
+// Source identifies which layer an effective configuration value came from
+type Source string
+
+const (
+	SourceDefault Source = "default"
+	SourceFile    Source = "file"
+	SourceEnv     Source = "env"
+	SourceFlag    Source = "flag"
+	SourceSecret  Source = "secret"
+)
+
+// providedSecrets lists the keys resolved through the secret provider. Their
+// env names double as the secret names.
+var providedSecrets = []string{"postgres_password", "redis_password"}
+
+// ConfigFileEnv names the environment variable that points at a config file
+const ConfigFileEnv = "CONFIG_FILE"
+
+// redacted replaces secret values when the configuration is printed
+const redacted = "<redacted>"
+
+// Setting is a single effective configuration value
+type Setting struct {
+	Key    string
+	Env    string
+	Value  string
+	Source Source
+}
+
+// field binds a Config struct field to its key, env var and default
+type field struct {
+	key    string
+	env    string
+	def    string
+	secret bool
+	value  reflect.Value
+	source Source
+}
+
+// loader applies the configuration layers to a Config
+type loader struct {
+	cfg    *Config
+	fields []*field
+	byKey  map[string]*field
+}
+
+// LoadConfig builds the configuration from defaults, an optional YAML or TOML
+// file, environment variables and command line flags, in increasing order of
+// precedence, and validates the result. Passwords are then resolved through
+// the configured secret provider.
+func LoadConfig(ctx context.Context, args []string) (*Config, error) {
+	l, err := load(args)
+	if err != nil {
+		return nil, err
+	}
+	if err := l.cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if err := l.resolveSecrets(ctx); err != nil {
+		return nil, err
+	}
+	return l.cfg, nil
+}
+
+// Effective loads the configuration like LoadConfig and describes every value
+// with secrets redacted. Secrets of the secret provider are described by
+// where they are read from instead of being fetched. Validation errors are
+// returned alongside the settings so they can be shown together.
+func Effective(args []string) ([]Setting, error) {
+	l, err := load(args)
+	if err != nil {
+		return nil, err
+	}
+	validationErr := l.cfg.Validate()
+
+	settings := make([]Setting, 0, len(l.fields))
+	for _, f := range l.fields {
+		value := formatValue(f.value)
+		if f.secret && value != "" {
+			value = redacted
+		}
+		source := f.source
+		if ref := secretReference(l.cfg, f); ref != "" {
+			value, source = ref, SourceSecret+Source(":"+l.cfg.SecretProvider)
+		}
+		settings = append(settings, Setting{Key: f.key, Env: f.env, Value: value, Source: source})
+	}
+	return settings, validationErr
+}
+
+// secretReference names where the secret provider reads f from, or returns ""
+// when f is not provided by it. The provider falls back to the layered value
+// when the secret is missing.
+func secretReference(c *Config, f *field) string {
+	if !slices.Contains(providedSecrets, f.key) {
+		return ""
+	}
+	switch c.SecretProvider {
+	case "file":
+		return filepath.Join(c.SecretsDir, f.env)
+	case "vault":
+		return fmt.Sprintf("%s/%s#%s", c.VaultMount, strings.TrimPrefix(c.VaultPath, "/"), f.env)
+	default:
+		return ""
+	}
+}
+
+// PrintEffective writes the effective configuration to w, one key per line
+func PrintEffective(w io.Writer, args []string) error {
+	settings, err := Effective(args)
+	if settings == nil {
+		return err
+	}
+
+	width := 0
+	for _, s := range settings {
+		width = max(width, len(s.Key))
+	}
+	for _, s := range settings {
+		fmt.Fprintf(w, "%-*s = %-24q # %s\n", width, s.Key, s.Value, s.Source)
+	}
+	return err
+}
+
+// load runs every layer without validating the result
+func load(args []string) (*loader, error) {
+	// Load .env file
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found, using environment variables")
+	}
+
+	l := newLoader()
+	for _, f := range l.fields {
+		if err := setValue(f.value, f.def); err != nil {
+			return nil, fmt.Errorf("default for %s: %w", f.key, err)
+		}
+		f.source = SourceDefault
+	}
+
+	path, overrides, err := l.parseFlags(args)
+	if err != nil {
+		return nil, err
+	}
+	if path == "" {
+		path = os.Getenv(ConfigFileEnv)
+	}
+	if path != "" {
+		if err := l.applyFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	// A variable that is set but empty is an explicit value, so it clears
+	// the setting
+	for _, f := range l.fields {
+		if value, ok := os.LookupEnv(f.env); ok {
+			if err := setValue(f.value, value); err != nil {
+				return nil, fmt.Errorf("environment variable %s: %w", f.env, err)
+			}
+			f.source = SourceEnv
+		}
+	}
+
+	for _, o := range overrides {
+		f := l.byKey[o.key]
+		if err := setValue(f.value, o.value); err != nil {
+			return nil, fmt.Errorf("flag --%s: %w", flagName(f.key), err)
+		}
+		f.source = SourceFlag
+	}
+
+	return l, nil
+}
+
+// resolveSecrets builds the configured secret provider and replaces the
+// provided secrets with its values. Secrets missing from the provider keep
+// their layered value.
+func (l *loader) resolveSecrets(ctx context.Context) error {
+	provider, err := newSecretProvider(ctx, l.cfg)
+	if err != nil {
+		return fmt.Errorf("secret provider %s: %w", l.cfg.SecretProvider, err)
+	}
+	l.cfg.Secrets = provider
+
+	// The env provider would only repeat the env layer
+	if _, ok := provider.(secrets.EnvProvider); ok {
+		return nil
+	}
+
+	for _, key := range providedSecrets {
+		f := l.byKey[key]
+		value, err := provider.GetSecret(ctx, f.env)
+		if errors.Is(err, secrets.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("secret %s: %w", f.env, err)
+		}
+		f.value.SetString(value)
+		f.source = SourceSecret + Source(":"+provider.Name())
+	}
+	return nil
+}
+
+// newSecretProvider builds the provider selected by secret_provider
+func newSecretProvider(ctx context.Context, c *Config) (secrets.Provider, error) {
+	switch c.SecretProvider {
+	case "file":
+		return secrets.NewFileProvider(c.SecretsDir), nil
+	case "vault":
+		return secrets.NewVaultProvider(ctx, secrets.VaultConfig{
+			Address:      c.VaultAddr,
+			Token:        c.VaultToken,
+			RoleID:       c.VaultRoleID,
+			SecretID:     c.VaultSecretID,
+			AuthMount:    c.VaultAuthMount,
+			Mount:        c.VaultMount,
+			Path:         c.VaultPath,
+			PollInterval: c.VaultPollInterval,
+		})
+	default:
+		return secrets.EnvProvider{}, nil
+	}
+}
+
+// newLoader reflects over Config to collect its tagged fields
+func newLoader() *loader {
+	l := &loader{cfg: &Config{}, byKey: make(map[string]*field)}
+
+	v := reflect.ValueOf(l.cfg).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		key := sf.Tag.Get("key")
+		if key == "" {
+			continue
+		}
+		f := &field{
+			key:    key,
+			env:    sf.Tag.Get("env"),
+			def:    sf.Tag.Get("default"),
+			secret: sf.Tag.Get("secret") == "true",
+			value:  v.Field(i),
+		}
+		l.fields = append(l.fields, f)
+		l.byKey[key] = f
+	}
+	return l
+}
+
+type flagOverride struct {
+	key   string
+	value string
+}
+
+// parseFlags parses args into the config file path and per-key overrides,
+// kept in command line order
+func (l *loader) parseFlags(args []string) (string, []flagOverride, error) {
+	fs := flag.NewFlagSet("smolearl", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	var path string
+	fs.StringVar(&path, "config", "", "path to a YAML or TOML config file")
+
+	var overrides []flagOverride
+	for _, f := range l.fields {
+		key := f.key
+		usage := fmt.Sprintf("overrides %s (env %s)", key, f.env)
+		set := func(value string) error {
+			overrides = append(overrides, flagOverride{key: key, value: value})
+			return nil
+		}
+		if f.value.Kind() == reflect.Bool {
+			fs.BoolFunc(flagName(key), usage, set)
+		} else {
+			fs.Func(flagName(key), usage, set)
+		}
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return "", nil, fmt.Errorf("invalid command line: %w", err)
+	}
+	if fs.NArg() > 0 {
+		return "", nil, fmt.Errorf("invalid command line: unexpected argument %q", fs.Arg(0))
+	}
+	return path, overrides, nil
+}
+
+// applyFile reads a YAML or TOML file chosen by its extension. Nested tables
+// are flattened with underscores, so redis: {db: 1} sets redis_db.
+func (l *loader) applyFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+
+	raw := map[string]any{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	default:
+		return fmt.Errorf("config file %s: unsupported extension, expected .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	values := map[string]any{}
+	flatten("", raw, values)
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var errs []error
+	for _, key := range keys {
+		f, ok := l.byKey[key]
+		if !ok {
+			errs = append(errs, fmt.Errorf("unknown key %q", key))
+			continue
+		}
+		if err := setValue(f.value, fileValueString(values[key])); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+			continue
+		}
+		f.source = SourceFile
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("config file %s: %w", path, errors.Join(errs...))
+	}
+	return nil
+}
+
+// flatten joins nested map keys with underscores
+func flatten(prefix string, in map[string]any, out map[string]any) {
+	for k, v := range in {
+		key := strings.ToLower(k)
+		if prefix != "" {
+			key = prefix + "_" + key
+		}
+		if nested, ok := v.(map[string]any); ok {
+			flatten(key, nested, out)
+			continue
+		}
+		out[key] = v
+	}
+}
+
+// fileValueString renders a decoded YAML/TOML scalar or list as the string
+// form understood by setValue
+func fileValueString(v any) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case []any:
+		items := make([]string, 0, len(val))
+		for _, item := range val {
+			items = append(items, fmt.Sprint(item))
+		}
+		return strings.Join(items, ",")
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+// setValue parses raw into the field according to its type. An empty raw
+// sets the zero value.
+func setValue(v reflect.Value, raw string) error {
+	raw = strings.TrimSpace(raw)
+
+	switch {
+	case v.Type() == reflect.TypeOf(time.Duration(0)):
+		if raw == "" {
+			v.SetInt(0)
+			return nil
+		}
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", raw)
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(raw)
+	case v.Kind() == reflect.Int:
+		if raw == "" {
+			v.SetInt(0)
+			return nil
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", raw)
+		}
+		v.SetInt(int64(n))
+	case v.Kind() == reflect.Bool:
+		if raw == "" {
+			v.SetBool(false)
+			return nil
+		}
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", raw)
+		}
+		v.SetBool(b)
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String:
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported config type %s", v.Type())
+	}
+	return nil
+}
+
+// formatValue renders a field in the same syntax setValue accepts
+func formatValue(v reflect.Value) string {
+	switch {
+	case v.Type() == reflect.TypeOf(time.Duration(0)):
+		return time.Duration(v.Int()).String()
+	case v.Kind() == reflect.Slice:
+		return strings.Join(v.Interface().([]string), ",")
+	default:
+		return fmt.Sprint(v.Interface())
+	}
+}
+
+// flagName converts a config key into its command line flag name
+func flagName(key string) string {
+	return strings.ReplaceAll(key, "_", "-")
+}
@@ -0,0 +1,89 @@
+package config
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEffectiveDescribesProvidedSecrets(t *testing.T) {
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Effective contacted Vault: %s %s", r.Method, r.URL.Path)
+	}))
+	defer vault.Close()
+
+	tests := []struct {
+		name string
+		args []string
+		want map[string]string
+	}{
+		{
+			name: "vault",
+			args: []string{"--secret-provider", "vault", "--vault-addr", vault.URL, "--vault-token", "s.token",
+				"--vault-path", "/apps/smolearl"},
+			want: map[string]string{
+				"postgres_password": "secret/apps/smolearl#POSTGRES_PASSWORD",
+				"redis_password":    "secret/apps/smolearl#REDIS_PASSWORD",
+				"vault_token":       redacted,
+			},
+		},
+		{
+			name: "file",
+			args: []string{"--secret-provider", "file", "--secrets-dir", "/run/secrets"},
+			want: map[string]string{
+				"postgres_password": filepath.Join("/run/secrets", "POSTGRES_PASSWORD"),
+				"redis_password":    filepath.Join("/run/secrets", "REDIS_PASSWORD"),
+			},
+		},
+		{
+			name: "env",
+			args: []string{"--postgres-password", "hunter2"},
+			want: map[string]string{"postgres_password": redacted},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings, _ := Effective(tt.args)
+			if settings == nil {
+				t.Fatal("Effective returned no settings")
+			}
+			got := make(map[string]Setting, len(settings))
+			for _, s := range settings {
+				got[s.Key] = s
+			}
+			for key, want := range tt.want {
+				if got[key].Value != want {
+					t.Errorf("%s = %q, want %q", key, got[key].Value, want)
+				}
+			}
+		})
+	}
+}
+
+func TestEmptyEnvClearsFileSettings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	file := "redis_db: 2\nkafka_async: true\nself_hosts: a.example,b.example\nhttp_idle_timeout: 5m\n"
+	if err := os.WriteFile(path, []byte(file), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for _, env := range []string{"REDIS_DB", "KAFKA_ASYNC", "SELF_HOSTS", "HTTP_IDLE_TIMEOUT"} {
+		t.Setenv(env, "")
+	}
+
+	l, err := load([]string{"--config", path})
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if l.cfg.RedisDB != 0 || l.cfg.KafkaAsync || l.cfg.SelfHosts != nil || l.cfg.HTTPIdleTimeout != time.Duration(0) {
+		t.Errorf("empty variables kept file settings: redis_db %d, kafka_async %v, self_hosts %v, http_idle_timeout %v",
+			l.cfg.RedisDB, l.cfg.KafkaAsync, l.cfg.SelfHosts, l.cfg.HTTPIdleTimeout)
+	}
+	for _, key := range []string{"redis_db", "kafka_async", "self_hosts", "http_idle_timeout"} {
+		if got := l.byKey[key].source; got != SourceEnv {
+			t.Errorf("%s source = %s, want %s", key, got, SourceEnv)
+		}
+	}
+}
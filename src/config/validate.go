@@ -0,0 +1,134 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	// iosAppID matches an Apple team ID followed by a bundle ID
+	iosAppID = regexp.MustCompile(`^[A-Z0-9]{10}\.[A-Za-z0-9.-]+$`)
+	// certFingerprint matches a SHA-256 fingerprint as printed by keytool
+	certFingerprint = regexp.MustCompile(`^[0-9A-Fa-f]{2}(:[0-9A-Fa-f]{2}){31}$`)
+)
+
+// Validate checks the configuration and reports every problem at once
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, key, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+		}
+	}
+
+	checkPort := func(key string, port int, optional bool) {
+		if optional && port == 0 {
+			return
+		}
+		check(port >= 1 && port <= 65535, key, "must be between 1 and 65535, got %d", port)
+	}
+	checkPositive := func(key string, d time.Duration) {
+		check(d > 0, key, "must be a positive duration, got %s", d)
+	}
+	checkRequired := func(key, value string) {
+		check(strings.TrimSpace(value) != "", key, "must not be empty")
+	}
+
+	checkPort("port", c.Port, false)
+	checkRequired("host", c.Host)
+	checkPositive("http_read_timeout", c.HTTPReadTimeout)
+	checkPositive("http_write_timeout", c.HTTPWriteTimeout)
+	checkPositive("http_idle_timeout", c.HTTPIdleTimeout)
+	base, err := url.Parse(c.PublicBaseURL)
+	check(err == nil && (base.Scheme == "http" || base.Scheme == "https") && base.Host != "" && base.RawQuery == "",
+		"public_base_url", "must be an absolute http or https URL without a query, got %q", c.PublicBaseURL)
+	check(len(c.URLAllowedSchemes) > 0, "url_allowed_schemes", "must not be empty")
+	for _, scheme := range c.URLAllowedSchemes {
+		check(!slices.Contains([]string{"javascript", "data", "vbscript", "file"}, strings.ToLower(scheme)),
+			"url_allowed_schemes", "%q is not safe to redirect to", scheme)
+	}
+	checkPositive("blocklist_reload_interval", c.BlocklistReloadInterval)
+	check(c.URLMaxLength >= 16 && c.URLMaxLength <= 65536, "url_max_length", "must be between 16 and 65536, got %d", c.URLMaxLength)
+
+	checkRequired("redis_host", c.RedisHost)
+	checkPort("redis_port", c.RedisPort, false)
+	check(c.RedisDB >= 0 && c.RedisDB <= 15, "redis_db", "must be between 0 and 15, got %d", c.RedisDB)
+	checkPositive("redis_cache_ttl", c.RedisCacheTTL)
+	checkPositive("visitor_persist_interval", c.VisitorPersistInterval)
+	check(c.BulkMaxItems >= 1 && c.BulkMaxItems <= 100000, "bulk_max_items", "must be between 1 and 100000, got %d", c.BulkMaxItems)
+
+	checkRequired("postgres_host", c.DBHost)
+	checkPort("postgres_port", c.DBPort, false)
+	checkRequired("postgres_user", c.DBUser)
+	checkRequired("postgres_db", c.DBName)
+	check(slices.Contains([]string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}, c.DBSSLMode),
+		"postgres_sslmode", "unknown mode %q", c.DBSSLMode)
+	check(c.DBMaxConns >= 0, "postgres_max_conns", "must not be negative, got %d", c.DBMaxConns)
+
+	checkPort("prometheus_port", c.PrometheusPort, true)
+	check(c.PrometheusPort == 0 || c.PrometheusPort != c.Port, "prometheus_port",
+		"must differ from port %d, use 0 to serve metrics on the main listener", c.Port)
+
+	var level slog.Level
+	check(level.UnmarshalText([]byte(c.LogLevel)) == nil, "log_level",
+		"must be one of debug, info, warn or error, got %q", c.LogLevel)
+	check(c.LogFormat == "json" || c.LogFormat == "text", "log_format", "must be json or text, got %q", c.LogFormat)
+
+	check(c.CORSMaxAge >= 0, "cors_max_age", "must not be negative, got %d", c.CORSMaxAge)
+	check(!(c.CORSAllowCredentials && slices.Contains(c.CORSAllowedOrigins, "*")), "cors_allow_credentials",
+		"cannot be enabled while cors_allowed_origins contains *")
+
+	check(c.WebhookWorkers >= 1 && c.WebhookWorkers <= 64, "webhook_workers", "must be between 1 and 64, got %d", c.WebhookWorkers)
+	checkPositive("webhook_timeout", c.WebhookTimeout)
+	checkPositive("webhook_backoff", c.WebhookBackoff)
+	check(c.WebhookMaxAttempts >= 1 && c.WebhookMaxAttempts <= 50, "webhook_max_attempts",
+		"must be between 1 and 50, got %d", c.WebhookMaxAttempts)
+	checkPositive("webhook_click_batch_interval", c.WebhookClickBatchInterval)
+	checkPositive("shutdown_timeout", c.ShutdownTimeout)
+
+	checkPort("grpc_port", c.GRPCPort, true)
+	check(c.GRPCPort == 0 || (c.GRPCPort != c.Port && c.GRPCPort != c.PrometheusPort), "grpc_port",
+		"must differ from port and prometheus_port")
+	checkPositive("grpc_default_deadline", c.GRPCDefaultDeadline)
+
+	for _, id := range c.IOSAppIDs {
+		check(iosAppID.MatchString(id), "ios_app_ids", "%q is not of the form TEAMID.bundle.id", id)
+	}
+	check((c.AndroidPackage == "") == (len(c.AndroidCertFingerprints) == 0), "android_package",
+		"and android_cert_fingerprints must be set together")
+	for _, fingerprint := range c.AndroidCertFingerprints {
+		check(certFingerprint.MatchString(fingerprint), "android_cert_fingerprints",
+			"%q is not a colon separated SHA-256 fingerprint", fingerprint)
+	}
+
+	for _, proxy := range c.TrustedProxies {
+		_, prefixErr := netip.ParsePrefix(proxy)
+		_, addrErr := netip.ParseAddr(proxy)
+		check(prefixErr == nil || addrErr == nil, "trusted_proxies", "%q is not an IP address or CIDR", proxy)
+	}
+
+	check(slices.Contains([]string{"env", "file", "vault"}, c.SecretProvider), "secret_provider",
+		"must be env, file or vault, got %q", c.SecretProvider)
+	if c.SecretProvider == "file" {
+		checkRequired("secrets_dir", c.SecretsDir)
+	}
+	if c.SecretProvider == "vault" {
+		checkRequired("vault_addr", c.VaultAddr)
+		checkRequired("vault_path", c.VaultPath)
+		check(c.VaultToken != "" || (c.VaultRoleID != "" && c.VaultSecretID != ""), "vault_token",
+			"or vault_role_id and vault_secret_id must be set")
+		checkPositive("vault_poll_interval", c.VaultPollInterval)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
@@ -2,48 +2,142 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Controller struct {
-	service *Service
+	service      *Service
+	clientIP     *ClientIPResolver
+	qr           *QRRenderer
+	apps         *AppAssociation
+	openAPI      *OpenAPI
+	bulkMaxItems int
 }
 
+// defaultBulkMaxItems caps POST /bulk unless configured otherwise
+const defaultBulkMaxItems = 1000
+
 func NewController(service *Service) *Controller {
 	return &Controller{
-		service: service,
+		service:      service,
+		clientIP:     &ClientIPResolver{},
+		qr:           NewQRRenderer("http://localhost:8000/link"),
+		openAPI:      NewOpenAPI("SmolEarl", "1.0.0"),
+		bulkMaxItems: defaultBulkMaxItems,
 	}
 }
 
+// SetOpenAPI sets the OpenAPI document served at /openapi.json
+func (c *Controller) SetOpenAPI(openAPI *OpenAPI) {
+	c.openAPI = openAPI
+}
+
+// SetBulkMaxItems sets how many links a single bulk request may create
+func (c *Controller) SetBulkMaxItems(n int) {
+	c.bulkMaxItems = n
+}
+
+// SetClientIPResolver sets how client addresses are derived from requests
+func (c *Controller) SetClientIPResolver(resolver *ClientIPResolver) {
+	c.clientIP = resolver
+}
+
+// SetQRRenderer sets how QR codes are drawn
+func (c *Controller) SetQRRenderer(qr *QRRenderer) {
+	c.qr = qr
+}
+
+// SetAppAssociation sets the apps verified to open short links
+func (c *Controller) SetAppAssociation(apps *AppAssociation) {
+	c.apps = apps
+}
+
 // CreateHandler handles POST /create requests
 func (c *Controller) CreateHandler(w http.ResponseWriter, r *http.Request) {
-	var data map[string]any
-	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+	var req CreateRequest
+	if !decodeJSON(w, r, &req, maxBodyBytes) {
 		return
 	}
 
-	// Check if customAlias is provided in the request body
-	var customAlias string
-	if alias, exists := data["customAlias"]; exists {
-		if aliasStr, ok := alias.(string); ok {
-			customAlias = aliasStr
-		}
-	}
-
 	// Call service to create entry with custom alias if provided
-	id, err := c.service.Create(data, customAlias)
+	id, existing, err := c.service.Create(r.Context(), req)
 	if err != nil {
-		http.Error(w, "Failed to create entry", http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
 	// Return success response
+	message := "Entry created successfully"
+	if existing {
+		message = "Entry already exists"
+	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]any{
-		"message": "Entry created successfully",
-		"id":      id,
-	})
+	json.NewEncoder(w).Encode(CreateResponse{Message: message, ID: id, Existing: existing})
+}
+
+// GetOwnerSettingsHandler handles GET /owners/{owner}/settings requests
+func (c *Controller) GetOwnerSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	settings, err := c.service.GetOwnerSettings(r.Context(), r.PathValue("owner"))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
+// PutOwnerSettingsHandler handles PUT /owners/{owner}/settings requests
+func (c *Controller) PutOwnerSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	var settings OwnerSettings
+	if !decodeJSON(w, r, &settings, maxBodyBytes) {
+		return
+	}
+	settings.Owner = r.PathValue("owner")
+
+	if err := c.service.SaveOwnerSettings(r.Context(), settings); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
+// BulkCreateHandler handles POST /bulk requests
+func (c *Controller) BulkCreateHandler(w http.ResponseWriter, r *http.Request) {
+	var body BulkRequest
+	if !decodeJSON(w, r, &body, maxBulkBodyBytes) {
+		return
+	}
+	if len(body.Items) == 0 {
+		writeError(w, r, newError(CodeInvalidInput, "No items"))
+		return
+	}
+	if len(body.Items) > c.bulkMaxItems {
+		writeError(w, r, newError(CodeTooLarge, "Too many items, at most %d are allowed", c.bulkMaxItems))
+		return
+	}
+
+	results := c.service.CreateBulk(r.Context(), body.Items)
+
+	resp := BulkResponse{Results: results}
+	for _, res := range results {
+		if res.Error == "" {
+			resp.Created++
+		}
+	}
+	resp.Failed = len(results) - resp.Created
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
 }
 
 // GetHandler handles GET /{id} requests
@@ -53,14 +147,39 @@ func (c *Controller) GetHandler(w http.ResponseWriter, r *http.Request) {
 
 	// If path is empty (root path), return a default response or redirect
 	if path == "" {
-		http.Error(w, "Missing input", http.StatusBadRequest)
+		writeError(w, r, newError(CodeInvalidInput, "Missing input"))
 		return
 	}
 
-	// Call service to get entry
-	entry, err := c.service.Get(path)
+	// Call service to resolve the entry for this visitor
+	visit := newVisit(r, c.clientIP)
+	if cookie, err := r.Cookie(variantCookieName(path)); err == nil {
+		visit.Variant = cookie.Value
+	}
+	entry, err := c.service.Resolve(r.Context(), path, visit)
+	if errors.Is(err, ErrLinkDisabled) {
+		writeInterstitial(w, r, path)
+		return
+	}
 	if err != nil {
-		http.Error(w, "Entry not found", http.StatusNotFound)
+		writeError(w, r, err)
+		return
+	}
+
+	// Keep the visitor on the variant served by a split link
+	visit.Variant = entry.Variant
+	if visit.Variant != "" && entry.Sticky == stickyCookie {
+		setVariantCookie(w, path, visit.Variant)
+	}
+
+	// Record the click for analytics; a failure must not break the resolve
+	if err := c.service.RecordClick(r.Context(), path, visit); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to record click", "code", path, "error", err)
+	}
+
+	// Send mobile browsers to the app of a deep link
+	if entry.AppURL != "" && acceptsHTML(r) {
+		writeDeepLink(w, r, entry.Platform, entry.AppURL, entry.URL)
 		return
 	}
 
@@ -69,17 +188,241 @@ func (c *Controller) GetHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(entry)
 }
 
+// QRHandler handles GET /link/{code}/qr requests. Images only depend on the
+// short code and options, so clients revalidate them with their ETag.
+func (c *Controller) QRHandler(w http.ResponseWriter, r *http.Request) {
+	code := r.PathValue("code")
+	opts, err := parseQROptions(r.URL.Query())
+	if err != nil {
+		writeError(w, r, newError(CodeInvalidInput, "%v", err))
+		return
+	}
+	if opts.Logo && !c.qr.HasLogo() {
+		writeError(w, r, newError(CodeInvalidInput, "No QR logo is configured"))
+		return
+	}
+
+	if _, err := c.service.Get(r.Context(), code); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	etag := c.qr.ETag(code, opts)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	image, contentType, err := c.qr.Render(code, opts)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("failed to render QR code: %w", err))
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(image)))
+	w.Write(image)
+}
+
+// GetRulesHandler handles GET /link/{code}/rules requests
+func (c *Controller) GetRulesHandler(w http.ResponseWriter, r *http.Request) {
+	rules, err := c.service.GetRules(r.Context(), r.PathValue("code"))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RuleSet{Rules: rules})
+}
+
+// PutRulesHandler handles PUT /link/{code}/rules requests, replacing the
+// routing rules of a link
+func (c *Controller) PutRulesHandler(w http.ResponseWriter, r *http.Request) {
+	var body RuleSet
+	if !decodeJSON(w, r, &body, maxBodyBytes) {
+		return
+	}
+
+	rules, err := c.service.SaveRules(r.Context(), r.PathValue("code"), body.Rules)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RuleSet{Rules: rules})
+}
+
+// DryRunRulesHandler handles POST /link/{code}/rules/dry-run and
+// POST /link/{code}/rules/{rule}/dry-run requests, reporting how a synthetic
+// request would be routed
+func (c *Controller) DryRunRulesHandler(w http.ResponseWriter, r *http.Request) {
+	var dry DryRunRequest
+	if !decodeJSON(w, r, &dry, maxBodyBytes) {
+		return
+	}
+
+	result, err := c.service.DryRunRules(r.Context(), r.PathValue("code"), r.PathValue("rule"), dry)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// AppleAppSiteAssociationHandler handles GET
+// /.well-known/apple-app-site-association requests
+func (c *Controller) AppleAppSiteAssociationHandler(w http.ResponseWriter, r *http.Request) {
+	writeAssociation(w, r, c.apps.AppleDocument())
+}
+
+// AssetLinksHandler handles GET /.well-known/assetlinks.json requests
+func (c *Controller) AssetLinksHandler(w http.ResponseWriter, r *http.Request) {
+	writeAssociation(w, r, c.apps.AndroidDocument())
+}
+
+// writeAssociation serves an app association document, or 404 when the
+// platform has no app configured
+func writeAssociation(w http.ResponseWriter, r *http.Request, document any) {
+	if document == nil {
+		writeError(w, r, newError(CodeNotFound, "No app is configured for this platform"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	json.NewEncoder(w).Encode(document)
+}
+
+// CreateWebhookHandler handles POST /webhooks requests. The response carries
+// the signing secret, which is not shown again.
+func (c *Controller) CreateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	var endpoint WebhookEndpoint
+	if !decodeJSON(w, r, &endpoint, maxBodyBytes) {
+		return
+	}
+
+	endpoint, err := c.service.CreateWebhook(r.Context(), endpoint)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(endpoint)
+}
+
+// ListWebhooksHandler handles GET /webhooks?owner= requests
+func (c *Controller) ListWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	endpoints, err := c.service.ListWebhooks(r.Context(), r.URL.Query().Get("owner"))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(endpoints)
+}
+
+// DeleteWebhookHandler handles DELETE /webhooks/{id} requests
+func (c *Controller) DeleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, r, newError(CodeNotFound, "Webhook not found"))
+		return
+	}
+
+	deleted, err := c.service.DeleteWebhook(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if !deleted {
+		writeError(w, r, newError(CodeNotFound, "Webhook not found"))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// WebhookDeliveriesHandler handles GET /webhooks/{id}/deliveries requests,
+// returning the delivery log of an endpoint, optionally filtered by ?status=
+func (c *Controller) WebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, r, newError(CodeNotFound, "Webhook not found"))
+		return
+	}
+	limit, err := parseLimit(r.URL.Query(), defaultDeliveryLimit, maxDeliveryLimit)
+	if err != nil {
+		writeError(w, r, newError(CodeInvalidInput, "%v", err))
+		return
+	}
+
+	deliveries, err := c.service.ListWebhookDeliveries(r.Context(), id, r.URL.Query().Get("status"), limit)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deliveries)
+}
+
+// RetryWebhookDeliveryHandler handles POST
+// /webhooks/{id}/deliveries/{delivery}/retry requests, queueing a delivery
+// again, typically one that was dead-lettered
+func (c *Controller) RetryWebhookDeliveryHandler(w http.ResponseWriter, r *http.Request) {
+	id, idErr := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	deliveryID, deliveryErr := strconv.ParseInt(r.PathValue("delivery"), 10, 64)
+	if idErr != nil || deliveryErr != nil {
+		writeError(w, r, newError(CodeNotFound, "Delivery not found"))
+		return
+	}
+
+	found, err := c.service.RetryWebhookDelivery(r.Context(), id, deliveryID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if !found {
+		writeError(w, r, newError(CodeNotFound, "Delivery not found"))
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// etagMatches reports whether an If-None-Match header matches etag
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
 // StatsHandler handles GET /stats/{id} requests
 func (c *Controller) StatsHandler(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 	if id == "" {
-		http.Error(w, "Missing ID", http.StatusBadRequest)
+		writeError(w, r, newError(CodeInvalidInput, "Missing ID"))
+		return
+	}
+
+	from, to, err := parseDayRange(r.URL.Query(), time.Now())
+	if err != nil {
+		writeError(w, r, newError(CodeInvalidInput, "%v", err))
 		return
 	}
 
-	stats, err := c.service.GetStats(id)
+	stats, err := c.service.GetStats(r.Context(), id, from, to)
 	if err != nil {
-		http.Error(w, "Stats not found", http.StatusNotFound)
+		writeError(w, r, err)
 		return
 	}
 
@@ -88,6 +431,443 @@ func (c *Controller) StatsHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(stats)
 }
 
+// DeviceStatsHandler handles GET /stats/{id}/devices requests
+func (c *Controller) DeviceStatsHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		writeError(w, r, newError(CodeInvalidInput, "Missing ID"))
+		return
+	}
+
+	stats, err := c.service.GetDeviceStats(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// defaultReferrerLimit and maxReferrerLimit bound ?limit= on the referrer stats
+const (
+	defaultReferrerLimit = 10
+	maxReferrerLimit     = 100
+)
+
+// ReferrerStatsHandler handles GET /stats/{id}/referrers requests
+func (c *Controller) ReferrerStatsHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		writeError(w, r, newError(CodeInvalidInput, "Missing ID"))
+		return
+	}
+
+	limit, err := parseLimit(r.URL.Query(), defaultReferrerLimit, maxReferrerLimit)
+	if err != nil {
+		writeError(w, r, newError(CodeInvalidInput, "Invalid limit"))
+		return
+	}
+
+	stats, err := c.service.GetReferrerStats(r.Context(), id, limit)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// parseLimit reads the limit query parameter, between 1 and max
+func parseLimit(values url.Values, def, max int) (int, error) {
+	raw := values.Get("limit")
+	if raw == "" {
+		return def, nil
+	}
+	limit, err := strconv.Atoi(raw)
+	if err != nil || limit < 1 || limit > max {
+		return 0, fmt.Errorf("limit must be between 1 and %d", max)
+	}
+	return limit, nil
+}
+
+// CampaignStatsHandler handles GET /stats/campaigns requests. Links are
+// grouped by campaign, or listed for a single ?campaign=, optionally
+// restricted to one ?owner=.
+func (c *Controller) CampaignStatsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit, err := parseLimit(query, defaultCampaignLimit, maxCampaignLimit)
+	if err != nil {
+		writeError(w, r, newError(CodeInvalidInput, "%v", err))
+		return
+	}
+
+	var stats any
+	if campaign := query.Get("campaign"); campaign != "" {
+		stats, err = c.service.GetCampaignLinks(r.Context(), query.Get("owner"), campaign, limit)
+	} else {
+		stats, err = c.service.GetCampaignStats(r.Context(), query.Get("owner"), limit)
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// ListUTMPresetsHandler handles GET /owners/{owner}/utm-presets requests
+func (c *Controller) ListUTMPresetsHandler(w http.ResponseWriter, r *http.Request) {
+	presets, err := c.service.ListUTMPresets(r.Context(), r.PathValue("owner"))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(presets)
+}
+
+// PutUTMPresetHandler handles PUT /owners/{owner}/utm-presets/{name} requests
+func (c *Controller) PutUTMPresetHandler(w http.ResponseWriter, r *http.Request) {
+	preset := UTMPreset{Owner: r.PathValue("owner"), Name: r.PathValue("name")}
+	if !decodeJSON(w, r, &preset.UTM, maxBodyBytes) {
+		return
+	}
+
+	err := c.service.SaveUTMPreset(r.Context(), preset)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(preset)
+}
+
+// DeleteUTMPresetHandler handles DELETE /owners/{owner}/utm-presets/{name} requests
+func (c *Controller) DeleteUTMPresetHandler(w http.ResponseWriter, r *http.Request) {
+	deleted, err := c.service.DeleteUTMPreset(r.Context(), r.PathValue("owner"), r.PathValue("name"))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if !deleted {
+		writeError(w, r, newError(CodeNotFound, "Preset not found"))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// TimeSeriesHandler handles GET /stats/{id}/timeseries requests
+func (c *Controller) TimeSeriesHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		writeError(w, r, newError(CodeInvalidInput, "Missing ID"))
+		return
+	}
+
+	query, err := parseTimeSeriesQuery(id, r.URL.Query(), time.Now())
+	if err != nil {
+		writeError(w, r, newError(CodeInvalidInput, "%v", err))
+		return
+	}
+
+	stats, err := c.service.GetTimeSeries(r.Context(), query)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// ListLinksHandler handles GET /link requests, returning a page of the links
+// matching the filters and search
+func (c *Controller) ListLinksHandler(w http.ResponseWriter, r *http.Request) {
+	query, err := parseLinkQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, r, newError(CodeInvalidInput, "%v", err))
+		return
+	}
+
+	list, err := c.service.ListLinks(r.Context(), query)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// ExportHandler handles GET /link/export requests, streaming every matching
+// entry as CSV or JSON Lines
+func (c *Controller) ExportHandler(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = FormatJSONL
+	}
+	if !validFormat(format) {
+		writeError(w, r, newError(CodeInvalidInput, "format must be csv or jsonl"))
+		return
+	}
+	filter, err := parseExportFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, r, newError(CodeInvalidInput, "%v", err))
+		return
+	}
+
+	// Large exports outlive the server's write timeout
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		slog.WarnContext(r.Context(), "Failed to clear the write deadline of an export", "error", err)
+	}
+
+	w.Header().Set("Content-Type", formatContentTypes[format])
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="links.%s"`, format))
+	count, err := c.service.ExportLinks(r.Context(), w, format, filter)
+	if err != nil {
+		// Headers are already sent, so the truncated body is all we can signal
+		slog.ErrorContext(r.Context(), "Failed to export links", "exported", count, "error", err)
+	}
+}
+
+// ImportHandler handles POST /link/import requests. The body is CSV or JSON
+// Lines and the response is an ImportReport.
+func (c *Controller) ImportHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	opts := ImportOptions{Format: query.Get("format"), OnConflict: query.Get("on_conflict")}
+	if opts.Format == "" {
+		opts.Format = FormatJSONL
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "text/csv") {
+			opts.Format = FormatCSV
+		}
+	}
+	if !validFormat(opts.Format) {
+		writeError(w, r, newError(CodeInvalidInput, "format must be csv or jsonl"))
+		return
+	}
+	if opts.OnConflict == "" {
+		opts.OnConflict = ConflictSkip
+	}
+	if !validConflictMode(opts.OnConflict) {
+		writeError(w, r, newError(CodeInvalidInput, "on_conflict must be skip, overwrite or fail"))
+		return
+	}
+	if raw := query.Get("start_line"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			writeError(w, r, newError(CodeInvalidInput, "Invalid start_line"))
+			return
+		}
+		opts.StartLine = n
+	}
+
+	// Large imports outlive the server's read and write timeouts
+	rc := http.NewResponseController(w)
+	if err := rc.SetReadDeadline(time.Time{}); err != nil {
+		slog.WarnContext(r.Context(), "Failed to clear the read deadline of an import", "error", err)
+	}
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		slog.WarnContext(r.Context(), "Failed to clear the write deadline of an import", "error", err)
+	}
+
+	report, err := c.service.ImportLinks(r.Context(), r.Body, opts, nil)
+	status := http.StatusOK
+	if err != nil {
+		// The report still tells the client where to resume
+		slog.ErrorContext(r.Context(), "Failed to import links", "last_line", report.LastLine, "error", err)
+		if report.Processed == 0 && report.LastLine == opts.StartLine {
+			writeError(w, r, newError(CodeInvalidInput, "%v", err))
+			return
+		}
+		status = http.StatusInternalServerError
+	} else if report.Aborted {
+		status = http.StatusConflict
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
+
+// GetDetailsHandler handles GET /link/{code}/details requests
+func (c *Controller) GetDetailsHandler(w http.ResponseWriter, r *http.Request) {
+	details, err := c.service.GetDetails(r.Context(), r.PathValue("code"))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(details)
+}
+
+// DeleteLinkHandler handles DELETE /link/{code} requests
+func (c *Controller) DeleteLinkHandler(w http.ResponseWriter, r *http.Request) {
+	if err := c.service.DeleteLink(r.Context(), r.PathValue("code")); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UpdateDetailsHandler handles PATCH /link/{code} requests, changing the
+// title, description or notes of a link
+func (c *Controller) UpdateDetailsHandler(w http.ResponseWriter, r *http.Request) {
+	var update DetailsUpdate
+	if !decodeJSON(w, r, &update, maxBodyBytes) {
+		return
+	}
+
+	details, err := c.service.UpdateDetails(r.Context(), r.PathValue("code"), update)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(details)
+}
+
+// AddTagsHandler handles POST /link/{code}/tags requests
+func (c *Controller) AddTagsHandler(w http.ResponseWriter, r *http.Request) {
+	var body TagsRequest
+	if !decodeJSON(w, r, &body, maxBodyBytes) {
+		return
+	}
+
+	tags, err := c.service.AddTags(r.Context(), r.PathValue("code"), body.Tags)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(TagsRequest{Tags: tags})
+}
+
+// RemoveTagHandler handles DELETE /link/{code}/tags/{tag} requests
+func (c *Controller) RemoveTagHandler(w http.ResponseWriter, r *http.Request) {
+	tags, err := c.service.RemoveTag(r.Context(), r.PathValue("code"), r.PathValue("tag"))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(TagsRequest{Tags: tags})
+}
+
+// MoveLinksHandler handles POST /link/move requests, moving links into a
+// folder or out of their folders
+func (c *Controller) MoveLinksHandler(w http.ResponseWriter, r *http.Request) {
+	var move MoveRequest
+	if !decodeJSON(w, r, &move, maxBodyBytes) {
+		return
+	}
+
+	result, err := c.service.MoveLinks(r.Context(), move.Links, move.FolderID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// CreateFolderHandler handles POST /folders requests
+func (c *Controller) CreateFolderHandler(w http.ResponseWriter, r *http.Request) {
+	var folder Folder
+	if !decodeJSON(w, r, &folder, maxBodyBytes) {
+		return
+	}
+
+	folder, err := c.service.CreateFolder(r.Context(), folder)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(folder)
+}
+
+// ListFoldersHandler handles GET /folders?owner= requests
+func (c *Controller) ListFoldersHandler(w http.ResponseWriter, r *http.Request) {
+	folders, err := c.service.ListFolders(r.Context(), r.URL.Query().Get("owner"))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(folders)
+}
+
+// DeleteFolderHandler handles DELETE /folders/{id} requests
+func (c *Controller) DeleteFolderHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, r, ErrFolderNotFound)
+		return
+	}
+
+	if err := c.service.DeleteFolder(r.Context(), id); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// TagStatsHandler handles GET /stats/tags requests, optionally restricted to
+// one ?owner=
+func (c *Controller) TagStatsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit, err := parseLimit(query, defaultTagStatsLimit, maxTagStatsLimit)
+	if err != nil {
+		writeError(w, r, newError(CodeInvalidInput, "%v", err))
+		return
+	}
+
+	stats, err := c.service.GetTagStats(r.Context(), query.Get("owner"), limit)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// FolderStatsHandler handles GET /stats/folders?owner= requests
+func (c *Controller) FolderStatsHandler(w http.ResponseWriter, r *http.Request) {
+	stats, err := c.service.GetFolderStats(r.Context(), r.URL.Query().Get("owner"))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// OpenAPIHandler handles GET /openapi.json requests
+func (c *Controller) OpenAPIHandler(w http.ResponseWriter, r *http.Request) {
+	document, err := c.openAPI.Document()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(document)
+}
+
 // StatusHandler handles GET /status requests
 func (c *Controller) StatusHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
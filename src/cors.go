@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// CORSConfig describes which cross-origin requests are allowed
+type CORSConfig struct {
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	MaxAge           int
+	AllowCredentials bool
+}
+
+// corsPolicy is the compiled form of a CORSConfig
+type corsPolicy struct {
+	allowAll         bool
+	exact            map[string]struct{}
+	wildcards        []wildcardOrigin
+	methods          string
+	headers          string
+	exposed          string
+	maxAge           string
+	allowCredentials bool
+}
+
+// wildcardOrigin matches any subdomain of suffix for a given scheme, e.g.
+// https://*.example.com
+type wildcardOrigin struct {
+	scheme string
+	suffix string
+}
+
+// newCORSPolicy validates cfg and compiles the origin patterns
+func newCORSPolicy(cfg CORSConfig) (*corsPolicy, error) {
+	p := &corsPolicy{
+		exact:            make(map[string]struct{}),
+		methods:          strings.Join(cfg.AllowedMethods, ", "),
+		headers:          strings.Join(cfg.AllowedHeaders, ", "),
+		exposed:          strings.Join(cfg.ExposedHeaders, ", "),
+		allowCredentials: cfg.AllowCredentials,
+	}
+	if cfg.MaxAge < 0 {
+		return nil, fmt.Errorf("cors max age must not be negative, got %d", cfg.MaxAge)
+	}
+	if cfg.MaxAge > 0 {
+		p.maxAge = strconv.Itoa(cfg.MaxAge)
+	}
+
+	for _, origin := range cfg.AllowedOrigins {
+		origin = strings.ToLower(strings.TrimSpace(origin))
+		switch {
+		case origin == "":
+			continue
+		case origin == "*":
+			p.allowAll = true
+		case strings.Contains(origin, "://*."):
+			scheme, host, _ := strings.Cut(origin, "://*.")
+			if scheme == "" || host == "" || strings.Contains(host, "*") {
+				return nil, fmt.Errorf("invalid cors origin pattern %q", origin)
+			}
+			p.wildcards = append(p.wildcards, wildcardOrigin{scheme: scheme, suffix: "." + host})
+		case strings.Contains(origin, "*"):
+			return nil, fmt.Errorf("invalid cors origin pattern %q: wildcards are only allowed as a leading subdomain", origin)
+		default:
+			p.exact[strings.TrimSuffix(origin, "/")] = struct{}{}
+		}
+	}
+
+	if p.allowAll && p.allowCredentials {
+		return nil, fmt.Errorf("cors credentials cannot be allowed for every origin")
+	}
+	return p, nil
+}
+
+// allows reports whether origin matches the configured origins
+func (p *corsPolicy) allows(origin string) bool {
+	if p.allowAll {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	if _, ok := p.exact[origin]; ok {
+		return true
+	}
+	scheme, host, ok := strings.Cut(origin, "://")
+	if !ok {
+		return false
+	}
+	for _, w := range p.wildcards {
+		if scheme == w.scheme && len(host) > len(w.suffix) && strings.HasSuffix(host, w.suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isPreflight reports whether r is a CORS preflight rather than a plain OPTIONS request
+func isPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions &&
+		r.Header.Get("Origin") != "" &&
+		r.Header.Get("Access-Control-Request-Method") != ""
+}
+
+// CORSMiddleware adds Cross-Origin Resource Sharing headers for allowed origins.
+// The matching origin is echoed back rather than using a blanket wildcard, and
+// only real preflight requests are answered without invoking the next handler.
+func CORSMiddleware(cfg CORSConfig) (func(http.Handler) http.Handler, error) {
+	policy, err := newCORSPolicy(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			h.Add("Vary", "Origin")
+
+			origin := r.Header.Get("Origin")
+			preflight := isPreflight(r)
+			if preflight {
+				h.Add("Vary", "Access-Control-Request-Method")
+				h.Add("Vary", "Access-Control-Request-Headers")
+			}
+
+			if origin == "" || !policy.allows(origin) {
+				if preflight {
+					w.WriteHeader(http.StatusNoContent)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if policy.allowAll && !policy.allowCredentials {
+				h.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				h.Set("Access-Control-Allow-Origin", origin)
+			}
+			if policy.allowCredentials {
+				h.Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			if !preflight {
+				if policy.exposed != "" {
+					h.Set("Access-Control-Expose-Headers", policy.exposed)
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if policy.methods != "" {
+				h.Set("Access-Control-Allow-Methods", policy.methods)
+			}
+			if policy.headers != "" {
+				h.Set("Access-Control-Allow-Headers", policy.headers)
+			}
+			if policy.maxAge != "" {
+				h.Set("Access-Control-Max-Age", policy.maxAge)
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}, nil
+}
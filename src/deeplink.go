@@ -0,0 +1,232 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/mahopon/SmolEarl/useragent"
+)
+
+// ErrInvalidDeepLink is wrapped by every app URL validation failure
+var ErrInvalidDeepLink = newError(CodeInvalidInput, "invalid deep link")
+
+// Platforms served app URLs
+const (
+	platformIOS     = "ios"
+	platformAndroid = "android"
+)
+
+// unsafeAppSchemes are never accepted as app URLs
+var unsafeAppSchemes = []string{"javascript", "data", "vbscript", "file"}
+
+// DeepLink holds the app URLs of a link. The link's destination is the web
+// fallback.
+type DeepLink struct {
+	IOS     string `json:"ios,omitempty"`
+	Android string `json:"android,omitempty"`
+}
+
+// isZero reports whether no app URL is set
+func (d DeepLink) isZero() bool {
+	return d == DeepLink{}
+}
+
+// forPlatform returns the app URL of a platform, if any
+func (d DeepLink) forPlatform(platform string) string {
+	switch platform {
+	case platformIOS:
+		return d.IOS
+	case platformAndroid:
+		return d.Android
+	}
+	return ""
+}
+
+// platformOf maps a parsed user agent to a platform with app URLs
+func platformOf(agent useragent.Agent) string {
+	if agent.Bot {
+		return ""
+	}
+	switch agent.OS {
+	case "iOS":
+		return platformIOS
+	case "Android":
+		return platformAndroid
+	}
+	return ""
+}
+
+// deepLinkFromRequest validates the deepLink field of a create request
+func deepLinkFromRequest(requested *DeepLink, maxLength int) (DeepLink, error) {
+	if requested == nil {
+		return DeepLink{}, nil
+	}
+	link := *requested
+	var err error
+	if link.IOS, err = validateAppURL(link.IOS, maxLength); err != nil {
+		return DeepLink{}, fmt.Errorf("ios: %w", err)
+	}
+	if link.Android, err = validateAppURL(link.Android, maxLength); err != nil {
+		return DeepLink{}, fmt.Errorf("android: %w", err)
+	}
+	if strings.HasPrefix(link.IOS, "intent:") {
+		return DeepLink{}, fmt.Errorf("ios: %w: intent URLs are only supported on Android", ErrInvalidDeepLink)
+	}
+	return link, nil
+}
+
+// validateAppURL checks an app URL: a custom scheme URL, an https universal
+// link or an Android intent URL. Empty URLs are accepted.
+func validateAppURL(raw string, maxLength int) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", nil
+	}
+	if len(raw) > maxLength {
+		return "", fmt.Errorf("%w: longer than %d characters", ErrInvalidDeepLink, maxLength)
+	}
+	if strings.ContainsFunc(raw, func(r rune) bool { return unicode.IsSpace(r) || unicode.IsControl(r) }) {
+		return "", fmt.Errorf("%w: contains whitespace or control characters", ErrInvalidDeepLink)
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidDeepLink, err)
+	}
+	scheme := strings.ToLower(u.Scheme)
+	if scheme == "" {
+		return "", fmt.Errorf("%w: scheme is required", ErrInvalidDeepLink)
+	}
+	if slices.Contains(unsafeAppSchemes, scheme) {
+		return "", fmt.Errorf("%w: scheme %q is not allowed", ErrInvalidDeepLink, scheme)
+	}
+	if scheme == "intent" && (!strings.Contains(u.Fragment, "Intent;") || !strings.HasSuffix(u.Fragment, ";end")) {
+		return "", fmt.Errorf("%w: intent URLs must end in #Intent;...;end", ErrInvalidDeepLink)
+	}
+	if (scheme == "http" || scheme == "https") && u.Host == "" {
+		return "", fmt.Errorf("%w: host is required", ErrInvalidDeepLink)
+	}
+	return raw, nil
+}
+
+// withIntentFallback adds fallback as the browser_fallback_url of an Android
+// intent URL, which Chrome opens when the app is not installed
+func withIntentFallback(intentURL, fallback string) string {
+	if strings.Contains(intentURL, ";S.browser_fallback_url=") || fallback == "" {
+		return intentURL
+	}
+	base, ok := strings.CutSuffix(intentURL, ";end")
+	if !ok {
+		return intentURL
+	}
+	return base + ";S.browser_fallback_url=" + url.QueryEscape(fallback) + ";end"
+}
+
+// deepLinkBridgeTemplate tries to open the app and falls back to the web
+// destination when the page is still visible shortly after
+var deepLinkBridgeTemplate = template.Must(template.New("bridge").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>Opening…</title>
+<style>
+body { font-family: system-ui, sans-serif; max-width: 36rem; margin: 4rem auto; padding: 0 1rem; color: #222; text-align: center; }
+a { display: block; margin: 1rem 0; }
+</style>
+</head>
+<body>
+<p>Opening the app…</p>
+<a href="{{.AppURL}}">Open in the app</a>
+<a href="{{.Fallback}}">Continue to the website</a>
+<script>
+(function () {
+  var fallback = setTimeout(function () { window.location.replace({{.Fallback}}); }, 1500);
+  document.addEventListener("visibilitychange", function () {
+    if (document.hidden) { clearTimeout(fallback); }
+  });
+  window.location.href = {{.AppURL}};
+})();
+</script>
+</body>
+</html>
+`))
+
+// writeDeepLink sends a mobile browser to the app URL of a link. Android
+// intent URLs carry their own fallback and are redirected to directly; other
+// app URLs get a bridge page that falls back to the web destination.
+func writeDeepLink(w http.ResponseWriter, r *http.Request, platform, appURL, fallback string) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Add("Vary", "User-Agent")
+	if platform == platformAndroid && strings.HasPrefix(appURL, "intent:") {
+		http.Redirect(w, r, withIntentFallback(appURL, fallback), http.StatusFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	deepLinkBridgeTemplate.Execute(w, struct {
+		AppURL   template.URL
+		Fallback string
+	}{template.URL(appURL), fallback})
+}
+
+// AppAssociation publishes the apps allowed to open short links directly,
+// as apple-app-site-association and assetlinks.json documents
+type AppAssociation struct {
+	linkPath                string
+	iosAppIDs               []string
+	androidPackage          string
+	androidCertFingerprints []string
+}
+
+// NewAppAssociation creates an AppAssociation for links under publicBaseURL
+func NewAppAssociation(publicBaseURL string, iosAppIDs []string, androidPackage string, androidCertFingerprints []string) *AppAssociation {
+	linkPath := "/"
+	if base, err := url.Parse(publicBaseURL); err == nil && base.Path != "" {
+		linkPath = base.Path
+	}
+	return &AppAssociation{
+		linkPath:                linkPath,
+		iosAppIDs:               iosAppIDs,
+		androidPackage:          androidPackage,
+		androidCertFingerprints: androidCertFingerprints,
+	}
+}
+
+// AppleDocument returns the apple-app-site-association document, or nil
+// when no iOS app is configured
+func (a *AppAssociation) AppleDocument() any {
+	if a == nil || len(a.iosAppIDs) == 0 {
+		return nil
+	}
+	return map[string]any{
+		"applinks": map[string]any{
+			"apps": []string{},
+			"details": []map[string]any{{
+				"appIDs":     a.iosAppIDs,
+				"components": []map[string]string{{"/": path.Join(a.linkPath, "*")}},
+			}},
+		},
+	}
+}
+
+// AndroidDocument returns the assetlinks.json document, or nil when no
+// Android app is configured
+func (a *AppAssociation) AndroidDocument() any {
+	if a == nil || a.androidPackage == "" {
+		return nil
+	}
+	return []map[string]any{{
+		"relation": []string{"delegate_permission/common.handle_all_urls"},
+		"target": map[string]any{
+			"namespace":                "android_app",
+			"package_name":             a.androidPackage,
+			"sha256_cert_fingerprints": a.androidCertFingerprints,
+		},
+	}}
+}
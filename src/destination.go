@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/mahopon/SmolEarl/config"
+	"github.com/mahopon/SmolEarl/screening"
+	"golang.org/x/net/idna"
+)
+
+var (
+	// ErrInvalidURL is wrapped by every destination validation failure
+	ErrInvalidURL = newError(CodeInvalidInput, "invalid url")
+	// ErrBlockedURL is returned when a new destination is flagged by screening
+	ErrBlockedURL = newError(CodeForbidden, "destination is blocked")
+	// ErrLinkDisabled is returned when an existing link's destination has
+	// been flagged since it was created
+	ErrLinkDisabled = newError(CodeForbidden, "link is disabled")
+)
+
+// Stages at which destinations are screened, as reported in metrics
+const (
+	screenStageCreate  = "create"
+	screenStageImport  = "import"
+	screenStageResolve = "resolve"
+)
+
+// defaultPorts are dropped from normalized URLs
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// DestinationValidator checks and normalizes the destination URLs of links
+type DestinationValidator struct {
+	schemes   []string
+	maxLength int
+	selfHosts map[string]bool
+}
+
+// NewDestinationValidator creates a DestinationValidator. Destinations on
+// selfHosts are rejected since they would redirect back to this service.
+func NewDestinationValidator(schemes []string, maxLength int, selfHosts []string) *DestinationValidator {
+	v := &DestinationValidator{maxLength: maxLength, selfHosts: make(map[string]bool)}
+	for _, scheme := range schemes {
+		v.schemes = append(v.schemes, strings.ToLower(strings.TrimSpace(scheme)))
+	}
+	for _, host := range selfHosts {
+		if normalized, err := normalizeHost(host); err == nil {
+			v.selfHosts[normalized] = true
+		}
+	}
+	return v
+}
+
+// newDestinationValidator creates the DestinationValidator described by cfg
+func newDestinationValidator(cfg *config.Config) *DestinationValidator {
+	selfHosts := slices.Clone(cfg.SelfHosts)
+	if base, err := url.Parse(cfg.PublicBaseURL); err == nil {
+		selfHosts = append(selfHosts, base.Hostname())
+	}
+	return NewDestinationValidator(cfg.URLAllowedSchemes, cfg.URLMaxLength, selfHosts)
+}
+
+// defaultDestinationValidator is used until a configured one is set
+func defaultDestinationValidator() *DestinationValidator {
+	return NewDestinationValidator([]string{"http", "https"}, 2048, nil)
+}
+
+// Normalize validates raw and returns its canonical form: lowercase scheme
+// and host, punycode host, no default port, a non-empty path and query
+// parameters sorted by name
+func (v *DestinationValidator) Normalize(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", fmt.Errorf("%w: url is required", ErrInvalidURL)
+	}
+	if len(raw) > v.maxLength {
+		return "", fmt.Errorf("%w: longer than %d characters", ErrInvalidURL, v.maxLength)
+	}
+	if i := strings.IndexFunc(raw, func(r rune) bool { return unicode.IsSpace(r) || unicode.IsControl(r) }); i >= 0 {
+		return "", fmt.Errorf("%w: contains whitespace or control characters", ErrInvalidURL)
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidURL, err)
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme == "" {
+		return "", fmt.Errorf("%w: scheme is required", ErrInvalidURL)
+	}
+	if !slices.Contains(v.schemes, u.Scheme) {
+		return "", fmt.Errorf("%w: scheme %q is not allowed", ErrInvalidURL, u.Scheme)
+	}
+	if u.Opaque != "" || u.Host == "" {
+		return "", fmt.Errorf("%w: host is required", ErrInvalidURL)
+	}
+	if u.User != nil {
+		return "", fmt.Errorf("%w: credentials are not allowed", ErrInvalidURL)
+	}
+
+	host, err := normalizeHost(u.Hostname())
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidURL, err)
+	}
+	if v.selfHosts[host] {
+		return "", fmt.Errorf("%w: links to %s would redirect back to this service", ErrInvalidURL, host)
+	}
+
+	port := u.Port()
+	if port != "" {
+		n, err := strconv.Atoi(port)
+		if err != nil || n < 1 || n > 65535 {
+			return "", fmt.Errorf("%w: invalid port %q", ErrInvalidURL, port)
+		}
+		port = strconv.Itoa(n)
+		if defaultPorts[u.Scheme] == port {
+			port = ""
+		}
+	}
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port != "" {
+		host += ":" + port
+	}
+	u.Host = host
+
+	if u.Path == "" {
+		u.Path, u.RawPath = "/", ""
+	}
+	u.RawQuery = sortQuery(u.RawQuery)
+	u.ForceQuery = false
+
+	normalized := u.String()
+	if len(normalized) > v.maxLength {
+		return "", fmt.Errorf("%w: longer than %d characters", ErrInvalidURL, v.maxLength)
+	}
+	return normalized, nil
+}
+
+// normalizeHost lowercases a host name and converts internationalized names
+// to punycode. IP addresses are returned in their canonical form.
+func normalizeHost(host string) (string, error) {
+	host = strings.TrimSuffix(strings.TrimSpace(host), ".")
+	if host == "" {
+		return "", errors.New("host is required")
+	}
+	if ip := net.ParseIP(strings.Trim(host, "[]")); ip != nil {
+		return ip.String(), nil
+	}
+	ascii, err := idna.Lookup.ToASCII(host)
+	if err != nil {
+		return "", fmt.Errorf("invalid host %q: %v", host, err)
+	}
+	if len(ascii) > 253 {
+		return "", fmt.Errorf("invalid host %q: longer than 253 characters", host)
+	}
+	for _, label := range strings.Split(ascii, ".") {
+		if label == "" || len(label) > 63 {
+			return "", fmt.Errorf("invalid host %q: labels must be 1 to 63 characters", host)
+		}
+	}
+	return strings.ToLower(ascii), nil
+}
+
+// sortQuery orders query parameters by name, keeping the original encoding
+// and the relative order of repeated names
+func sortQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	var params []string
+	for _, param := range strings.Split(rawQuery, "&") {
+		if param != "" {
+			params = append(params, param)
+		}
+	}
+	slices.SortStableFunc(params, func(a, b string) int {
+		nameA, _, _ := strings.Cut(a, "=")
+		nameB, _, _ := strings.Cut(b, "=")
+		return strings.Compare(nameA, nameB)
+	})
+	return strings.Join(params, "&")
+}
+
+// screen checks destination against the screening lists, if configured, and
+// counts and logs every hit
+func (s *Service) screen(ctx context.Context, stage, destination string) (screening.Verdict, bool) {
+	if s.screener == nil || destination == "" {
+		return screening.Verdict{}, false
+	}
+	verdict, blocked := s.screener.Check(destination)
+	if !blocked {
+		return verdict, false
+	}
+	if s.screeningMetrics != nil {
+		s.screeningMetrics.Hits.WithLabelValues(stage, verdict.List).Inc()
+	}
+	slog.WarnContext(ctx, "Destination flagged by URL screening",
+		"stage", stage, "list", verdict.List, "rule", verdict.Rule, "url", destination)
+	return verdict, true
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/mahopon/SmolEarl/infra/redis"
+)
+
+// ErrorCode classifies errors for API clients
+type ErrorCode string
+
+// Error codes. Requests are not rate limited yet, so CodeRateLimited is
+// reserved.
+const (
+	CodeNotFound     ErrorCode = "not_found"
+	CodeConflict     ErrorCode = "conflict"
+	CodeInvalidInput ErrorCode = "invalid_input"
+	CodeForbidden    ErrorCode = "forbidden"
+	CodeTooLarge     ErrorCode = "too_large"
+	CodeExpired      ErrorCode = "expired"
+	CodeRateLimited  ErrorCode = "rate_limited"
+	CodeUnavailable  ErrorCode = "unavailable"
+	CodeInternal     ErrorCode = "internal"
+)
+
+// errorStatus maps error codes to HTTP status codes
+var errorStatus = map[ErrorCode]int{
+	CodeNotFound:     http.StatusNotFound,
+	CodeConflict:     http.StatusConflict,
+	CodeInvalidInput: http.StatusBadRequest,
+	CodeForbidden:    http.StatusForbidden,
+	CodeTooLarge:     http.StatusRequestEntityTooLarge,
+	CodeExpired:      http.StatusGone,
+	CodeRateLimited:  http.StatusTooManyRequests,
+	CodeUnavailable:  http.StatusServiceUnavailable,
+	CodeInternal:     http.StatusInternalServerError,
+}
+
+// Error is a service error whose message is safe to show to clients. It is
+// usually wrapped with more detail, e.g. fmt.Errorf("%w: ...", ErrInvalidURL).
+type Error struct {
+	Code    ErrorCode
+	Message string
+}
+
+// newError creates an Error with a formatted message
+func newError(code ErrorCode, format string, args ...any) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// errorCode classifies err. Untyped errors are internal unless they come
+// from an unreachable or overloaded backing store.
+func errorCode(err error) ErrorCode {
+	var typed *Error
+	if errors.As(err, &typed) {
+		return typed.Code
+	}
+	if unavailable(err) {
+		return CodeUnavailable
+	}
+	return CodeInternal
+}
+
+// unavailable reports whether err is a connection failure or timeout of
+// PostgreSQL or Redis rather than a bug. Failures of outgoing HTTP requests,
+// such as webhook deliveries, are not.
+func unavailable(err error) bool {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return false
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgUnavailable(pgErr.Code)
+	}
+	if errors.Is(err, context.DeadlineExceeded) || pgconn.Timeout(err) || errors.Is(err, redis.ErrUnavailable) {
+		return true
+	}
+	// Failing to connect to PostgreSQL; Redis marks its own
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// pgUnavailable reports whether a SQLSTATE means the server cannot serve
+// requests for now: connection exceptions, insufficient resources and
+// shutdowns
+func pgUnavailable(sqlState string) bool {
+	switch {
+	case strings.HasPrefix(sqlState, "08"), strings.HasPrefix(sqlState, "53"):
+		return true
+	case sqlState == "57P01", sqlState == "57P02", sqlState == "57P03":
+		return true
+	}
+	return false
+}
+
+// Problem is an RFC 7807 problem details body
+type Problem struct {
+	Type      string    `json:"type"`
+	Title     string    `json:"title"`
+	Status    int       `json:"status"`
+	Detail    string    `json:"detail,omitempty"`
+	Instance  string    `json:"instance,omitempty"`
+	Code      ErrorCode `json:"code"`
+	RequestID string    `json:"request_id,omitempty"`
+}
+
+// publicError reports whether the message of err may be shown to clients,
+// which is the case when it wraps an Error
+func publicError(err error) bool {
+	var typed *Error
+	return errors.As(err, &typed)
+}
+
+// writeError answers r with the problem details of err. Untyped errors are
+// logged and their details kept from the client.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	code := errorCode(err)
+	status := errorStatus[code]
+	detail := err.Error()
+	if !publicError(err) {
+		slog.ErrorContext(r.Context(), "Request failed", "code", code, "error", err)
+		detail = http.StatusText(status)
+	}
+	if code == CodeUnavailable {
+		w.Header().Set("Retry-After", "5")
+	}
+
+	// Routers below a prefix see a stripped path
+	instance := r.URL.Path
+	if u, err := url.ParseRequestURI(r.RequestURI); err == nil {
+		instance = u.Path
+	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    detail,
+		Instance:  instance,
+		Code:      code,
+		RequestID: RequestIDFromContext(r.Context()),
+	})
+}
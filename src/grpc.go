@@ -0,0 +1,508 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/mahopon/SmolEarl/infra/logging"
+	infra_prom "github.com/mahopon/SmolEarl/infra/prometheus"
+	smolearlv1 "github.com/mahopon/SmolEarl/proto/smolearl/v1"
+)
+
+// grpcRequestIDKey is the metadata key carrying the request correlation ID
+const grpcRequestIDKey = "x-request-id"
+
+// GRPCOptions configures the gRPC API
+type GRPCOptions struct {
+	// Tokens are the accepted bearer tokens; calls are not authenticated
+	// when empty
+	Tokens []string
+	// DefaultDeadline applies to unary calls made without a deadline
+	DefaultDeadline time.Duration
+	// BulkMaxItems caps the items of one BatchCreate call
+	BulkMaxItems int
+}
+
+// linkService implements the LinkService on top of Service
+type linkService struct {
+	smolearlv1.UnimplementedLinkServiceServer
+	service      *Service
+	bulkMaxItems int
+	// closing is closed on shutdown to end click streams
+	closing <-chan struct{}
+}
+
+// GRPCServer serves the LinkService
+type GRPCServer struct {
+	server  *grpc.Server
+	closing chan struct{}
+}
+
+// NewGRPCServer creates a gRPC server for the LinkService. Calls are
+// measured, logged with a request ID, authenticated and, for unary calls,
+// bounded by a deadline, in that order.
+func NewGRPCServer(service *Service, opts GRPCOptions, metrics *infra_prom.GRPCMetrics) *GRPCServer {
+	middlewares := []grpcMiddleware{grpcMetrics(metrics), grpcLogging, grpcAuth(opts.Tokens)}
+
+	var unary []grpc.UnaryServerInterceptor
+	var stream []grpc.StreamServerInterceptor
+	for _, m := range middlewares {
+		unary = append(unary, unaryInterceptor(m))
+		stream = append(stream, streamInterceptor(m))
+	}
+	unary = append(unary, unaryInterceptor(grpcDeadline(opts.DefaultDeadline)))
+
+	s := &GRPCServer{
+		server:  grpc.NewServer(grpc.ChainUnaryInterceptor(unary...), grpc.ChainStreamInterceptor(stream...)),
+		closing: make(chan struct{}),
+	}
+	smolearlv1.RegisterLinkServiceServer(s.server, &linkService{
+		service:      service,
+		bulkMaxItems: opts.BulkMaxItems,
+		closing:      s.closing,
+	})
+	return s
+}
+
+// Serve accepts connections on lis until Shutdown
+func (s *GRPCServer) Serve(lis net.Listener) error {
+	return s.server.Serve(lis)
+}
+
+// Shutdown ends click streams and waits for other calls to finish. Calls
+// still running when ctx is done are cancelled.
+func (s *GRPCServer) Shutdown(ctx context.Context) error {
+	close(s.closing)
+	stopped := make(chan struct{})
+	go func() {
+		s.server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		s.server.Stop()
+		return ctx.Err()
+	}
+}
+
+// grpcMiddleware wraps a call to method, the way HTTP middlewares wrap
+// handlers, so the same code serves unary and streaming calls
+type grpcMiddleware func(ctx context.Context, method string, next func(context.Context) error) error
+
+// unaryInterceptor adapts m to unary calls
+func unaryInterceptor(m grpcMiddleware) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		var resp any
+		err := m(ctx, info.FullMethod, func(ctx context.Context) error {
+			var err error
+			resp, err = handler(ctx, req)
+			return err
+		})
+		return resp, err
+	}
+}
+
+// streamInterceptor adapts m to streaming calls
+func streamInterceptor(m grpcMiddleware) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return m(ss.Context(), info.FullMethod, func(ctx context.Context) error {
+			return handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+		})
+	}
+}
+
+// contextStream replaces the context of a server stream
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
+
+// grpcMetrics counts calls by method and status code and records their
+// duration
+func grpcMetrics(metrics *infra_prom.GRPCMetrics) grpcMiddleware {
+	return func(ctx context.Context, method string, next func(context.Context) error) error {
+		start := time.Now()
+		err := next(ctx)
+		if metrics != nil {
+			name := path.Base(method)
+			metrics.Requests.WithLabelValues(name, status.Code(err).String()).Inc()
+			metrics.Latency.WithLabelValues(name).Observe(time.Since(start).Seconds())
+		}
+		return err
+	}
+}
+
+// grpcLogging reuses the x-request-id metadata when it is valid, generates
+// one otherwise and logs the outcome of the call like LoggingMiddleware
+func grpcLogging(ctx context.Context, method string, next func(context.Context) error) error {
+	start := time.Now()
+
+	var id string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(grpcRequestIDKey); len(values) > 0 {
+			id = values[0]
+		}
+	}
+	if !validRequestID(id) {
+		generated, err := generateNonce(ctx)
+		if err != nil {
+			generated = strconv.FormatInt(time.Now().UnixNano(), 36)
+		}
+		id = generated
+	}
+	grpc.SetHeader(ctx, metadata.Pairs(grpcRequestIDKey, id))
+	ctx = context.WithValue(ctx, requestIDKey{}, id)
+	ctx = logging.WithAttrs(ctx, slog.String("request_id", id))
+
+	err := next(ctx)
+
+	code := status.Code(err)
+	logAttrs := []any{
+		slog.String("method", method),
+		slog.String("code", code.String()),
+		slog.Duration("duration", time.Since(start)),
+	}
+	switch code {
+	case codes.OK:
+		slog.DebugContext(ctx, "gRPC call completed successfully", logAttrs...)
+	case codes.Internal, codes.Unknown, codes.Unavailable, codes.DataLoss, codes.Unimplemented:
+		slog.ErrorContext(ctx, "gRPC call completed with server error", logAttrs...)
+	default:
+		slog.WarnContext(ctx, "gRPC call completed with client error", logAttrs...)
+	}
+	return err
+}
+
+// grpcAuth requires one of tokens as a bearer token in the authorization
+// metadata. Every call is accepted when no tokens are configured.
+func grpcAuth(tokens []string) grpcMiddleware {
+	return func(ctx context.Context, method string, next func(context.Context) error) error {
+		if len(tokens) == 0 {
+			return next(ctx)
+		}
+		md, _ := metadata.FromIncomingContext(ctx)
+		for _, value := range md.Get("authorization") {
+			scheme, token, ok := strings.Cut(value, " ")
+			if !ok || !strings.EqualFold(scheme, "bearer") {
+				continue
+			}
+			for _, accepted := range tokens {
+				if subtle.ConstantTimeCompare([]byte(token), []byte(accepted)) == 1 {
+					return next(ctx)
+				}
+			}
+		}
+		return status.Error(codes.Unauthenticated, "a valid bearer token is required")
+	}
+}
+
+// grpcDeadline bounds calls made without a deadline by d
+func grpcDeadline(d time.Duration) grpcMiddleware {
+	return func(ctx context.Context, method string, next func(context.Context) error) error {
+		if _, ok := ctx.Deadline(); !ok && d > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, d)
+			defer cancel()
+		}
+		return next(ctx)
+	}
+}
+
+// grpcCodes maps service error codes to gRPC status codes
+var grpcCodes = map[ErrorCode]codes.Code{
+	CodeNotFound:     codes.NotFound,
+	CodeConflict:     codes.AlreadyExists,
+	CodeInvalidInput: codes.InvalidArgument,
+	CodeForbidden:    codes.PermissionDenied,
+	CodeTooLarge:     codes.ResourceExhausted,
+	CodeExpired:      codes.FailedPrecondition,
+	CodeRateLimited:  codes.ResourceExhausted,
+	CodeUnavailable:  codes.Unavailable,
+	CodeInternal:     codes.Internal,
+}
+
+// grpcError maps service errors to gRPC status errors like writeError does
+// for HTTP. Untyped errors are logged and reported without their details.
+func grpcError(ctx context.Context, err error) error {
+	switch {
+	case errors.Is(err, ErrLinkDisabled):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	}
+	code := errorCode(err)
+	if !publicError(err) {
+		slog.ErrorContext(ctx, "gRPC call failed", "code", code, "error", err)
+		return status.Error(grpcCodes[code], string(code))
+	}
+	return status.Error(grpcCodes[code], err.Error())
+}
+
+// CreateLink implements LinkService.CreateLink
+func (g *linkService) CreateLink(ctx context.Context, req *smolearlv1.CreateLinkRequest) (*smolearlv1.CreateLinkResponse, error) {
+	create := CreateRequest{
+		URL:         req.GetUrl(),
+		CustomAlias: req.GetCustomAlias(),
+		Owner:       req.GetOwner(),
+		Sticky:      req.GetSticky(),
+		UTMPreset:   req.GetUtmPreset(),
+		Dedupe:      req.Dedupe,
+	}
+	for _, d := range req.GetDestinations() {
+		destination := DestinationRequest{Name: d.GetVariant(), URL: d.GetUrl()}
+		if d.GetWeight() != 0 {
+			weight := int(d.GetWeight())
+			destination.Weight = &weight
+		}
+		create.Destinations = append(create.Destinations, destination)
+	}
+	if d := req.GetDeepLink(); d != nil {
+		create.DeepLink = &DeepLink{IOS: d.GetIos(), Android: d.GetAndroid()}
+	}
+	if u := req.GetUtm(); u != nil {
+		create.UTM = &UTM{Source: u.GetSource(), Medium: u.GetMedium(), Campaign: u.GetCampaign(), Term: u.GetTerm(), Content: u.GetContent()}
+	}
+
+	code, existing, err := g.service.Create(ctx, create)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return &smolearlv1.CreateLinkResponse{ShortCode: code, Existing: existing}, nil
+}
+
+// GetLink implements LinkService.GetLink
+func (g *linkService) GetLink(ctx context.Context, req *smolearlv1.GetLinkRequest) (*smolearlv1.Link, error) {
+	if req.GetShortCode() == "" {
+		return nil, status.Error(codes.InvalidArgument, "short_code is required")
+	}
+	entry, err := g.service.Get(ctx, req.GetShortCode())
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+
+	link := &smolearlv1.Link{
+		ShortCode: req.GetShortCode(),
+		Url:       entry.URL,
+		Clicks:    entry.Clicks,
+		CreatedAt: timestamppb.New(entry.CreatedAt),
+		Sticky:    entry.Sticky,
+	}
+	for _, v := range entry.Destinations {
+		link.Destinations = append(link.Destinations, &smolearlv1.Destination{Variant: v.Name, Url: v.URL, Weight: int32(v.Weight)})
+	}
+	if entry.DeepLink != nil {
+		link.DeepLink = &smolearlv1.DeepLink{Ios: entry.DeepLink.IOS, Android: entry.DeepLink.Android}
+	}
+	return link, nil
+}
+
+// ResolveLink implements LinkService.ResolveLink
+func (g *linkService) ResolveLink(ctx context.Context, req *smolearlv1.ResolveLinkRequest) (*smolearlv1.ResolveLinkResponse, error) {
+	code := req.GetShortCode()
+	if code == "" {
+		return nil, status.Error(codes.InvalidArgument, "short_code is required")
+	}
+	visit := Visit{
+		UserAgent:      req.GetUserAgent(),
+		Referer:        req.GetReferer(),
+		AcceptLanguage: req.GetAcceptLanguage(),
+		Query:          url.Values{},
+		At:             time.Now().UTC(),
+		Variant:        req.GetVariant(),
+	}
+	if raw := req.GetClientIp(); raw != "" {
+		ip, err := netip.ParseAddr(raw)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid client_ip %q", raw)
+		}
+		visit.IP = ip.Unmap()
+	}
+	for key, value := range req.GetQuery() {
+		visit.Query.Set(key, value)
+	}
+
+	entry, err := g.service.Resolve(ctx, code, visit)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	resp := &smolearlv1.ResolveLinkResponse{
+		ShortCode: code,
+		Url:       entry.URL,
+		Variant:   entry.Variant,
+		Rule:      entry.Rule,
+		Platform:  entry.Platform,
+		AppUrl:    entry.AppURL,
+	}
+
+	if req.GetRecordClick() {
+		visit.Variant = resp.Variant
+		if err := g.service.RecordClick(ctx, code, visit); err != nil {
+			slog.ErrorContext(ctx, "Failed to record click", "code", code, "error", err)
+		}
+	}
+	return resp, nil
+}
+
+// GetStats implements LinkService.GetStats
+func (g *linkService) GetStats(ctx context.Context, req *smolearlv1.GetStatsRequest) (*smolearlv1.Stats, error) {
+	if req.GetShortCode() == "" {
+		return nil, status.Error(codes.InvalidArgument, "short_code is required")
+	}
+	values := url.Values{}
+	if req.GetFrom() != nil {
+		values.Set("from", req.GetFrom().AsTime().UTC().Format(time.DateOnly))
+	}
+	if req.GetTo() != nil {
+		values.Set("to", req.GetTo().AsTime().UTC().Format(time.DateOnly))
+	}
+	from, to, err := parseDayRange(values, time.Now())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	result, err := g.service.GetStats(ctx, req.GetShortCode(), from, to)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+
+	stats := &smolearlv1.Stats{
+		ShortCode: req.GetShortCode(),
+		Clicks:    int64(result.Clicks),
+		CreatedAt: timestamppb.New(result.CreatedAt),
+	}
+	for _, c := range result.Countries {
+		stats.Countries = append(stats.Countries, &smolearlv1.Count{Name: c.Country, Clicks: int64(c.Clicks)})
+	}
+	for _, c := range result.Channels {
+		stats.Channels = append(stats.Channels, &smolearlv1.Count{Name: c.Name, Clicks: int64(c.Clicks)})
+	}
+	for _, v := range result.Variants {
+		stats.Variants = append(stats.Variants, &smolearlv1.VariantStats{
+			Variant: v.Variant, Url: v.URL, Weight: int32(v.Weight), Clicks: int64(v.Clicks),
+		})
+	}
+	if visitors := result.UniqueVisitors; visitors != nil {
+		stats.UniqueVisitors = visitors.Total
+		for _, d := range visitors.Daily {
+			stats.DailyVisitors = append(stats.DailyVisitors, &smolearlv1.DailyVisitors{Day: d.Day, Visitors: d.Visitors})
+		}
+	}
+	return stats, nil
+}
+
+// BatchCreate implements LinkService.BatchCreate
+func (g *linkService) BatchCreate(ctx context.Context, req *smolearlv1.BatchCreateRequest) (*smolearlv1.BatchCreateResponse, error) {
+	if len(req.GetItems()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "no items")
+	}
+	if len(req.GetItems()) > g.bulkMaxItems {
+		return nil, status.Errorf(codes.InvalidArgument, "too many items, at most %d are allowed", g.bulkMaxItems)
+	}
+
+	items := make([]BulkItem, len(req.GetItems()))
+	for i, item := range req.GetItems() {
+		items[i] = BulkItem{URL: item.GetUrl(), CustomAlias: item.GetCustomAlias(), Owner: item.GetOwner()}
+		if item.GetMetadata() != nil {
+			items[i].Metadata = item.GetMetadata().AsMap()
+		}
+	}
+
+	resp := &smolearlv1.BatchCreateResponse{}
+	for _, res := range g.service.CreateBulk(ctx, items) {
+		if res.Error == "" {
+			resp.Created++
+		} else {
+			resp.Failed++
+		}
+		resp.Results = append(resp.Results, &smolearlv1.BatchResult{
+			Index: int32(res.Index), Url: res.URL, ShortCode: res.ID, Error: res.Error,
+		})
+	}
+	return resp, nil
+}
+
+// StreamClicks implements LinkService.StreamClicks
+func (g *linkService) StreamClicks(req *smolearlv1.StreamClicksRequest, stream grpc.ServerStreamingServer[smolearlv1.ClickEvent]) error {
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+	go func() {
+		select {
+		case <-g.closing:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	clicks, err := g.service.SubscribeClicks(ctx)
+	if err != nil {
+		return grpcError(ctx, err)
+	}
+
+	wanted := make(map[string]bool, len(req.GetShortCodes()))
+	for _, code := range req.GetShortCodes() {
+		wanted[code] = true
+	}
+	for click := range clicks {
+		if len(wanted) > 0 && !wanted[click.ShortCode] {
+			continue
+		}
+		if err := stream.Send(clickEventOf(click)); err != nil {
+			return err
+		}
+	}
+	select {
+	case <-g.closing:
+		return status.Error(codes.Unavailable, "server is shutting down")
+	default:
+	}
+	if err := stream.Context().Err(); err != nil {
+		return grpcError(ctx, err)
+	}
+	return grpcError(ctx, fmt.Errorf("click subscription ended"))
+}
+
+// clickEventOf converts a recorded click to its gRPC message
+func clickEventOf(click Click) *smolearlv1.ClickEvent {
+	return &smolearlv1.ClickEvent{
+		ShortCode:      click.ShortCode,
+		OccurredAt:     timestamppb.New(click.OccurredAt),
+		Country:        click.Country,
+		Region:         click.Region,
+		City:           click.City,
+		Browser:        click.Browser,
+		Os:             click.OS,
+		Device:         click.Device,
+		Bot:            click.Bot,
+		ReferrerDomain: click.ReferrerDomain,
+		Channel:        click.Channel,
+		Utm: &smolearlv1.UTM{
+			Source: click.UTM.Source, Medium: click.UTM.Medium, Campaign: click.UTM.Campaign,
+			Term: click.UTM.Term, Content: click.UTM.Content,
+		},
+		Variant: click.Variant,
+	}
+}
@@ -3,6 +3,10 @@ package db
 import (
 	"context"
 	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"sync/atomic"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
@@ -11,43 +15,80 @@ import (
 	config "github.com/mahopon/SmolEarl/config"
 )
 
-// PostgresPool holds the PostgreSQL connection pool
-var (
-	AppConfig = config.AppConfig
-)
-
+// DB holds the PostgreSQL connection pool. The pool is swapped atomically when
+// credentials rotate, so callers should fetch it through Pool on every use.
 type DB struct {
-	PostgresPool *pgxpool.Pool
+	pool atomic.Pointer[pgxpool.Pool]
 }
 
 // InitPostgres initializes the PostgreSQL connection pool
-func InitPostgres() (*DB, error) {
-	connStr := fmt.Sprintf(
-		"postgres://%s:%s@%s:%s/%s?sslmode=disable",
-		AppConfig.DBUser,
-		AppConfig.DBPassword,
-		AppConfig.DBHost,
-		AppConfig.DBPort,
-		AppConfig.DBName,
-	)
-
-	pool, err := pgxpool.New(context.Background(), connStr)
+func InitPostgres(cfg *config.Config) (*DB, error) {
+	pool, err := newPool(context.Background(), cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	db := &DB{}
+	db.pool.Store(pool)
+	return db, nil
+}
+
+// Pool returns the current connection pool
+func (db *DB) Pool() *pgxpool.Pool {
+	return db.pool.Load()
+}
+
+// Rebuild connects a new pool with cfg, for example after the password
+// rotated, and swaps it in. The old pool is closed once its in-flight queries
+// return.
+func (db *DB) Rebuild(ctx context.Context, cfg *config.Config) error {
+	pool, err := newPool(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	if old := db.pool.Swap(pool); old != nil {
+		go old.Close()
+	}
+	return nil
+}
+
+// newPool creates and pings a connection pool
+func newPool(ctx context.Context, cfg *config.Config) (*pgxpool.Pool, error) {
+	connURL := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(cfg.DBUser, cfg.DBPassword),
+		Host:     net.JoinHostPort(cfg.DBHost, strconv.Itoa(cfg.DBPort)),
+		Path:     "/" + cfg.DBName,
+		RawQuery: url.Values{"sslmode": {cfg.DBSSLMode}}.Encode(),
+	}
+
+	poolConfig, err := pgxpool.ParseConfig(connURL.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid connection settings: %w", err)
+	}
+	if cfg.DBMaxConns > 0 {
+		poolConfig.MaxConns = int32(cfg.DBMaxConns)
+	}
+
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create connection pool: %w", err)
 	}
 
 	// Test connection
-	if err := pool.Ping(context.Background()); err != nil {
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
 		return nil, fmt.Errorf("failed to connect to PostgreSQL: %w", err)
 	}
 
-	return &DB{PostgresPool: pool}, nil
+	return pool, nil
 }
 
 // ClosePostgres closes the PostgreSQL connection pool
 func (db *DB) ClosePostgres() error {
-	if db.PostgresPool != nil {
-		db.PostgresPool.Close()
+	if pool := db.Pool(); pool != nil {
+		pool.Close()
 	}
 	return nil
 }
@@ -64,24 +105,229 @@ func (db *DB) InitSchema() error {
 			clicks INTEGER DEFAULT 0,
 			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
 		);
+
+		ALTER TABLE entries ADD COLUMN IF NOT EXISTS metadata JSONB NOT NULL DEFAULT '{}';
+		ALTER TABLE entries ADD COLUMN IF NOT EXISTS owner TEXT NOT NULL DEFAULT '';
+		CREATE INDEX IF NOT EXISTS entries_owner_created_at_idx ON entries (owner, created_at);
+
+		-- SHA-256 of the normalized destination, used to deduplicate creates
+		ALTER TABLE entries ADD COLUMN IF NOT EXISTS url_hash BYTEA;
+		UPDATE entries SET url_hash = sha256(convert_to(original_url, 'UTF8')) WHERE url_hash IS NULL;
+		CREATE INDEX IF NOT EXISTS entries_owner_url_hash_idx ON entries (owner, url_hash);
+
+		-- Campaign of the destination, NULL until derived from original_url
+		ALTER TABLE entries
+			ADD COLUMN IF NOT EXISTS utm_source TEXT,
+			ADD COLUMN IF NOT EXISTS utm_medium TEXT,
+			ADD COLUMN IF NOT EXISTS utm_campaign TEXT;
+		CREATE INDEX IF NOT EXISTS entries_owner_utm_campaign_idx ON entries (owner, utm_campaign);
+
+		-- Folders nest through parent_id; names are unique per parent
+		CREATE TABLE IF NOT EXISTS folders (
+			id BIGSERIAL PRIMARY KEY,
+			owner TEXT NOT NULL DEFAULT '',
+			name TEXT NOT NULL,
+			parent_id BIGINT REFERENCES folders (id) ON DELETE CASCADE,
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			UNIQUE NULLS NOT DISTINCT (owner, parent_id, name)
+		);
+		CREATE INDEX IF NOT EXISTS folders_parent_id_idx ON folders (parent_id);
+
+		-- Descriptive details of links, which never affect resolves
+		ALTER TABLE entries
+			ADD COLUMN IF NOT EXISTS title TEXT NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS description TEXT NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS notes TEXT NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS folder_id BIGINT REFERENCES folders (id) ON DELETE SET NULL;
+		CREATE INDEX IF NOT EXISTS entries_folder_id_idx ON entries (folder_id);
+		CREATE TABLE IF NOT EXISTS entry_tags (
+			short_code VARCHAR(255) NOT NULL REFERENCES entries (short_code) ON DELETE CASCADE,
+			tag TEXT NOT NULL,
+			PRIMARY KEY (short_code, tag)
+		);
+		CREATE INDEX IF NOT EXISTS entry_tags_tag_idx ON entry_tags (tag, short_code);
+
+		-- Search of GET /link: words of the destination and details, plus
+		-- trigrams of the destination for URL fragments
+		CREATE EXTENSION IF NOT EXISTS pg_trgm;
+		ALTER TABLE entries ADD COLUMN IF NOT EXISTS search TSVECTOR GENERATED ALWAYS AS (
+			to_tsvector('simple', original_url || ' ' || title || ' ' || description || ' ' || notes)
+		) STORED;
+		CREATE INDEX IF NOT EXISTS entries_search_idx ON entries USING GIN (search);
+		CREATE INDEX IF NOT EXISTS entries_original_url_trgm_idx ON entries USING GIN (original_url gin_trgm_ops);
+		-- Keyset pagination by creation and by clicks. The clicks index
+		-- costs an index write per click, which recording a click already
+		-- spends on the rollups.
+		CREATE INDEX IF NOT EXISTS entries_created_at_id_idx ON entries (created_at, id);
+		CREATE INDEX IF NOT EXISTS entries_clicks_id_idx ON entries (clicks, id);
+
+		-- Weighted destinations of split links; original_url holds the first
+		ALTER TABLE entries ADD COLUMN IF NOT EXISTS sticky TEXT NOT NULL DEFAULT '';
+		CREATE TABLE IF NOT EXISTS entry_destinations (
+			short_code VARCHAR(255) NOT NULL REFERENCES entries (short_code) ON DELETE CASCADE,
+			variant TEXT NOT NULL,
+			url TEXT NOT NULL,
+			weight INTEGER NOT NULL CHECK (weight > 0),
+			position INTEGER NOT NULL,
+			PRIMARY KEY (short_code, variant)
+		);
+
+		-- App URLs of deep links; original_url is the web fallback
+		ALTER TABLE entries
+			ADD COLUMN IF NOT EXISTS ios_url TEXT NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS android_url TEXT NOT NULL DEFAULT '';
+
+		-- Links stop resolving at expires_at; expiry_notified is set once the
+		-- link.expired webhook event is queued
+		ALTER TABLE entries
+			ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP WITH TIME ZONE,
+			ADD COLUMN IF NOT EXISTS expiry_notified BOOLEAN NOT NULL DEFAULT FALSE;
+		CREATE INDEX IF NOT EXISTS entries_expiry_idx
+			ON entries (expires_at) WHERE expires_at IS NOT NULL AND NOT expiry_notified;
+
+		-- Ordered routing rules of a link as a JSON array, see rules.go
+		CREATE TABLE IF NOT EXISTS entry_rules (
+			short_code VARCHAR(255) PRIMARY KEY REFERENCES entries (short_code) ON DELETE CASCADE,
+			rules JSONB NOT NULL DEFAULT '[]',
+			updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+		);
+
+		CREATE TABLE IF NOT EXISTS webhook_endpoints (
+			id BIGSERIAL PRIMARY KEY,
+			owner TEXT NOT NULL CHECK (owner <> ''),
+			url TEXT NOT NULL,
+			secret TEXT NOT NULL,
+			events TEXT[] NOT NULL,
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+		);
+
+		-- Outbox of webhook events; dead deliveries exhausted their attempts
+		CREATE TABLE IF NOT EXISTS webhook_deliveries (
+			id BIGSERIAL PRIMARY KEY,
+			endpoint_id BIGINT NOT NULL REFERENCES webhook_endpoints (id) ON DELETE CASCADE,
+			event TEXT NOT NULL,
+			payload JSONB NOT NULL,
+			status TEXT NOT NULL DEFAULT 'pending',
+			attempts INTEGER NOT NULL DEFAULT 0,
+			last_status_code INTEGER,
+			last_error TEXT NOT NULL DEFAULT '',
+			next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			delivered_at TIMESTAMP WITH TIME ZONE
+		);
+		CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx
+			ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+		CREATE INDEX IF NOT EXISTS webhook_deliveries_endpoint_idx ON webhook_deliveries (endpoint_id, id);
+
+		CREATE TABLE IF NOT EXISTS utm_presets (
+			owner TEXT NOT NULL,
+			name TEXT NOT NULL,
+			utm_source TEXT NOT NULL DEFAULT '',
+			utm_medium TEXT NOT NULL DEFAULT '',
+			utm_campaign TEXT NOT NULL DEFAULT '',
+			utm_term TEXT NOT NULL DEFAULT '',
+			utm_content TEXT NOT NULL DEFAULT '',
+			updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			PRIMARY KEY (owner, name)
+		);
+
+		CREATE TABLE IF NOT EXISTS owner_settings (
+			owner TEXT PRIMARY KEY,
+			dedupe BOOLEAN NOT NULL DEFAULT FALSE,
+			updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+		);
+
+		CREATE TABLE IF NOT EXISTS click_events (
+			id BIGSERIAL PRIMARY KEY,
+			short_code VARCHAR(255) NOT NULL,
+			occurred_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			country VARCHAR(2) NOT NULL DEFAULT '',
+			region TEXT NOT NULL DEFAULT '',
+			city TEXT NOT NULL DEFAULT ''
+		);
+		CREATE INDEX IF NOT EXISTS click_events_short_code_occurred_at_idx
+			ON click_events (short_code, occurred_at);
+
+		ALTER TABLE click_events
+			ADD COLUMN IF NOT EXISTS browser TEXT NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS browser_version TEXT NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS os TEXT NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS device TEXT NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS is_bot BOOLEAN NOT NULL DEFAULT FALSE,
+			ADD COLUMN IF NOT EXISTS bot_name TEXT NOT NULL DEFAULT '';
+
+		ALTER TABLE click_events
+			ADD COLUMN IF NOT EXISTS referrer_domain TEXT NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS channel TEXT NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS utm_source TEXT NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS utm_medium TEXT NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS utm_campaign TEXT NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS utm_term TEXT NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS utm_content TEXT NOT NULL DEFAULT '';
+
+		ALTER TABLE click_events ADD COLUMN IF NOT EXISTS variant TEXT NOT NULL DEFAULT '';
+
+		CREATE TABLE IF NOT EXISTS click_rollups_hourly (
+			short_code VARCHAR(255) NOT NULL,
+			bucket TIMESTAMP WITH TIME ZONE NOT NULL,
+			clicks BIGINT NOT NULL DEFAULT 0,
+			PRIMARY KEY (short_code, bucket)
+		);
+
+		CREATE TABLE IF NOT EXISTS click_rollups_daily (
+			short_code VARCHAR(255) NOT NULL,
+			bucket TIMESTAMP WITH TIME ZONE NOT NULL,
+			clicks BIGINT NOT NULL DEFAULT 0,
+			PRIMARY KEY (short_code, bucket)
+		);
+
+		CREATE TABLE IF NOT EXISTS unique_visitors_daily (
+			short_code VARCHAR(255) NOT NULL,
+			day DATE NOT NULL,
+			hll BYTEA NOT NULL,
+			updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			PRIMARY KEY (short_code, day)
+		);
 	`
 
-	_, err := db.PostgresPool.Exec(ctx, createTableQuery)
+	_, err := db.Pool().Exec(ctx, createTableQuery)
 	if err != nil {
 		return fmt.Errorf("failed to create schema: %w", err)
 	}
 
+	// Backfill the rollups from events recorded before they existed
+	backfillQuery := `
+		INSERT INTO click_rollups_hourly (short_code, bucket, clicks)
+		SELECT short_code, date_trunc('hour', occurred_at, 'UTC'), COUNT(*) FROM click_events
+		WHERE NOT EXISTS (SELECT 1 FROM click_rollups_hourly)
+		GROUP BY 1, 2
+		ON CONFLICT DO NOTHING;
+
+		INSERT INTO click_rollups_daily (short_code, bucket, clicks)
+		SELECT short_code, date_trunc('day', occurred_at, 'UTC'), COUNT(*) FROM click_events
+		WHERE NOT EXISTS (SELECT 1 FROM click_rollups_daily)
+		GROUP BY 1, 2
+		ON CONFLICT DO NOTHING;
+	`
+	if _, err := db.Pool().Exec(ctx, backfillQuery); err != nil {
+		return fmt.Errorf("failed to backfill click rollups: %w", err)
+	}
+
 	return nil
 }
 
 func (db *DB) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
-	rows, err := db.PostgresPool.Query(ctx, sql, args...)
+	rows, err := db.Pool().Query(ctx, sql, args...)
 
 	return rows, err
 }
 
+func (db *DB) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	return db.Pool().QueryRow(ctx, sql, args...)
+}
+
 func (db *DB) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
-	result, err := db.PostgresPool.Exec(ctx, sql, args...)
+	result, err := db.Pool().Exec(ctx, sql, args...)
 
 	return result, err
 }
@@ -0,0 +1,56 @@
+package geoip
+
+import (
+	"fmt"
+	"net/netip"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+// Location is the geographic information derived from an IP address
+type Location struct {
+	Country string
+	Region  string
+	City    string
+}
+
+// Reader looks up locations in a local MaxMind GeoLite2/GeoIP2 City database
+type Reader struct {
+	db *geoip2.Reader
+}
+
+// Open memory-maps the .mmdb file at path
+func Open(path string) (*Reader, error) {
+	db, err := geoip2.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open GeoIP database %s: %w", path, err)
+	}
+	return &Reader{db: db}, nil
+}
+
+// Lookup returns the location of ip. Private, loopback and unknown addresses
+// yield an empty Location.
+func (r *Reader) Lookup(ip netip.Addr) (Location, error) {
+	if !ip.IsValid() || ip.IsPrivate() || ip.IsLoopback() || ip.IsUnspecified() {
+		return Location{}, nil
+	}
+
+	record, err := r.db.City(ip.Unmap().AsSlice())
+	if err != nil {
+		return Location{}, fmt.Errorf("GeoIP lookup failed: %w", err)
+	}
+
+	loc := Location{
+		Country: record.Country.IsoCode,
+		City:    record.City.Names["en"],
+	}
+	if len(record.Subdivisions) > 0 {
+		loc.Region = record.Subdivisions[0].Names["en"]
+	}
+	return loc, nil
+}
+
+// Close unmaps the database
+func (r *Reader) Close() error {
+	return r.db.Close()
+}
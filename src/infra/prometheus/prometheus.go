@@ -22,3 +22,72 @@ func NewHTTPMetrics(reg prometheus.Registerer) *HTTPMetrics {
 	reg.MustRegister(metrics.TotalRequests)
 	return metrics
 }
+
+// ScreeningMetrics counts destinations flagged by URL screening
+type ScreeningMetrics struct {
+	Hits *prometheus.CounterVec
+}
+
+// NewScreeningMetrics registers the URL screening metrics with reg
+func NewScreeningMetrics(reg prometheus.Registerer) *ScreeningMetrics {
+	metrics := &ScreeningMetrics{
+		Hits: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "url_screening_hits_total",
+				Help: "Destinations flagged by URL screening by stage and list",
+			},
+			[]string{"stage", "list"},
+		),
+	}
+	reg.MustRegister(metrics.Hits)
+	return metrics
+}
+
+// WebhookMetrics counts webhook delivery attempts
+type WebhookMetrics struct {
+	Deliveries *prometheus.CounterVec
+}
+
+// NewWebhookMetrics registers the webhook metrics with reg
+func NewWebhookMetrics(reg prometheus.Registerer) *WebhookMetrics {
+	metrics := &WebhookMetrics{
+		Deliveries: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "webhook_deliveries_total",
+				Help: "Webhook delivery attempts by event and outcome: delivered, retry or dead",
+			},
+			[]string{"event", "outcome"},
+		),
+	}
+	reg.MustRegister(metrics.Deliveries)
+	return metrics
+}
+
+// GRPCMetrics counts gRPC calls and their latency
+type GRPCMetrics struct {
+	Requests *prometheus.CounterVec
+	Latency  *prometheus.HistogramVec
+}
+
+// NewGRPCMetrics registers the gRPC metrics with reg
+func NewGRPCMetrics(reg prometheus.Registerer) *GRPCMetrics {
+	metrics := &GRPCMetrics{
+		Requests: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "grpc_requests_total",
+				Help: "Total gRPC calls by method and status code",
+			},
+			[]string{"method", "code"},
+		),
+		Latency: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "grpc_request_duration_seconds",
+				Help:    "Duration of gRPC calls by method",
+				Buckets: prometheus.DefBuckets,
+			},
+			[]string{"method"},
+		),
+	}
+	reg.MustRegister(metrics.Requests, metrics.Latency)
+	return metrics
+}
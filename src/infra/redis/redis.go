@@ -2,28 +2,32 @@ package redis
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	config "github.com/mahopon/SmolEarl/config"
-	"github.com/redis/go-redis/v9"
+	"net"
+	"strconv"
+	"sync/atomic"
 	"time"
-)
 
-var (
-	AppConfig = config.AppConfig
+	config "github.com/mahopon/SmolEarl/config"
+	"github.com/redis/go-redis/v9"
 )
 
 type Redis struct {
-	Client *redis.Client
+	Client   *redis.Client
+	password atomic.Pointer[string]
 }
 
-func InitRedis() (*Redis, error) {
-	r := &Redis{
-		Client: redis.NewClient(&redis.Options{
-			Addr:     fmt.Sprintf("%s:%s", AppConfig.RedisHost, AppConfig.RedisPort),
-			Password: AppConfig.RedisPass,
-			DB:       0,
-		}),
-	}
+func InitRedis(cfg *config.Config) (*Redis, error) {
+	r := &Redis{}
+	r.SetPassword(cfg.RedisPass)
+	r.Client = redis.NewClient(&redis.Options{
+		Addr: net.JoinHostPort(cfg.RedisHost, strconv.Itoa(cfg.RedisPort)),
+		DB:   cfg.RedisDB,
+		CredentialsProvider: func() (string, string) {
+			return "", *r.password.Load()
+		},
+	})
 
 	ctx := context.Background()
 	_, err := r.Client.Ping(ctx).Result()
@@ -34,6 +38,12 @@ func InitRedis() (*Redis, error) {
 	return r, nil
 }
 
+// SetPassword changes the password used for new connections, e.g. after a
+// secret rotation. Existing connections stay authenticated.
+func (r *Redis) SetPassword(password string) {
+	r.password.Store(&password)
+}
+
 func (r *Redis) Close() error {
 	if r.Client != nil {
 		return r.Client.Close()
@@ -45,7 +55,7 @@ func (r *Redis) Get(ctx context.Context, key string) (string, error) {
 	val, err := r.Client.Get(ctx, key).Result()
 
 	if err != nil {
-		return "", err
+		return "", wrapErr(err)
 	}
 	return val, nil
 }
@@ -54,11 +64,127 @@ func (r *Redis) Set(ctx context.Context, key string, value any, expiration time.
 	err := r.Client.Set(ctx, key, value, expiration).Err()
 
 	if err != nil {
-		return err
+		return wrapErr(err)
 	}
 	return nil
 }
 
+// SetMany sets every key in values with the same expiration in one pipeline
+func (r *Redis) SetMany(ctx context.Context, values map[string]any, expiration time.Duration) error {
+	pipe := r.Client.Pipeline()
+	for key, value := range values {
+		pipe.Set(ctx, key, value, expiration)
+	}
+	_, err := pipe.Exec(ctx)
+	return wrapErr(err)
+}
+
+// SetNX sets key only if it does not exist yet and reports whether it did
+func (r *Redis) SetNX(ctx context.Context, key string, value any, expiration time.Duration) (bool, error) {
+	ok, err := r.Client.SetNX(ctx, key, value, expiration).Result()
+	return ok, wrapErr(err)
+}
+
+// AddToHyperLogLog adds elements to the HyperLogLog at key and refreshes its expiration
+func (r *Redis) AddToHyperLogLog(ctx context.Context, key string, expiration time.Duration, elements ...any) error {
+	pipe := r.Client.TxPipeline()
+	pipe.PFAdd(ctx, key, elements...)
+	pipe.Expire(ctx, key, expiration)
+	_, err := pipe.Exec(ctx)
+	return wrapErr(err)
+}
+
+// CountHyperLogLog returns the approximate cardinality of the union of keys
+func (r *Redis) CountHyperLogLog(ctx context.Context, keys ...string) (int64, error) {
+	count, err := r.Client.PFCount(ctx, keys...).Result()
+	return count, wrapErr(err)
+}
+
+// CountHyperLogLogs returns, in one pipeline, the approximate cardinality of
+// each key, whether each key exists, and the cardinality of their union
+func (r *Redis) CountHyperLogLogs(ctx context.Context, keys []string) ([]int64, []bool, int64, error) {
+	pipe := r.Client.Pipeline()
+	exists := make([]*redis.IntCmd, len(keys))
+	counts := make([]*redis.IntCmd, len(keys))
+	for i, key := range keys {
+		exists[i] = pipe.Exists(ctx, key)
+		counts[i] = pipe.PFCount(ctx, key)
+	}
+	union := pipe.PFCount(ctx, keys...)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, nil, 0, wrapErr(err)
+	}
+
+	cardinalities := make([]int64, len(keys))
+	found := make([]bool, len(keys))
+	for i := range keys {
+		cardinalities[i] = counts[i].Val()
+		found[i] = exists[i].Val() == 1
+	}
+	return cardinalities, found, union.Val(), nil
+}
+
+// MergeHyperLogLogs merges each raw HyperLogLog value into the one at its
+// key in one transaction, creating missing keys with the given expiration
+func (r *Redis) MergeHyperLogLogs(ctx context.Context, values map[string][]byte, expiration time.Duration) error {
+	pipe := r.Client.TxPipeline()
+	for key, raw := range values {
+		tmp := key + ":merge"
+		pipe.Set(ctx, tmp, raw, time.Minute)
+		pipe.PFMerge(ctx, key, key, tmp)
+		pipe.Del(ctx, tmp)
+		pipe.Expire(ctx, key, expiration)
+	}
+	_, err := pipe.Exec(ctx)
+	return wrapErr(err)
+}
+
+// AddToSet adds members to the set at key
+func (r *Redis) AddToSet(ctx context.Context, key string, members ...any) error {
+	return wrapErr(r.Client.SAdd(ctx, key, members...).Err())
+}
+
+// PopFromSet removes and returns up to count random members of the set at key
+func (r *Redis) PopFromSet(ctx context.Context, key string, count int64) ([]string, error) {
+	members, err := r.Client.SPopN(ctx, key, count).Result()
+	return members, wrapErr(err)
+}
+
+// Del removes keys
+func (r *Redis) Del(ctx context.Context, keys ...string) error {
+	return wrapErr(r.Client.Del(ctx, keys...).Err())
+}
+
+// Publish sends message to the subscribers of channel
+func (r *Redis) Publish(ctx context.Context, channel string, message any) error {
+	return wrapErr(r.Client.Publish(ctx, channel, message).Err())
+}
+
+// Subscribe listens to channel until the returned subscription is closed
+func (r *Redis) Subscribe(ctx context.Context, channel string) *redis.PubSub {
+	return r.Client.Subscribe(ctx, channel)
+}
+
+// IsNotFound reports whether err means the key does not exist
+func IsNotFound(err error) bool {
+	return err == redis.Nil
+}
+
+// ErrUnavailable wraps failures to reach Redis, as opposed to errors reported
+// by Redis
+var ErrUnavailable = errors.New("redis is unavailable")
+
+// wrapErr marks connection failures and timeouts with ErrUnavailable
+func wrapErr(err error) error {
+	var netErr net.Error
+	// go-redis does not export its pool timeout error
+	if errors.As(err, &netErr) || errors.Is(err, redis.ErrClosed) ||
+		(err != nil && err.Error() == "redis: connection pool timeout") {
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	return err
+}
+
 func getErrorCode(err error) string {
 	if err == redis.Nil {
 		return "not_found"
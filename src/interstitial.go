@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+)
+
+// interstitialTemplate warns visitors of a link disabled by URL screening.
+// The destination is deliberately not linked.
+var interstitialTemplate = template.Must(template.New("interstitial").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>Link disabled</title>
+<style>
+body { font-family: system-ui, sans-serif; max-width: 36rem; margin: 4rem auto; padding: 0 1rem; color: #222; }
+h1 { color: #b00020; }
+code { word-break: break-all; }
+</style>
+</head>
+<body>
+<h1>This link has been disabled</h1>
+<p>The destination of <code>{{.}}</code> has been flagged as potentially harmful, for example phishing or malware, and is no longer served.</p>
+<p>If you believe this is a mistake, contact the person who shared the link.</p>
+</body>
+</html>
+`))
+
+// acceptsHTML reports whether r comes from a browser rather than an API client
+func acceptsHTML(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+// writeInterstitial answers a request for a disabled link with a warning page
+// for browsers and a plain error for API clients
+func writeInterstitial(w http.ResponseWriter, r *http.Request, shortCode string) {
+	w.Header().Set("Cache-Control", "no-store")
+	if !acceptsHTML(r) {
+		writeError(w, r, fmt.Errorf("%w: its destination was flagged as potentially harmful", ErrLinkDisabled))
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusForbidden)
+	interstitialTemplate.Execute(w, shortCode)
+}
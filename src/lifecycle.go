@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+var (
+	// ErrInvalidExpiry is returned when a link would be created expired
+	ErrInvalidExpiry = newError(CodeInvalidInput, "expiresAt must be in the future")
+	// ErrLinkExpired is returned when a link is resolved after its expiry
+	ErrLinkExpired = newError(CodeExpired, "link has expired")
+)
+
+// expiryFromRequest returns the expiry of a new link, truncated to the
+// precision PostgreSQL stores
+func expiryFromRequest(expiresAt *time.Time, now time.Time) (*time.Time, error) {
+	if expiresAt == nil {
+		return nil, nil
+	}
+	t := expiresAt.UTC().Truncate(time.Microsecond)
+	if !t.After(now) {
+		return nil, ErrInvalidExpiry
+	}
+	return &t, nil
+}
+
+// checkExpiry reports ErrLinkExpired once link has expired
+func checkExpiry(link Link, now time.Time) error {
+	if link.ExpiresAt != nil && !now.Before(*link.ExpiresAt) {
+		return ErrLinkExpired
+	}
+	return nil
+}
+
+// DeleteLink removes a link with its details, routing rules and recorded
+// clicks, and sends link.deleted to webhooks
+func (s *Service) DeleteLink(ctx context.Context, shortCode string) error {
+	entry, err := s.repo.DeleteEntry(ctx, shortCode)
+	if err != nil {
+		return fmt.Errorf("failed to delete from PostgreSQL: %w", err)
+	}
+	if entry == nil {
+		return ErrEntryNotFound
+	}
+	s.invalidate(ctx, []string{shortCode})
+	s.emitLinkEvent(ctx, EventLinkDeleted, *entry, "")
+	slog.InfoContext(ctx, "Deleted entry", "code", shortCode)
+	return nil
+}
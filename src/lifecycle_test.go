@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestExpiryFromRequest(t *testing.T) {
+	now := time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC)
+	future := now.Add(time.Hour + 1500*time.Nanosecond)
+
+	if got, err := expiryFromRequest(nil, now); got != nil || err != nil {
+		t.Errorf("no expiry = %v, %v; want nil, nil", got, err)
+	}
+	got, err := expiryFromRequest(&future, now)
+	if err != nil || got == nil || !got.Equal(now.Add(time.Hour+time.Microsecond)) {
+		t.Errorf("future expiry = %v, %v; want it truncated to microseconds", got, err)
+	}
+	for _, past := range []time.Time{now, now.Add(-time.Second)} {
+		if _, err := expiryFromRequest(&past, now); !errors.Is(err, ErrInvalidExpiry) {
+			t.Errorf("expiry %v error = %v, want ErrInvalidExpiry", past, err)
+		}
+	}
+}
+
+func TestCheckExpiry(t *testing.T) {
+	now := time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC)
+	later, earlier := now.Add(time.Minute), now.Add(-time.Minute)
+
+	tests := []struct {
+		name      string
+		expiresAt *time.Time
+		want      error
+	}{
+		{"no expiry", nil, nil},
+		{"not yet", &later, nil},
+		{"at expiry", &now, ErrLinkExpired},
+		{"expired", &earlier, ErrLinkExpired},
+	}
+	for _, tt := range tests {
+		if err := checkExpiry(Link{ExpiresAt: tt.expiresAt}, now); err != tt.want {
+			t.Errorf("%s: checkExpiry = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+	if got := errorStatus[errorCode(ErrLinkExpired)]; got != 410 {
+		t.Errorf("expired links are reported with status %d, want 410", got)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Sort orders of GET /link, both descending
+const (
+	SortCreated = "created"
+	SortClicks  = "clicks"
+)
+
+const (
+	// defaultListLimit and maxListLimit bound ?limit= on GET /link
+	defaultListLimit = 50
+	maxListLimit     = 200
+	// maxSearchLength caps ?q=
+	maxSearchLength = 200
+)
+
+// LinkQuery selects a page of links for GET /link
+type LinkQuery struct {
+	Filter ExportFilter
+	// Search matches the destination URL, title, description and notes
+	Search string
+	Sort   string
+	// After continues a listing after the last link of the previous page
+	After *listCursor
+	Limit int
+}
+
+// listCursor is the sort key of the last link of a page. Ties on the sort
+// column are broken by the entry ID.
+type listCursor struct {
+	Sort      string    `json:"s"`
+	CreatedAt time.Time `json:"t,omitzero"`
+	Clicks    int       `json:"c,omitempty"`
+	ID        int64     `json:"i"`
+}
+
+// encodeCursor returns the opaque next_cursor of c
+func encodeCursor(c listCursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor parses a cursor returned by an earlier page sorted by sort
+func decodeCursor(raw, sort string) (*listCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	var c listCursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	if c.Sort != sort {
+		return nil, fmt.Errorf("cursor was issued for sort=%s", c.Sort)
+	}
+	return &c, nil
+}
+
+// parseLinkQuery reads the filters of parseExportFilter plus q, sort, cursor
+// and limit from the query string
+func parseLinkQuery(values url.Values) (LinkQuery, error) {
+	filter, err := parseExportFilter(values)
+	if err != nil {
+		return LinkQuery{}, err
+	}
+	q := LinkQuery{Filter: filter, Search: strings.TrimSpace(values.Get("q")), Sort: values.Get("sort")}
+	if len(q.Search) > maxSearchLength {
+		return q, fmt.Errorf("q is longer than %d characters", maxSearchLength)
+	}
+	switch q.Sort {
+	case "":
+		q.Sort = SortCreated
+	case SortCreated, SortClicks:
+	default:
+		return q, fmt.Errorf("sort must be %s or %s", SortCreated, SortClicks)
+	}
+	if raw := values.Get("cursor"); raw != "" {
+		if q.After, err = decodeCursor(raw, q.Sort); err != nil {
+			return q, err
+		}
+	}
+	if q.Limit, err = parseLimit(values, defaultListLimit, maxListLimit); err != nil {
+		return q, err
+	}
+	return q, nil
+}
+
+// LinkItem is a link in a listing
+type LinkItem struct {
+	LinkRecord
+	FolderID *int64 `json:"folder_id,omitempty"`
+}
+
+// LinkList is the response of GET /link
+type LinkList struct {
+	Items []LinkItem `json:"items"`
+	// NextCursor fetches the next page; it is empty on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+	// TotalEstimate is the planner's estimate of the matching links, exact
+	// when everything fits on the first page
+	TotalEstimate int64 `json:"total_estimate"`
+}
+
+// ListLinks returns a page of the links matching q, newest or most clicked
+// first
+func (s *Service) ListLinks(ctx context.Context, q LinkQuery) (LinkList, error) {
+	// One extra row tells whether another page follows
+	entries, err := s.repo.ListEntries(ctx, q, q.Limit+1)
+	if err != nil {
+		return LinkList{}, fmt.Errorf("failed to list entries: %w", err)
+	}
+
+	list := LinkList{Items: make([]LinkItem, 0, min(len(entries), q.Limit))}
+	if len(entries) > q.Limit {
+		entries = entries[:q.Limit]
+		last := entries[len(entries)-1]
+		next := listCursor{Sort: q.Sort, ID: last.ID}
+		if q.Sort == SortClicks {
+			next.Clicks = last.Clicks
+		} else {
+			next.CreatedAt = last.CreatedAt
+		}
+		list.NextCursor = encodeCursor(next)
+	}
+	for _, e := range entries {
+		list.Items = append(list.Items, LinkItem{LinkRecord: linkRecordOf(e), FolderID: e.Details.FolderID})
+	}
+
+	if q.After == nil && list.NextCursor == "" {
+		list.TotalEstimate = int64(len(list.Items))
+	} else if list.TotalEstimate, err = s.repo.EstimateEntries(ctx, q); err != nil {
+		return LinkList{}, fmt.Errorf("failed to estimate entries: %w", err)
+	}
+	return list, nil
+}
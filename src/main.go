@@ -1,27 +1,62 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	_ "time/tzdata" // The scratch image ships no zoneinfo for ?tz= lookups
 
 	"github.com/mahopon/SmolEarl/config"
 	"github.com/mahopon/SmolEarl/infra/db"
+	"github.com/mahopon/SmolEarl/infra/geoip"
+	"github.com/mahopon/SmolEarl/infra/logging"
 	infra_prom "github.com/mahopon/SmolEarl/infra/prometheus"
 	"github.com/mahopon/SmolEarl/infra/redis"
+	"github.com/mahopon/SmolEarl/screening"
+	"github.com/mahopon/SmolEarl/secrets"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func main() {
+	args := os.Args[1:]
+	if isCommand(args) {
+		os.Exit(runCommand(args, os.Stdout, os.Stderr))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	cfg, err := config.LoadConfig(ctx, args)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	logLevel, err := logging.ParseLevel(cfg.LogLevel)
+	if err != nil {
+		log.Fatalf("Failed to configure logging: %v", err)
+	}
+	logger, err := logging.NewLogger(os.Stdout, logLevel, cfg.LogFormat)
+	if err != nil {
+		log.Fatalf("Failed to configure logging: %v", err)
+	}
+	slog.SetDefault(logger)
+
 	reg := prometheus.NewRegistry()
 
-	redisClient, err := redis.InitRedis()
+	redisClient, err := redis.InitRedis(cfg)
 	if err != nil {
 		log.Fatalf("Failed to initialize Redis: %v", err)
 	}
 
-	dbClient, err := db.InitPostgres()
+	dbClient, err := db.InitPostgres(cfg)
 	if err != nil {
 		log.Fatalf("Failed to initialize PostgreSQL: %v", err)
 	}
@@ -30,30 +65,171 @@ func main() {
 		log.Fatalf("Failed to initialize schema: %v", err)
 	}
 
+	if rotator, ok := cfg.Secrets.(secrets.Rotator); ok {
+		rotator.OnRotate("POSTGRES_PASSWORD", func(ctx context.Context, password string) {
+			dbConfig := *cfg
+			dbConfig.DBPassword = password
+			if err := dbClient.Rebuild(ctx, &dbConfig); err != nil {
+				slog.ErrorContext(ctx, "Failed to rebuild PostgreSQL pool after rotation", "error", err)
+				return
+			}
+			slog.InfoContext(ctx, "Rebuilt PostgreSQL pool with rotated credentials")
+		})
+		rotator.OnRotate("REDIS_PASSWORD", func(ctx context.Context, password string) {
+			redisClient.SetPassword(password)
+		})
+		go rotator.Run(ctx)
+	}
+
 	httpMetrics := infra_prom.NewHTTPMetrics(reg)
 
-	repo := NewEntryRepository(dbClient.PostgresPool)
+	repo := NewEntryRepository(dbClient)
 	service := NewService()
 	service.SetRepository(repo)
 	service.SetRedis(redisClient)
+	service.SetCacheTTL(cfg.RedisCacheTTL)
+	service.SetDestinationValidator(newDestinationValidator(cfg))
+	// Every instance publishes clicks so gRPC click streams see them all
+	service.SetClickStream(newClickStream(redisClient))
+	go service.BackfillCampaigns(ctx)
+	webhooks := newWebhookDispatcher(repo, webhookOptions(cfg), infra_prom.NewWebhookMetrics(reg))
+	service.SetWebhooks(webhooks)
+	webhooks.Start()
+	if cfg.BlocklistFile != "" || cfg.HashPrefixFile != "" {
+		screener, err := screening.New(cfg.BlocklistFile, cfg.HashPrefixFile)
+		if err != nil {
+			log.Fatalf("Failed to initialize URL screening: %v", err)
+		}
+		service.SetScreener(screener, infra_prom.NewScreeningMetrics(reg))
+		go screener.Run(ctx, cfg.BlocklistReloadInterval)
+	}
+	visitors := newVisitorCounter(redisClient, repo)
+	service.SetVisitorCounter(visitors)
+	go visitors.Run(ctx, cfg.VisitorPersistInterval)
+	if cfg.GeoIPDatabase != "" {
+		geo, err := geoip.Open(cfg.GeoIPDatabase)
+		if err != nil {
+			log.Fatalf("Failed to initialize GeoIP: %v", err)
+		}
+		defer geo.Close()
+		service.SetGeoIP(geo)
+	}
+
+	clientIP, err := NewClientIPResolver(cfg.TrustedProxies)
+	if err != nil {
+		log.Fatalf("Failed to configure trusted proxies: %v", err)
+	}
 	controller := NewController(service)
+	controller.SetClientIPResolver(clientIP)
+	qr := NewQRRenderer(cfg.PublicBaseURL)
+	if cfg.QRLogo != "" {
+		logo, err := os.ReadFile(cfg.QRLogo)
+		if err != nil {
+			log.Fatalf("Failed to read QR logo: %v", err)
+		}
+		if err := qr.SetLogo(logo); err != nil {
+			log.Fatalf("Failed to initialize QR logo: %v", err)
+		}
+	}
+	controller.SetQRRenderer(qr)
+	controller.SetAppAssociation(NewAppAssociation(cfg.PublicBaseURL, cfg.IOSAppIDs, cfg.AndroidPackage, cfg.AndroidCertFingerprints))
+	controller.SetBulkMaxItems(cfg.BulkMaxItems)
+	controller.SetOpenAPI(NewOpenAPI(cfg.AppName, cfg.AppVersion))
 	router := NewRouter(controller).Init()
 	linkRouter := NewLinkRouter(controller).Init()
 
+	metricsHandler := promhttp.HandlerFor(reg, promhttp.HandlerOpts{})
+
 	mux := http.NewServeMux()
+	mux.HandleFunc("GET /link", controller.ListLinksHandler)
 	mux.Handle("/link/", http.StripPrefix("/link", linkRouter))
-	mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+	if cfg.PrometheusPort == 0 {
+		mux.Handle("/metrics", metricsHandler)
+	}
 	mux.Handle("/", router)
 	handler := StripTrailingSlashMiddleware(mux)
 	handler = LoggingMiddleware(handler)
-	handler = CORSMiddleware(handler)
+	handler = RequestIDMiddleware(handler)
+	cors, err := CORSMiddleware(CORSConfig{
+		AllowedOrigins:   cfg.CORSAllowedOrigins,
+		AllowedMethods:   cfg.CORSAllowedMethods,
+		AllowedHeaders:   cfg.CORSAllowedHeaders,
+		ExposedHeaders:   []string{RequestIDHeader},
+		MaxAge:           cfg.CORSMaxAge,
+		AllowCredentials: cfg.CORSAllowCredentials,
+	})
+	if err != nil {
+		log.Fatalf("Failed to configure CORS: %v", err)
+	}
+	handler = cors(handler)
 	handler = PrometheusHTTPMiddleware(httpMetrics)(handler)
 
-	addr := ":" + config.AppConfig.Port
-	fmt.Printf("Starting server on http://%s:%s\n", config.AppConfig.Host, config.AppConfig.Port)
-	fmt.Printf("Prometheus metrics available at http://%s:%s/metrics\n", config.AppConfig.Host, config.AppConfig.Port)
+	if cfg.PrometheusPort != 0 {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("/metrics", metricsHandler)
+		metricsAddr := net.JoinHostPort("", strconv.Itoa(cfg.PrometheusPort))
+		go func() {
+			if err := http.ListenAndServe(metricsAddr, metricsMux); err != nil {
+				slog.Error("Metrics server error", "error", err)
+			}
+		}()
+		fmt.Printf("Prometheus metrics available at http://%s:%d/metrics\n", cfg.Host, cfg.PrometheusPort)
+	} else {
+		fmt.Printf("Prometheus metrics available at http://%s:%d/metrics\n", cfg.Host, cfg.Port)
+	}
 
-	if err := http.ListenAndServe(addr, handler); err != nil {
-		fmt.Printf("Server error: %v\n", err)
+	var grpcServer *GRPCServer
+	if cfg.GRPCPort != 0 {
+		grpcServer = NewGRPCServer(service, GRPCOptions{
+			Tokens:          cfg.GRPCTokens,
+			DefaultDeadline: cfg.GRPCDefaultDeadline,
+			BulkMaxItems:    cfg.BulkMaxItems,
+		}, infra_prom.NewGRPCMetrics(reg))
+		if len(cfg.GRPCTokens) == 0 {
+			slog.Warn("gRPC API is not authenticated, set grpc_tokens to require bearer tokens")
+		}
+		lis, err := net.Listen("tcp", net.JoinHostPort("", strconv.Itoa(cfg.GRPCPort)))
+		if err != nil {
+			log.Fatalf("Failed to listen for gRPC: %v", err)
+		}
+		go func() {
+			if err := grpcServer.Serve(lis); err != nil {
+				slog.Error("gRPC server error", "error", err)
+				stop()
+			}
+		}()
+		fmt.Printf("gRPC API available at %s:%d\n", cfg.Host, cfg.GRPCPort)
+	}
+
+	server := &http.Server{
+		Addr:         net.JoinHostPort("", strconv.Itoa(cfg.Port)),
+		Handler:      handler,
+		ReadTimeout:  cfg.HTTPReadTimeout,
+		WriteTimeout: cfg.HTTPWriteTimeout,
+		IdleTimeout:  cfg.HTTPIdleTimeout,
+	}
+	fmt.Printf("Starting server on http://%s:%d\n", cfg.Host, cfg.Port)
+
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			fmt.Printf("Server error: %v\n", err)
+			stop()
+		}
+	}()
+
+	<-ctx.Done()
+	slog.Info("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Failed to shut down server", "error", err)
+	}
+	if grpcServer != nil {
+		if err := grpcServer.Shutdown(shutdownCtx); err != nil {
+			slog.Error("Failed to shut down gRPC server", "error", err)
+		}
+	}
+	if err := webhooks.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Failed to shut down webhook dispatcher", "error", err)
 	}
 }
@@ -1,15 +1,66 @@
 package main
 
 import (
+	"context"
 	"log/slog"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/mahopon/SmolEarl/infra/logging"
 	infra_prom "github.com/mahopon/SmolEarl/infra/prometheus"
 )
 
+// RequestIDHeader is the header used to propagate the request correlation ID
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength caps the length of a client supplied request ID
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// RequestIDFromContext returns the request ID stored by RequestIDMiddleware
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// RequestIDMiddleware reuses the incoming X-Request-ID header when it is valid
+// and generates a new one otherwise. The ID is echoed back on the response and
+// attached to the request context so every log line can be correlated.
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			generated, err := generateNonce(r.Context())
+			if err != nil {
+				generated = strconv.FormatInt(time.Now().UnixNano(), 36)
+			}
+			id = generated
+		}
+
+		w.Header().Set(RequestIDHeader, id)
+
+		ctx := context.WithValue(r.Context(), requestIDKey{}, id)
+		ctx = logging.WithAttrs(ctx, slog.String("request_id", id))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// validRequestID accepts non-empty, bounded IDs made of printable ASCII
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
 // LoggingMiddleware logs all HTTP requests and responses
 func LoggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -29,44 +80,21 @@ func LoggingMiddleware(next http.Handler) http.Handler {
 			slog.Duration("duration", duration),
 		}
 
+		ctx := r.Context()
 		switch {
 		case wrapper.statusCode >= 500:
-			slog.Error("request completed with server error", logAttrs...)
+			slog.ErrorContext(ctx, "request completed with server error", logAttrs...)
 		case wrapper.statusCode >= 400:
-			slog.Warn("request completed with client error", logAttrs...)
+			slog.WarnContext(ctx, "request completed with client error", logAttrs...)
 		case wrapper.statusCode >= 300:
-			slog.Info("request completed with redirect", logAttrs...)
+			slog.InfoContext(ctx, "request completed with redirect", logAttrs...)
 		default:
-			slog.Debug("request completed successfully", logAttrs...)
+			slog.DebugContext(ctx, "request completed successfully", logAttrs...)
 		}
 
 	})
 }
 
-// CORSMiddleware adds Cross-Origin Resource Sharing headers to each response.
-// It also handles preflight OPTIONS requests by returning the appropriate
-// headers without invoking the next handler.
-func CORSMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Set common CORS headers. Adjust the allowed origins, methods, and
-		// headers as needed for the application.
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		w.Header().Set("Access-Control-Allow-Credentials", "true")
-
-		// If this is a preflight request, respond with 200 OK and do not
-		// forward the request to the next handler.
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-
-		// Otherwise, continue processing the request.
-		next.ServeHTTP(w, r)
-	})
-}
-
 func StripTrailingSlashMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		path := r.URL.Path
@@ -102,3 +130,9 @@ func (r *responseWriterWrapper) WriteHeader(code int) {
 	r.statusCode = code
 	r.ResponseWriter.WriteHeader(code)
 }
+
+// Unwrap lets http.ResponseController reach the deadlines and flushing of
+// the wrapped writer
+func (r *responseWriterWrapper) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	infra_prom "github.com/mahopon/SmolEarl/infra/prometheus"
+)
+
+func TestMiddlewaresKeepResponseControl(t *testing.T) {
+	errs := make(chan error, 3)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rc := http.NewResponseController(w)
+		errs <- rc.SetReadDeadline(time.Time{})
+		errs <- rc.SetWriteDeadline(time.Time{})
+		w.Write([]byte("partial"))
+		errs <- rc.Flush()
+	})
+	metrics := infra_prom.NewHTTPMetrics(prometheus.NewRegistry())
+	server := httptest.NewServer(LoggingMiddleware(PrometheusHTTPMiddleware(metrics)(handler)))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	for _, call := range []string{"SetReadDeadline", "SetWriteDeadline", "Flush"} {
+		if err := <-errs; err != nil {
+			t.Errorf("%s through the middlewares: %v", call, err)
+		}
+	}
+}
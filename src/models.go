@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	// maxBodyBytes caps JSON request bodies
+	maxBodyBytes = 1 << 20
+	// maxBulkBodyBytes caps the body of POST /link/bulk
+	maxBulkBodyBytes = 32 << 20
+)
+
+// CreateRequest is the body of POST /link/create. Either URL or Destinations
+// is set.
+type CreateRequest struct {
+	URL         string `json:"url,omitempty"`
+	CustomAlias string `json:"customAlias,omitempty"`
+	Owner       string `json:"owner,omitempty"`
+	// Destinations makes a split link; Sticky is none, cookie or hash
+	Destinations []DestinationRequest `json:"destinations,omitempty"`
+	Sticky       string               `json:"sticky,omitempty"`
+	DeepLink     *DeepLink            `json:"deepLink,omitempty"`
+	UTM          *UTM                 `json:"utm,omitempty"`
+	UTMPreset    string               `json:"utmPreset,omitempty"`
+	// Dedupe overrides the owner's deduplication setting when set
+	Dedupe *bool `json:"dedupe,omitempty"`
+	// ExpiresAt stops the link from resolving from then on
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+
+	Title       string   `json:"title,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Notes       string   `json:"notes,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	// FolderID must be a folder of Owner
+	FolderID *int64 `json:"folderId,omitempty"`
+}
+
+// constrainSchema requires exactly one of url and destinations, as Create
+// does
+func (CreateRequest) constrainSchema(schema map[string]any) {
+	schema["oneOf"] = []any{
+		map[string]any{"required": []string{"url"}},
+		map[string]any{"required": []string{"destinations"}},
+	}
+}
+
+// DestinationRequest is one destination of a split link in a create request.
+// The name defaults to a, b, c and so on, and the weight to 1.
+type DestinationRequest struct {
+	Name   string `json:"variant,omitempty"`
+	URL    string `json:"url" openapi:"required"`
+	Weight *int   `json:"weight,omitempty"`
+}
+
+// CreateResponse is the response of POST /link/create
+type CreateResponse struct {
+	Message  string `json:"message"`
+	ID       string `json:"id"`
+	Existing bool   `json:"existing"`
+}
+
+// Link is an entry as cached in Redis and returned by resolves. The fields
+// after ExpiresAt describe a resolve for one visitor and are never cached.
+type Link struct {
+	URL          string     `json:"url"`
+	ShortCode    string     `json:"shortCode"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	Clicks       int64      `json:"clicks"`
+	Destinations []Variant  `json:"destinations,omitempty"`
+	Sticky       string     `json:"sticky,omitempty"`
+	DeepLink     *DeepLink  `json:"deepLink,omitempty"`
+	ExpiresAt    *time.Time `json:"expiresAt,omitempty"`
+
+	// Variant is the split destination served
+	Variant string `json:"variant,omitempty"`
+	// Rule is the routing rule that picked the destination
+	Rule string `json:"rule,omitempty"`
+	// Platform and AppURL are the app URL of a deep link for the visitor's
+	// platform
+	Platform string `json:"platform,omitempty"`
+	AppURL   string `json:"appUrl,omitempty"`
+}
+
+// LinkStats is the response of GET /stats/{id}
+type LinkStats struct {
+	EntryID        string          `json:"entry_id"`
+	Clicks         int             `json:"clicks"`
+	CreatedAt      time.Time       `json:"createdAt"`
+	Countries      []CountryCount  `json:"countries"`
+	Channels       []BreakdownItem `json:"channels"`
+	Variants       []VariantStats  `json:"variants,omitempty"`
+	UniqueVisitors *UniqueVisitors `json:"unique_visitors,omitempty"`
+}
+
+// UniqueVisitors counts the distinct visitors of a link over the UTC days
+// From to To
+type UniqueVisitors struct {
+	From  string          `json:"from"`
+	To    string          `json:"to"`
+	Total int64           `json:"total"`
+	Daily []DailyVisitors `json:"daily"`
+}
+
+// BulkRequest is the body of POST /link/bulk
+type BulkRequest struct {
+	Items []BulkItem `json:"items" openapi:"required"`
+}
+
+// BulkResponse is the response of POST /link/bulk
+type BulkResponse struct {
+	Created int          `json:"created"`
+	Failed  int          `json:"failed"`
+	Results []BulkResult `json:"results"`
+}
+
+// RuleSet is the ordered routing rules of a link, as read and written by
+// /link/{code}/rules
+type RuleSet struct {
+	Rules []Rule `json:"rules"`
+}
+
+// decodeJSON strictly decodes the body of r into dst: bodies over maxBytes,
+// unknown fields and trailing data are rejected. On failure the error is
+// written to w and false is returned.
+func decodeJSON(w http.ResponseWriter, r *http.Request, dst any, maxBytes int64) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBytes))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(dst)
+	if err == nil && dec.Decode(&struct{}{}) != io.EOF {
+		err = errors.New("body must contain a single JSON value")
+	}
+	if err == nil {
+		return true
+	}
+
+	var tooLarge *http.MaxBytesError
+	var syntax *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &tooLarge):
+		writeError(w, r, newError(CodeTooLarge, "Body exceeds %d bytes", tooLarge.Limit))
+	case errors.As(err, &syntax), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		writeError(w, r, newError(CodeInvalidInput, "Invalid JSON"))
+	case errors.As(err, &typeErr):
+		writeError(w, r, newError(CodeInvalidInput, "Invalid JSON: %s must be %s", typeErr.Field, typeErr.Type))
+	default:
+		// Unknown fields and trailing data
+		writeError(w, r, newError(CodeInvalidInput, "Invalid JSON: %v", err))
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDecodeJSON(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		max    int64
+		status int
+		detail string
+	}{
+		{"valid", `{"url": "https://example.com", "tags": ["a"], "folderId": 3}`, maxBodyBytes, 0, ""},
+		{"unknown field", `{"url": "https://example.com", "shortCode": "abc"}`, maxBodyBytes, 400, "unknown field"},
+		{"trailing data", `{"url": "https://example.com"} {}`, maxBodyBytes, 400, "single JSON value"},
+		{"wrong type", `{"url": "https://example.com", "folderId": "3"}`, maxBodyBytes, 400, "folderId must be int64"},
+		{"syntax error", `{"url": `, maxBodyBytes, 400, "Invalid JSON"},
+		{"empty body", ``, maxBodyBytes, 400, "Invalid JSON"},
+		{"too large", `{"url": "https://example.com/` + strings.Repeat("a", 64) + `"}`, 32, 413, "exceeds 32 bytes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/link/create", strings.NewReader(tt.body))
+
+			var req CreateRequest
+			ok := decodeJSON(w, r, &req, tt.max)
+			if tt.status == 0 {
+				if !ok {
+					t.Fatalf("decodeJSON rejected a valid body: %s", w.Body)
+				}
+				if req.URL != "https://example.com" || len(req.Tags) != 1 || req.FolderID == nil || *req.FolderID != 3 {
+					t.Errorf("decoded %+v", req)
+				}
+				return
+			}
+
+			if ok {
+				t.Fatal("decodeJSON accepted the body")
+			}
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			var problem Problem
+			if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+				t.Fatalf("decoding problem: %v", err)
+			}
+			if !strings.Contains(problem.Detail, tt.detail) {
+				t.Errorf("detail = %q, want it to contain %q", problem.Detail, tt.detail)
+			}
+		})
+	}
+}
@@ -0,0 +1,423 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// apiParam is a query parameter of an operation
+type apiParam struct {
+	name        string
+	kind        string
+	description string
+}
+
+// apiOperation documents one route. Request and response bodies are JSON
+// unless media types are given.
+type apiOperation struct {
+	method  string
+	path    string
+	summary string
+	query   []apiParam
+	// request is a value of the JSON body type, or nil
+	request any
+	// requestTypes are the media types of a non-JSON body
+	requestTypes []string
+	status       int
+	// response is a value of the JSON response type, or nil
+	response any
+	// responseTypes are the media types of a non-JSON response
+	responseTypes []string
+	errors        []int
+}
+
+// apiOperations lists every route served by Router and LinkRouter. Keep it
+// in step with the routes: the OpenAPI document is generated from it.
+var apiOperations = []apiOperation{
+	{method: "GET", path: "/link", summary: "List and search links",
+		query: []apiParam{
+			{"owner", "string", "Only links of this owner"},
+			{"tag", "string", "Only links with this tag"},
+			{"folder", "integer", "Only links in this folder or its subfolders"},
+			{"q", "string", "Words or a URL fragment of the destination, title, description or notes"},
+			{"created_after", "string", "RFC 3339 time or YYYY-MM-DD"},
+			{"created_before", "string", "RFC 3339 time or YYYY-MM-DD"},
+			{"sort", "string", "created or clicks, descending"},
+			{"cursor", "string", "next_cursor of the previous page"},
+			{"limit", "integer", "Links per page"},
+		},
+		status: http.StatusOK, response: LinkList{}, errors: []int{400}},
+	{method: "POST", path: "/link/create", summary: "Create a short link",
+		request: CreateRequest{}, status: http.StatusOK, response: CreateResponse{}, errors: []int{400, 403, 413}},
+	{method: "POST", path: "/link/bulk", summary: "Create many plain links",
+		request: BulkRequest{}, status: http.StatusOK, response: BulkResponse{}, errors: []int{400, 413}},
+	{method: "GET", path: "/link/export", summary: "Export links as CSV or JSON Lines",
+		query: []apiParam{
+			{"format", "string", "csv or jsonl"},
+			{"owner", "string", "Only links of this owner"},
+			{"tag", "string", "Only links with this tag"},
+			{"folder", "integer", "Only links in this folder or its subfolders"},
+			{"created_after", "string", "RFC 3339 time"},
+			{"created_before", "string", "RFC 3339 time"},
+		},
+		status: http.StatusOK, responseTypes: []string{"application/x-ndjson", "text/csv"}, errors: []int{400}},
+	{method: "POST", path: "/link/import", summary: "Import links from CSV or JSON Lines",
+		query: []apiParam{
+			{"format", "string", "csv or jsonl, from the Content-Type by default"},
+			{"on_conflict", "string", "skip, overwrite or fail"},
+			{"start_line", "integer", "Resume after this line"},
+		},
+		requestTypes: []string{"application/x-ndjson", "text/csv"},
+		status:       http.StatusOK, response: ImportReport{}, errors: []int{400, 409, 500}},
+	{method: "POST", path: "/link/move", summary: "Move links into a folder or out of their folders",
+		request: MoveRequest{}, status: http.StatusOK, response: MoveResult{}, errors: []int{400, 404, 413}},
+	{method: "GET", path: "/link/{code}/details", summary: "Title, description, notes, tags and folder of a link",
+		status: http.StatusOK, response: LinkDetails{}, errors: []int{404}},
+	{method: "PATCH", path: "/link/{code}", summary: "Change the title, description or notes of a link",
+		request: DetailsUpdate{}, status: http.StatusOK, response: LinkDetails{}, errors: []int{400, 404}},
+	{method: "DELETE", path: "/link/{code}", summary: "Delete a link with its recorded clicks",
+		status: http.StatusNoContent, errors: []int{404}},
+	{method: "POST", path: "/link/{code}/tags", summary: "Tag a link",
+		request: TagsRequest{}, status: http.StatusOK, response: TagsRequest{}, errors: []int{400, 404}},
+	{method: "DELETE", path: "/link/{code}/tags/{tag}", summary: "Untag a link",
+		status: http.StatusOK, response: TagsRequest{}, errors: []int{404}},
+	{method: "GET", path: "/link/{code}/qr", summary: "Render the QR code of a link",
+		query: []apiParam{
+			{"format", "string", "png or svg"},
+			{"size", "integer", "Width in pixels"},
+			{"margin", "integer", "Quiet zone in modules"},
+			{"logo", "boolean", "Draw the configured logo"},
+			{"ecc", "string", "Error correction level: L, M, Q or H"},
+			{"fg", "string", "Foreground hex color"},
+			{"bg", "string", "Background hex color"},
+		},
+		status: http.StatusOK, responseTypes: []string{"image/png", "image/svg+xml"}, errors: []int{400, 403, 404}},
+	{method: "GET", path: "/link/{code}/rules", summary: "List the routing rules of a link",
+		status: http.StatusOK, response: RuleSet{}, errors: []int{404}},
+	{method: "PUT", path: "/link/{code}/rules", summary: "Replace the routing rules of a link",
+		request: RuleSet{}, status: http.StatusOK, response: RuleSet{}, errors: []int{400, 403, 404}},
+	{method: "POST", path: "/link/{code}/rules/dry-run", summary: "Evaluate routing rules against a synthetic request",
+		request: DryRunRequest{}, status: http.StatusOK, response: DryRunResult{}, errors: []int{400, 404}},
+	{method: "POST", path: "/link/{code}/rules/{rule}/dry-run", summary: "Evaluate one routing rule by index or name",
+		request: DryRunRequest{}, status: http.StatusOK, response: DryRunResult{}, errors: []int{400, 404}},
+	{method: "GET", path: "/link/{path}", summary: "Resolve a link, counting a click",
+		status: http.StatusOK, response: Link{}, errors: []int{400, 404, 410}},
+
+	{method: "GET", path: "/stats/campaigns", summary: "Clicks by campaign, or the links of one campaign",
+		query: []apiParam{
+			{"owner", "string", "Only links of this owner"},
+			{"campaign", "string", "List the links of this campaign"},
+			{"limit", "integer", "Maximum number of results"},
+		},
+		status: http.StatusOK, response: []CampaignStats{}, errors: []int{400}},
+	{method: "GET", path: "/stats/tags", summary: "Links and clicks by tag",
+		query: []apiParam{
+			{"owner", "string", "Only links of this owner"},
+			{"limit", "integer", "Maximum number of tags"},
+		},
+		status: http.StatusOK, response: []TagStats{}, errors: []int{400}},
+	{method: "GET", path: "/stats/folders", summary: "Links and clicks by folder, including subfolders",
+		query:  []apiParam{{"owner", "string", "Owner of the folders"}},
+		status: http.StatusOK, response: []FolderStats{}},
+	{method: "GET", path: "/stats/{id}", summary: "Click statistics of a link",
+		query: []apiParam{
+			{"from", "string", "First UTC day of the unique visitor count, YYYY-MM-DD"},
+			{"to", "string", "Last UTC day of the unique visitor count, YYYY-MM-DD"},
+		},
+		status: http.StatusOK, response: LinkStats{}, errors: []int{400, 404}},
+	{method: "GET", path: "/stats/{id}/devices", summary: "Clicks by browser, OS and device",
+		status: http.StatusOK, response: map[string]any{}, errors: []int{404}},
+	{method: "GET", path: "/stats/{id}/referrers", summary: "Clicks by referrer and channel",
+		query:  []apiParam{{"limit", "integer", "Maximum number of referrers"}},
+		status: http.StatusOK, response: map[string]any{}, errors: []int{400, 404}},
+	{method: "GET", path: "/stats/{id}/timeseries", summary: "Clicks over time",
+		query: []apiParam{
+			{"interval", "string", "hour, day, week or month"},
+			{"from", "string", "RFC 3339 time or YYYY-MM-DD"},
+			{"to", "string", "RFC 3339 time or YYYY-MM-DD"},
+			{"tz", "string", "IANA time zone of the buckets"},
+		},
+		status: http.StatusOK, response: map[string]any{}, errors: []int{400, 404}},
+	{method: "GET", path: "/owners/{owner}/settings", summary: "Settings of an owner",
+		status: http.StatusOK, response: OwnerSettings{}},
+	{method: "PUT", path: "/owners/{owner}/settings", summary: "Replace the settings of an owner",
+		request: OwnerSettings{}, status: http.StatusOK, response: OwnerSettings{}, errors: []int{400}},
+	{method: "GET", path: "/owners/{owner}/utm-presets", summary: "List the UTM presets of an owner",
+		status: http.StatusOK, response: []UTMPreset{}},
+	{method: "PUT", path: "/owners/{owner}/utm-presets/{name}", summary: "Save a UTM preset",
+		request: UTM{}, status: http.StatusOK, response: UTMPreset{}, errors: []int{400}},
+	{method: "DELETE", path: "/owners/{owner}/utm-presets/{name}", summary: "Delete a UTM preset",
+		status: http.StatusNoContent, errors: []int{404}},
+	{method: "POST", path: "/folders", summary: "Create a folder",
+		request: Folder{}, status: http.StatusCreated, response: Folder{}, errors: []int{400, 404, 409}},
+	{method: "GET", path: "/folders", summary: "List the folders of an owner",
+		query:  []apiParam{{"owner", "string", "Owner of the folders"}},
+		status: http.StatusOK, response: []Folder{}},
+	{method: "DELETE", path: "/folders/{id}", summary: "Delete a folder and its subfolders, keeping their links",
+		status: http.StatusNoContent, errors: []int{404}},
+	{method: "POST", path: "/webhooks", summary: "Register a webhook endpoint",
+		request: WebhookEndpoint{}, status: http.StatusCreated, response: WebhookEndpoint{}, errors: []int{400}},
+	{method: "GET", path: "/webhooks", summary: "List the webhook endpoints of an owner",
+		query:  []apiParam{{"owner", "string", "Owner of the endpoints"}},
+		status: http.StatusOK, response: []WebhookEndpoint{}, errors: []int{400}},
+	{method: "DELETE", path: "/webhooks/{id}", summary: "Delete a webhook endpoint",
+		status: http.StatusNoContent, errors: []int{404}},
+	{method: "GET", path: "/webhooks/{id}/deliveries", summary: "Delivery log of a webhook endpoint",
+		query: []apiParam{
+			{"status", "string", "pending, delivered or dead"},
+			{"limit", "integer", "Maximum number of deliveries"},
+		},
+		status: http.StatusOK, response: []WebhookDelivery{}, errors: []int{400, 404}},
+	{method: "POST", path: "/webhooks/{id}/deliveries/{delivery}/retry", summary: "Queue a delivery again",
+		status: http.StatusAccepted, errors: []int{404}},
+	{method: "GET", path: "/status", summary: "Service status",
+		status: http.StatusOK, response: map[string]any{}},
+	{method: "GET", path: "/.well-known/apple-app-site-association", summary: "iOS universal link association",
+		status: http.StatusOK, response: map[string]any{}, errors: []int{404}},
+	{method: "GET", path: "/apple-app-site-association", summary: "iOS universal link association",
+		status: http.StatusOK, response: map[string]any{}, errors: []int{404}},
+	{method: "GET", path: "/.well-known/assetlinks.json", summary: "Android App Links association",
+		status: http.StatusOK, response: []map[string]any{}, errors: []int{404}},
+	{method: "GET", path: "/openapi.json", summary: "This document",
+		status: http.StatusOK, response: map[string]any{}},
+}
+
+// pathParam matches the parameters of a route path
+var pathParam = regexp.MustCompile(`\{([^}]+)\}`)
+
+// OpenAPI serves the OpenAPI 3 document of the HTTP API
+type OpenAPI struct {
+	title    string
+	version  string
+	document func() ([]byte, error)
+}
+
+// NewOpenAPI creates the OpenAPI document of the API. It is built on first
+// use.
+func NewOpenAPI(title, version string) *OpenAPI {
+	o := &OpenAPI{title: title, version: version}
+	o.document = sync.OnceValues(func() ([]byte, error) {
+		return json.Marshal(o.build())
+	})
+	return o
+}
+
+// Document returns the encoded document
+func (o *OpenAPI) Document() ([]byte, error) {
+	return o.document()
+}
+
+// build assembles the document from apiOperations
+func (o *OpenAPI) build() map[string]any {
+	schemas := &schemaRegistry{components: map[string]any{}}
+	paths := map[string]map[string]any{}
+	for _, op := range apiOperations {
+		operation := map[string]any{
+			"summary":     op.summary,
+			"operationId": operationID(op),
+		}
+
+		var params []map[string]any
+		for _, m := range pathParam.FindAllStringSubmatch(op.path, -1) {
+			params = append(params, map[string]any{
+				"name": m[1], "in": "path", "required": true, "schema": map[string]any{"type": "string"},
+			})
+		}
+		for _, p := range op.query {
+			params = append(params, map[string]any{
+				"name": p.name, "in": "query", "description": p.description, "schema": map[string]any{"type": p.kind},
+			})
+		}
+		if len(params) > 0 {
+			operation["parameters"] = params
+		}
+
+		if op.request != nil {
+			operation["requestBody"] = map[string]any{
+				"required": true,
+				"content":  map[string]any{"application/json": map[string]any{"schema": schemas.schema(reflect.TypeOf(op.request))}},
+			}
+		} else if len(op.requestTypes) > 0 {
+			content := map[string]any{}
+			for _, mediaType := range op.requestTypes {
+				content[mediaType] = map[string]any{"schema": map[string]any{"type": "string"}}
+			}
+			operation["requestBody"] = map[string]any{"required": true, "content": content}
+		}
+
+		responses := map[string]any{}
+		success := map[string]any{"description": http.StatusText(op.status)}
+		if op.response != nil {
+			success["content"] = map[string]any{"application/json": map[string]any{"schema": schemas.schema(reflect.TypeOf(op.response))}}
+		} else if len(op.responseTypes) > 0 {
+			content := map[string]any{}
+			for _, mediaType := range op.responseTypes {
+				content[mediaType] = map[string]any{"schema": map[string]any{"type": "string", "format": "binary"}}
+			}
+			success["content"] = content
+		}
+		responses[strconv.Itoa(op.status)] = success
+		for _, code := range op.errors {
+			responses[strconv.Itoa(code)] = map[string]any{"$ref": "#/components/responses/Error"}
+		}
+		// Any operation may fail with internal or unavailable errors
+		responses["default"] = map[string]any{"$ref": "#/components/responses/Error"}
+		operation["responses"] = responses
+
+		if paths[op.path] == nil {
+			paths[op.path] = map[string]any{}
+		}
+		paths[op.path][strings.ToLower(op.method)] = operation
+	}
+
+	problem := schemas.schema(reflect.TypeOf(Problem{}))
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info":    map[string]any{"title": o.title, "version": o.version},
+		"paths":   paths,
+		"components": map[string]any{
+			"schemas": schemas.components,
+			"responses": map[string]any{
+				"Error": map[string]any{
+					"description": "RFC 7807 problem details",
+					"content":     map[string]any{"application/problem+json": map[string]any{"schema": problem}},
+				},
+			},
+		},
+	}
+}
+
+// operationID derives a unique operation name from the method and path
+func operationID(op apiOperation) string {
+	id := strings.ToLower(op.method)
+	for _, part := range strings.FieldsFunc(op.path, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		id += strings.ToUpper(part[:1]) + part[1:]
+	}
+	return id
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// schemaRegistry derives JSON schemas from Go types the way encoding/json
+// encodes them. Named structs become shared components.
+type schemaRegistry struct {
+	components map[string]any
+}
+
+// schema returns the schema of t, registering the structs it refers to
+func (s *schemaRegistry) schema(t reflect.Type) map[string]any {
+	switch t {
+	case timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case rawMessageType:
+		return map[string]any{}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return s.schema(t.Elem())
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]any{"type": "integer"}
+	case reflect.Int64, reflect.Uint, reflect.Uint64:
+		return map[string]any{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "format": "byte"}
+		}
+		return map[string]any{"type": "array", "items": s.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": s.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.object(t)
+		}
+		name := []rune(t.Name())
+		name[0] = unicode.ToUpper(name[0])
+		ref := map[string]any{"$ref": "#/components/schemas/" + string(name)}
+		if _, ok := s.components[string(name)]; !ok {
+			// Registered before building so recursive types terminate
+			s.components[string(name)] = map[string]any{}
+			s.components[string(name)] = s.object(t)
+		}
+		return ref
+	}
+	return map[string]any{}
+}
+
+// object returns the schema of a struct. Unknown properties are rejected
+// like decodeJSON does, and fields tagged openapi:"required" are required.
+func (s *schemaRegistry) object(t reflect.Type) map[string]any {
+	properties := map[string]any{}
+	required := s.addFields(t, properties, nil)
+	schema := map[string]any{"type": "object", "properties": properties, "additionalProperties": false}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	if c, ok := reflect.Zero(t).Interface().(schemaConstrainer); ok {
+		c.constrainSchema(schema)
+	}
+	return schema
+}
+
+// schemaConstrainer is implemented by types whose constraints span several
+// properties and cannot be expressed through field tags
+type schemaConstrainer interface {
+	constrainSchema(schema map[string]any)
+}
+
+// addFields adds the JSON properties of struct t, flattening embedded
+// structs, and returns required with the required properties appended
+func (s *schemaRegistry) addFields(t reflect.Type, properties map[string]any, required []string) []string {
+	for i := range t.NumField() {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			embedded := f.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				required = s.addFields(embedded, properties, required)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		schema := s.schema(f.Type)
+		// Pointers encode nil as null unless they are omitted
+		if _, ref := schema["$ref"]; f.Type.Kind() == reflect.Pointer && !ref && !strings.Contains(options, "omitempty") {
+			schema["nullable"] = true
+		}
+		properties[name] = schema
+		if f.Tag.Get("openapi") == "required" {
+			required = append(required, name)
+		}
+	}
+	return required
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// openAPIDocument builds and decodes the OpenAPI document
+func openAPIDocument(t *testing.T) map[string]any {
+	t.Helper()
+	body, err := NewOpenAPI("SmolEarl", "test").Document()
+	if err != nil {
+		t.Fatalf("Document: %v", err)
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(body, &doc); err != nil {
+		t.Fatalf("decoding document: %v", err)
+	}
+	return doc
+}
+
+// routePattern matches the routes registered in router.go
+var routePattern = regexp.MustCompile(`mux\.HandleFunc\("([A-Z]+) ([^"]+)"`)
+
+func TestOpenAPIDocumentsEveryRoute(t *testing.T) {
+	source, err := os.ReadFile("router.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// GET /link is registered in main next to the LinkRouter mount
+	routes := []string{"GET /link"}
+	router, linkRouter, _ := strings.Cut(string(source), "func (r *LinkRouter) Init()")
+	for _, m := range routePattern.FindAllStringSubmatch(router, -1) {
+		routes = append(routes, m[1]+" "+m[2])
+	}
+	for _, m := range routePattern.FindAllStringSubmatch(linkRouter, -1) {
+		routes = append(routes, m[1]+" /link"+m[2])
+	}
+
+	var documented []string
+	ids := map[string]bool{}
+	for _, op := range apiOperations {
+		documented = append(documented, op.method+" "+op.path)
+		id := operationID(op)
+		if ids[id] {
+			t.Errorf("operationId %s is not unique", id)
+		}
+		ids[id] = true
+	}
+	for _, route := range routes {
+		if !slices.Contains(documented, route) {
+			t.Errorf("route %s is not documented", route)
+		}
+	}
+	for _, op := range documented {
+		if !slices.Contains(routes, op) {
+			t.Errorf("documented operation %s is not routed", op)
+		}
+	}
+}
+
+func TestOpenAPIOperationsReachTheirRoutes(t *testing.T) {
+	router := NewRouter(nil).Init()
+	linkRouter := NewLinkRouter(nil).Init()
+	for _, op := range apiOperations {
+		if op.path == "/link" {
+			continue
+		}
+		target := pathParam.ReplaceAllString(op.path, "x")
+		mux, want := router, op.path
+		if rest, ok := strings.CutPrefix(target, "/link/"); ok {
+			mux, target, want = linkRouter, "/"+rest, strings.TrimPrefix(op.path, "/link")
+		}
+		_, pattern := mux.Handler(httptest.NewRequest(op.method, target, nil))
+		if pattern != op.method+" "+want {
+			t.Errorf("%s %s is served by %q", op.method, op.path, pattern)
+		}
+	}
+}
+
+func TestOpenAPIRequestSchemas(t *testing.T) {
+	doc := openAPIDocument(t)
+	schemas := doc["components"].(map[string]any)["schemas"].(map[string]any)
+
+	tests := []struct {
+		schema     string
+		properties []string
+	}{
+		{"CreateRequest", []string{"url", "customAlias", "owner", "destinations", "sticky", "deepLink", "utm",
+			"utmPreset", "dedupe", "expiresAt", "title", "description", "notes", "tags", "folderId"}},
+		{"DestinationRequest", []string{"variant", "url", "weight"}},
+		{"BulkRequest", []string{"items"}},
+		{"BulkItem", []string{"url", "customAlias", "owner", "metadata", "title", "description", "notes", "tags",
+			"folderId"}},
+		{"RuleSet", []string{"rules"}},
+		{"Problem", []string{"type", "title", "status", "detail", "instance", "code", "request_id"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.schema, func(t *testing.T) {
+			schema, ok := schemas[tt.schema].(map[string]any)
+			if !ok {
+				t.Fatalf("schema %s is missing", tt.schema)
+			}
+			// Strict decoding rejects unknown fields, so the schema must too
+			if schema["additionalProperties"] != false {
+				t.Errorf("additionalProperties = %v, want false", schema["additionalProperties"])
+			}
+			var got []string
+			for name := range schema["properties"].(map[string]any) {
+				got = append(got, name)
+			}
+			slices.Sort(got)
+			want := slices.Sorted(slices.Values(tt.properties))
+			if !slices.Equal(got, want) {
+				t.Errorf("properties = %v, want %v", got, want)
+			}
+		})
+	}
+
+	create := schemas["CreateRequest"].(map[string]any)["properties"].(map[string]any)
+	checks := map[string]map[string]any{
+		"folderId": {"type": "integer", "format": "int64"},
+		"dedupe":   {"type": "boolean"},
+		"tags":     {"type": "array", "items": map[string]any{"type": "string"}},
+		"deepLink": {"$ref": "#/components/schemas/DeepLink"},
+	}
+	for name, want := range checks {
+		got, _ := json.Marshal(create[name])
+		wantJSON, _ := json.Marshal(want)
+		if string(got) != string(wantJSON) {
+			t.Errorf("CreateRequest.%s = %s, want %s", name, got, wantJSON)
+		}
+	}
+}
+
+func TestOpenAPIReferencesResolve(t *testing.T) {
+	doc := openAPIDocument(t)
+	components := doc["components"].(map[string]any)
+
+	var walk func(v any)
+	walk = func(v any) {
+		switch v := v.(type) {
+		case map[string]any:
+			if ref, ok := v["$ref"].(string); ok {
+				parts := strings.Split(strings.TrimPrefix(ref, "#/components/"), "/")
+				if len(parts) != 2 {
+					t.Errorf("unexpected $ref %s", ref)
+				} else if _, ok := components[parts[0]].(map[string]any)[parts[1]]; !ok {
+					t.Errorf("$ref %s does not resolve", ref)
+				}
+			}
+			for _, child := range v {
+				walk(child)
+			}
+		case []any:
+			for _, child := range v {
+				walk(child)
+			}
+		}
+	}
+	walk(doc)
+
+	create := doc["paths"].(map[string]any)["/link/create"].(map[string]any)["post"].(map[string]any)
+	responses := create["responses"].(map[string]any)
+	for _, code := range []string{"200", "400", "403", "413", "default"} {
+		if _, ok := responses[code]; !ok {
+			t.Errorf("POST /link/create has no %s response", code)
+		}
+	}
+	if _, ok := create["requestBody"]; !ok {
+		t.Error("POST /link/create has no request body")
+	}
+}
+
+// servedOpenAPI fetches /openapi.json from the router and loads it with an
+// OpenAPI validator
+func servedOpenAPI(t *testing.T) *openapi3.T {
+	t.Helper()
+	server := httptest.NewServer(NewRouter(NewController(nil)).Init())
+	defer server.Close()
+	resp, err := http.Get(server.URL + "/openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc, err := openapi3.NewLoader().LoadFromData(body)
+	if err != nil {
+		t.Fatalf("loading /openapi.json: %v", err)
+	}
+	if err := doc.Validate(context.Background()); err != nil {
+		t.Fatalf("/openapi.json is not a valid OpenAPI document: %v", err)
+	}
+	return doc
+}
+
+func TestOpenAPIValidatesRequestBodies(t *testing.T) {
+	doc := servedOpenAPI(t)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		valid  bool
+	}{
+		{"create", "POST", "/link/create", `{"url": "https://example.com", "owner": "ann", "tags": ["a"], "folderId": 3,
+			"expiresAt": "2030-01-01T00:00:00Z", "deepLink": {"ios": "app://x"}, "utm": {"source": "news"}}`, true},
+		{"create split", "POST", "/link/create", `{"destinations": [{"url": "https://a.example"},
+			{"variant": "b", "url": "https://b.example", "weight": 2}], "sticky": "cookie"}`, true},
+		{"create with unknown field", "POST", "/link/create", `{"url": "https://example.com", "shortCode": "abc"}`, false},
+		{"create without url", "POST", "/link/create", `{"owner": "ann"}`, false},
+		{"create with url and destinations", "POST", "/link/create",
+			`{"url": "https://example.com", "destinations": [{"url": "https://a.example"}, {"url": "https://b.example"}]}`, false},
+		{"create with wrong type", "POST", "/link/create", `{"url": "https://example.com", "folderId": "3"}`, false},
+		{"destination without url", "POST", "/link/create", `{"destinations": [{"variant": "a"}, {"variant": "b"}]}`, false},
+		{"bulk", "POST", "/link/bulk", `{"items": [{"url": "https://example.com", "tags": ["a"]}]}`, true},
+		{"bulk item without url", "POST", "/link/bulk", `{"items": [{"customAlias": "abc"}]}`, false},
+		{"bulk without items", "POST", "/link/bulk", `{}`, false},
+		{"move", "POST", "/link/move", `{"links": ["abc"], "folderId": 3}`, true},
+		{"move out of folders", "POST", "/link/move", `{"links": ["abc"], "folderId": null}`, true},
+		{"move without links", "POST", "/link/move", `{"folderId": 3}`, false},
+		{"rules", "PUT", "/link/{code}/rules", `{"rules": [{"destination": "https://example.com",
+			"match": {"countries": ["GB"], "time": {"from": "09:00", "to": "17:00"}}}]}`, true},
+		{"rule without destination", "PUT", "/link/{code}/rules", `{"rules": [{"match": {"countries": ["GB"]}}]}`, false},
+		{"folder", "POST", "/folders", `{"owner": "ann", "name": "Campaigns", "parentId": 1}`, true},
+		{"folder without name", "POST", "/folders", `{"owner": "ann"}`, false},
+		{"webhook", "POST", "/webhooks", `{"owner": "ann", "url": "https://hooks.example", "events": ["link.created"]}`, true},
+		{"webhook without events", "POST", "/webhooks", `{"owner": "ann", "url": "https://hooks.example"}`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := doc.Paths.Find(tt.path)
+			if path == nil || path.GetOperation(tt.method) == nil {
+				t.Fatalf("%s %s is not documented", tt.method, tt.path)
+			}
+			body := path.GetOperation(tt.method).RequestBody.Value.Content.Get("application/json")
+			if body == nil {
+				t.Fatalf("%s %s has no JSON request body", tt.method, tt.path)
+			}
+			var value any
+			if err := json.Unmarshal([]byte(tt.body), &value); err != nil {
+				t.Fatalf("decoding sample: %v", err)
+			}
+
+			err := body.Schema.Value.VisitJSON(value)
+			if tt.valid && err != nil {
+				t.Errorf("valid body rejected: %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Error("invalid body accepted")
+			}
+		})
+	}
+}
@@ -0,0 +1,408 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	// ErrInvalidDetails wraps validation failures of titles, notes, tags and
+	// folders
+	ErrInvalidDetails = newError(CodeInvalidInput, "invalid link details")
+	// ErrFolderNotFound is returned for unknown folder IDs
+	ErrFolderNotFound = newError(CodeNotFound, "folder not found")
+)
+
+const (
+	maxTitleLength       = 200
+	maxDescriptionLength = 1000
+	maxNotesLength       = 10000
+	// maxTags and maxTagLength bound the tags of a link
+	maxTags      = 50
+	maxTagLength = 64
+	// maxFolderNameLength and maxFolderDepth bound folders
+	maxFolderNameLength = 100
+	maxFolderDepth      = 10
+	// maxMoveLinks caps a single bulk move
+	maxMoveLinks = 1000
+	// defaultTagStatsLimit and maxTagStatsLimit bound ?limit= on the tag stats
+	defaultTagStatsLimit = 50
+	maxTagStatsLimit     = 1000
+)
+
+// LinkDetails describe a link for its owner. They never affect resolves.
+type LinkDetails struct {
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Notes       string   `json:"notes"`
+	Tags        []string `json:"tags"`
+	// FolderID is nil for links outside any folder
+	FolderID *int64 `json:"folderId"`
+}
+
+// DetailsUpdate is the body of PATCH /link/{code}. Omitted fields are kept.
+type DetailsUpdate struct {
+	Title       *string `json:"title,omitempty"`
+	Description *string `json:"description,omitempty"`
+	Notes       *string `json:"notes,omitempty"`
+}
+
+// TagsRequest is the body of POST /link/{code}/tags
+type TagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+// MoveRequest is the body of POST /link/move. A nil FolderID takes the
+// links out of their folders.
+type MoveRequest struct {
+	Links    []string `json:"links" openapi:"required"`
+	FolderID *int64   `json:"folderId"`
+}
+
+// MoveResult reports a bulk move. Skipped links do not exist or belong to
+// another owner than the folder.
+type MoveResult struct {
+	Moved   int      `json:"moved"`
+	Skipped []string `json:"skipped"`
+}
+
+// Folder groups links of an owner. Folders nest through ParentID.
+type Folder struct {
+	ID        int64     `json:"id"`
+	Owner     string    `json:"owner"`
+	Name      string    `json:"name" openapi:"required"`
+	ParentID  *int64    `json:"parentId,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// TagStats aggregates the links with a tag
+type TagStats struct {
+	Tag    string `json:"tag"`
+	Links  int    `json:"links"`
+	Clicks int64  `json:"clicks"`
+}
+
+// FolderStats aggregates the links of a folder and of its subfolders
+type FolderStats struct {
+	FolderID int64  `json:"folderId"`
+	Name     string `json:"name"`
+	ParentID *int64 `json:"parentId,omitempty"`
+	Links    int    `json:"links"`
+	Clicks   int64  `json:"clicks"`
+}
+
+// detailsFromRequest validates the details of a create request
+func (s *Service) detailsFromRequest(ctx context.Context, req CreateRequest) (LinkDetails, error) {
+	details := LinkDetails{
+		Title:       req.Title,
+		Description: req.Description,
+		Notes:       req.Notes,
+		Tags:        req.Tags,
+		FolderID:    req.FolderID,
+	}
+	if err := validateDetails(&details); err != nil {
+		return LinkDetails{}, err
+	}
+	if err := s.checkFolder(ctx, details.FolderID, req.Owner); err != nil {
+		return LinkDetails{}, err
+	}
+	return details, nil
+}
+
+// checkText validates a free-text field
+func checkText(field, value string, maxLength int) error {
+	if !utf8.ValidString(value) {
+		return fmt.Errorf("%w: %s is not valid UTF-8", ErrInvalidDetails, field)
+	}
+	if utf8.RuneCountInString(value) > maxLength {
+		return fmt.Errorf("%w: %s is longer than %d characters", ErrInvalidDetails, field, maxLength)
+	}
+	return nil
+}
+
+// normalizeTags trims tags and drops duplicates, keeping their order. Tags
+// may not contain commas, which separate them in CSV exports.
+func normalizeTags(tags []string) ([]string, error) {
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			return nil, fmt.Errorf("%w: tags must not be empty", ErrInvalidDetails)
+		}
+		if utf8.RuneCountInString(tag) > maxTagLength {
+			return nil, fmt.Errorf("%w: tag %q is longer than %d characters", ErrInvalidDetails, tag, maxTagLength)
+		}
+		if strings.ContainsRune(tag, ',') || strings.ContainsFunc(tag, unicode.IsControl) || !utf8.ValidString(tag) {
+			return nil, fmt.Errorf("%w: tag %q contains a comma or control character", ErrInvalidDetails, tag)
+		}
+		if !slices.Contains(normalized, tag) {
+			normalized = append(normalized, tag)
+		}
+	}
+	if len(normalized) > maxTags {
+		return nil, fmt.Errorf("%w: at most %d tags are allowed", ErrInvalidDetails, maxTags)
+	}
+	return normalized, nil
+}
+
+// validateDetails normalizes the tags of d and checks its text fields
+func validateDetails(d *LinkDetails) error {
+	if err := checkText("title", d.Title, maxTitleLength); err != nil {
+		return err
+	}
+	if err := checkText("description", d.Description, maxDescriptionLength); err != nil {
+		return err
+	}
+	if err := checkText("notes", d.Notes, maxNotesLength); err != nil {
+		return err
+	}
+	tags, err := normalizeTags(d.Tags)
+	if err != nil {
+		return err
+	}
+	d.Tags = tags
+	return nil
+}
+
+// liftDetails moves the title, description, notes and tags keys of metadata,
+// where links kept them before they had their own fields, into d unless d
+// already sets them
+func liftDetails(metadata map[string]any, d *LinkDetails) {
+	for key, field := range map[string]*string{"title": &d.Title, "description": &d.Description, "notes": &d.Notes} {
+		if value, ok := metadata[key].(string); ok {
+			if *field == "" {
+				*field = value
+			}
+			delete(metadata, key)
+		}
+	}
+	if values, ok := metadata["tags"].([]any); ok {
+		if len(d.Tags) == 0 {
+			for _, value := range values {
+				if tag, ok := value.(string); ok {
+					d.Tags = append(d.Tags, tag)
+				}
+			}
+		}
+		delete(metadata, "tags")
+	}
+}
+
+// checkFolder verifies that folderID, if set, is a folder of owner
+func (s *Service) checkFolder(ctx context.Context, folderID *int64, owner string) error {
+	if folderID == nil {
+		return nil
+	}
+	folder, err := s.repo.GetFolder(ctx, *folderID)
+	if err != nil {
+		return fmt.Errorf("failed to load folder: %w", err)
+	}
+	if folder == nil {
+		return fmt.Errorf("%w: folder %d does not exist", ErrInvalidDetails, *folderID)
+	}
+	if folder.Owner != owner {
+		return fmt.Errorf("%w: folder %d belongs to another owner", ErrInvalidDetails, *folderID)
+	}
+	return nil
+}
+
+// GetDetails returns the title, description, notes, tags and folder of a link
+func (s *Service) GetDetails(ctx context.Context, shortCode string) (LinkDetails, error) {
+	details, err := s.repo.GetDetails(ctx, shortCode)
+	if err != nil {
+		return LinkDetails{}, fmt.Errorf("failed to query PostgreSQL: %w", err)
+	}
+	if details == nil {
+		return LinkDetails{}, ErrEntryNotFound
+	}
+	return *details, nil
+}
+
+// UpdateDetails changes the title, description or notes of a link
+func (s *Service) UpdateDetails(ctx context.Context, shortCode string, update DetailsUpdate) (LinkDetails, error) {
+	for _, field := range []struct {
+		name      string
+		value     *string
+		maxLength int
+	}{
+		{"title", update.Title, maxTitleLength},
+		{"description", update.Description, maxDescriptionLength},
+		{"notes", update.Notes, maxNotesLength},
+	} {
+		if field.value != nil {
+			if err := checkText(field.name, *field.value, field.maxLength); err != nil {
+				return LinkDetails{}, err
+			}
+		}
+	}
+
+	found, err := s.repo.UpdateDetails(ctx, shortCode, update)
+	if err != nil {
+		return LinkDetails{}, fmt.Errorf("failed to store in PostgreSQL: %w", err)
+	}
+	if !found {
+		return LinkDetails{}, ErrEntryNotFound
+	}
+	s.emitDetailsEvent(ctx, shortCode, "details")
+	return s.GetDetails(ctx, shortCode)
+}
+
+// AddTags tags a link and returns all of its tags
+func (s *Service) AddTags(ctx context.Context, shortCode string, tags []string) ([]string, error) {
+	tags, err := normalizeTags(tags)
+	if err != nil {
+		return nil, err
+	}
+	if len(tags) == 0 {
+		return nil, fmt.Errorf("%w: no tags", ErrInvalidDetails)
+	}
+	all, found, err := s.repo.AddTags(ctx, shortCode, tags, maxTags)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store in PostgreSQL: %w", err)
+	}
+	if !found {
+		return nil, ErrEntryNotFound
+	}
+	if len(all) > maxTags {
+		return nil, fmt.Errorf("%w: at most %d tags are allowed", ErrInvalidDetails, maxTags)
+	}
+	s.emitDetailsEvent(ctx, shortCode, "tags")
+	return all, nil
+}
+
+// RemoveTag untags a link and returns its remaining tags
+func (s *Service) RemoveTag(ctx context.Context, shortCode, tag string) ([]string, error) {
+	tags, found, err := s.repo.RemoveTag(ctx, shortCode, tag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store in PostgreSQL: %w", err)
+	}
+	if !found {
+		return nil, ErrEntryNotFound
+	}
+	s.emitDetailsEvent(ctx, shortCode, "tags")
+	return tags, nil
+}
+
+// emitDetailsEvent queues link.updated for a change of the details of a link
+func (s *Service) emitDetailsEvent(ctx context.Context, shortCode, change string) {
+	if s.webhooks == nil {
+		return
+	}
+	if entry, err := s.repo.GetByShortCode(ctx, shortCode); err != nil {
+		slog.WarnContext(ctx, "Failed to load entry for webhook event", "code", shortCode, "error", err)
+	} else if entry != nil {
+		s.emitLinkEvent(ctx, EventLinkUpdated, *entry, change)
+	}
+}
+
+// CreateFolder creates a folder, nested in ParentID when set. Names are
+// unique among the folders of an owner sharing a parent.
+func (s *Service) CreateFolder(ctx context.Context, folder Folder) (Folder, error) {
+	folder.Name = strings.TrimSpace(folder.Name)
+	if folder.Name == "" {
+		return Folder{}, fmt.Errorf("%w: folder name is required", ErrInvalidDetails)
+	}
+	if strings.ContainsFunc(folder.Name, unicode.IsControl) {
+		return Folder{}, fmt.Errorf("%w: folder name contains a control character", ErrInvalidDetails)
+	}
+	if err := checkText("folder name", folder.Name, maxFolderNameLength); err != nil {
+		return Folder{}, err
+	}
+	if folder.ParentID != nil {
+		if err := s.checkFolder(ctx, folder.ParentID, folder.Owner); err != nil {
+			return Folder{}, err
+		}
+		depth, err := s.repo.FolderDepth(ctx, *folder.ParentID)
+		if err != nil {
+			return Folder{}, fmt.Errorf("failed to load folder: %w", err)
+		}
+		if depth >= maxFolderDepth {
+			return Folder{}, fmt.Errorf("%w: folders nest at most %d deep", ErrInvalidDetails, maxFolderDepth)
+		}
+	}
+
+	created, err := s.repo.CreateFolder(ctx, &folder)
+	if err != nil {
+		return Folder{}, fmt.Errorf("failed to store in PostgreSQL: %w", err)
+	}
+	if !created {
+		return Folder{}, newError(CodeConflict, "a folder named %q already exists there", folder.Name)
+	}
+	slog.InfoContext(ctx, "Created folder", "folder", folder.ID, "owner", folder.Owner)
+	return folder, nil
+}
+
+// ListFolders returns the folders of owner, parents before their children
+func (s *Service) ListFolders(ctx context.Context, owner string) ([]Folder, error) {
+	return s.repo.ListFolders(ctx, owner)
+}
+
+// DeleteFolder deletes a folder and its subfolders. Their links are kept
+// outside any folder.
+func (s *Service) DeleteFolder(ctx context.Context, id int64) error {
+	deleted, err := s.repo.DeleteFolder(ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete folder: %w", err)
+	}
+	if !deleted {
+		return ErrFolderNotFound
+	}
+	return nil
+}
+
+// MoveLinks moves links into a folder, or out of their folders when
+// folderID is nil. Links of another owner than the folder are skipped.
+func (s *Service) MoveLinks(ctx context.Context, shortCodes []string, folderID *int64) (MoveResult, error) {
+	if len(shortCodes) == 0 {
+		return MoveResult{}, fmt.Errorf("%w: no links", ErrInvalidDetails)
+	}
+	if len(shortCodes) > maxMoveLinks {
+		return MoveResult{}, newError(CodeTooLarge, "at most %d links can be moved at once", maxMoveLinks)
+	}
+	if folderID != nil {
+		folder, err := s.repo.GetFolder(ctx, *folderID)
+		if err != nil {
+			return MoveResult{}, fmt.Errorf("failed to load folder: %w", err)
+		}
+		if folder == nil {
+			return MoveResult{}, ErrFolderNotFound
+		}
+	}
+
+	moved, err := s.repo.MoveEntries(ctx, shortCodes, folderID)
+	if err != nil {
+		return MoveResult{}, fmt.Errorf("failed to move links: %w", err)
+	}
+
+	result := MoveResult{Moved: len(moved), Skipped: []string{}}
+	movedCodes := make(map[string]bool, len(moved))
+	for _, e := range moved {
+		movedCodes[e.ShortCode] = true
+		s.emitLinkEvent(ctx, EventLinkUpdated, e, "folder")
+	}
+	for _, code := range shortCodes {
+		if !movedCodes[code] && !slices.Contains(result.Skipped, code) {
+			result.Skipped = append(result.Skipped, code)
+		}
+	}
+	slog.InfoContext(ctx, "Moved links", "moved", result.Moved, "skipped", len(result.Skipped))
+	return result, nil
+}
+
+// GetTagStats aggregates the links of owner, or of everyone when owner is
+// empty, by tag
+func (s *Service) GetTagStats(ctx context.Context, owner string, limit int) ([]TagStats, error) {
+	return s.repo.GetTagStats(ctx, owner, limit)
+}
+
+// GetFolderStats aggregates the links of each folder of owner, including
+// those in its subfolders
+func (s *Service) GetFolderStats(ctx context.Context, owner string) ([]FolderStats, error) {
+	return s.repo.GetFolderStats(ctx, owner)
+}
@@ -0,0 +1,4 @@
+// Package smolearlv1 holds the generated gRPC API of the link service
+package smolearlv1
+
+//go:generate protoc -I ../.. --go_out=../.. --go_opt=paths=source_relative --go-grpc_out=../.. --go-grpc_opt=paths=source_relative smolearl/v1/smolearl.proto
@@ -0,0 +1,1704 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        v5.29.3
+// source: smolearl/v1/smolearl.proto
+
+package smolearlv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type UTM struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Source        string                 `protobuf:"bytes,1,opt,name=source,proto3" json:"source,omitempty"`
+	Medium        string                 `protobuf:"bytes,2,opt,name=medium,proto3" json:"medium,omitempty"`
+	Campaign      string                 `protobuf:"bytes,3,opt,name=campaign,proto3" json:"campaign,omitempty"`
+	Term          string                 `protobuf:"bytes,4,opt,name=term,proto3" json:"term,omitempty"`
+	Content       string                 `protobuf:"bytes,5,opt,name=content,proto3" json:"content,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UTM) Reset() {
+	*x = UTM{}
+	mi := &file_smolearl_v1_smolearl_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UTM) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UTM) ProtoMessage() {}
+
+func (x *UTM) ProtoReflect() protoreflect.Message {
+	mi := &file_smolearl_v1_smolearl_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UTM.ProtoReflect.Descriptor instead.
+func (*UTM) Descriptor() ([]byte, []int) {
+	return file_smolearl_v1_smolearl_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *UTM) GetSource() string {
+	if x != nil {
+		return x.Source
+	}
+	return ""
+}
+
+func (x *UTM) GetMedium() string {
+	if x != nil {
+		return x.Medium
+	}
+	return ""
+}
+
+func (x *UTM) GetCampaign() string {
+	if x != nil {
+		return x.Campaign
+	}
+	return ""
+}
+
+func (x *UTM) GetTerm() string {
+	if x != nil {
+		return x.Term
+	}
+	return ""
+}
+
+func (x *UTM) GetContent() string {
+	if x != nil {
+		return x.Content
+	}
+	return ""
+}
+
+type Destination struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Variant       string                 `protobuf:"bytes,1,opt,name=variant,proto3" json:"variant,omitempty"`
+	Url           string                 `protobuf:"bytes,2,opt,name=url,proto3" json:"url,omitempty"`
+	Weight        int32                  `protobuf:"varint,3,opt,name=weight,proto3" json:"weight,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Destination) Reset() {
+	*x = Destination{}
+	mi := &file_smolearl_v1_smolearl_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Destination) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Destination) ProtoMessage() {}
+
+func (x *Destination) ProtoReflect() protoreflect.Message {
+	mi := &file_smolearl_v1_smolearl_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Destination.ProtoReflect.Descriptor instead.
+func (*Destination) Descriptor() ([]byte, []int) {
+	return file_smolearl_v1_smolearl_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Destination) GetVariant() string {
+	if x != nil {
+		return x.Variant
+	}
+	return ""
+}
+
+func (x *Destination) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+func (x *Destination) GetWeight() int32 {
+	if x != nil {
+		return x.Weight
+	}
+	return 0
+}
+
+type DeepLink struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Ios           string                 `protobuf:"bytes,1,opt,name=ios,proto3" json:"ios,omitempty"`
+	Android       string                 `protobuf:"bytes,2,opt,name=android,proto3" json:"android,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeepLink) Reset() {
+	*x = DeepLink{}
+	mi := &file_smolearl_v1_smolearl_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeepLink) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeepLink) ProtoMessage() {}
+
+func (x *DeepLink) ProtoReflect() protoreflect.Message {
+	mi := &file_smolearl_v1_smolearl_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeepLink.ProtoReflect.Descriptor instead.
+func (*DeepLink) Descriptor() ([]byte, []int) {
+	return file_smolearl_v1_smolearl_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *DeepLink) GetIos() string {
+	if x != nil {
+		return x.Ios
+	}
+	return ""
+}
+
+func (x *DeepLink) GetAndroid() string {
+	if x != nil {
+		return x.Android
+	}
+	return ""
+}
+
+type CreateLinkRequest struct {
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	Url         string                 `protobuf:"bytes,1,opt,name=url,proto3" json:"url,omitempty"`
+	CustomAlias string                 `protobuf:"bytes,2,opt,name=custom_alias,json=customAlias,proto3" json:"custom_alias,omitempty"`
+	Owner       string                 `protobuf:"bytes,3,opt,name=owner,proto3" json:"owner,omitempty"`
+	// destinations replaces url for split links; sticky is none, cookie or hash
+	Destinations []*Destination `protobuf:"bytes,4,rep,name=destinations,proto3" json:"destinations,omitempty"`
+	Sticky       string         `protobuf:"bytes,5,opt,name=sticky,proto3" json:"sticky,omitempty"`
+	DeepLink     *DeepLink      `protobuf:"bytes,6,opt,name=deep_link,json=deepLink,proto3" json:"deep_link,omitempty"`
+	Utm          *UTM           `protobuf:"bytes,7,opt,name=utm,proto3" json:"utm,omitempty"`
+	UtmPreset    string         `protobuf:"bytes,8,opt,name=utm_preset,json=utmPreset,proto3" json:"utm_preset,omitempty"`
+	// dedupe overrides the owner's deduplication setting when set
+	Dedupe        *bool `protobuf:"varint,9,opt,name=dedupe,proto3,oneof" json:"dedupe,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateLinkRequest) Reset() {
+	*x = CreateLinkRequest{}
+	mi := &file_smolearl_v1_smolearl_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateLinkRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateLinkRequest) ProtoMessage() {}
+
+func (x *CreateLinkRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_smolearl_v1_smolearl_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateLinkRequest.ProtoReflect.Descriptor instead.
+func (*CreateLinkRequest) Descriptor() ([]byte, []int) {
+	return file_smolearl_v1_smolearl_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *CreateLinkRequest) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+func (x *CreateLinkRequest) GetCustomAlias() string {
+	if x != nil {
+		return x.CustomAlias
+	}
+	return ""
+}
+
+func (x *CreateLinkRequest) GetOwner() string {
+	if x != nil {
+		return x.Owner
+	}
+	return ""
+}
+
+func (x *CreateLinkRequest) GetDestinations() []*Destination {
+	if x != nil {
+		return x.Destinations
+	}
+	return nil
+}
+
+func (x *CreateLinkRequest) GetSticky() string {
+	if x != nil {
+		return x.Sticky
+	}
+	return ""
+}
+
+func (x *CreateLinkRequest) GetDeepLink() *DeepLink {
+	if x != nil {
+		return x.DeepLink
+	}
+	return nil
+}
+
+func (x *CreateLinkRequest) GetUtm() *UTM {
+	if x != nil {
+		return x.Utm
+	}
+	return nil
+}
+
+func (x *CreateLinkRequest) GetUtmPreset() string {
+	if x != nil {
+		return x.UtmPreset
+	}
+	return ""
+}
+
+func (x *CreateLinkRequest) GetDedupe() bool {
+	if x != nil && x.Dedupe != nil {
+		return *x.Dedupe
+	}
+	return false
+}
+
+type CreateLinkResponse struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	ShortCode string                 `protobuf:"bytes,1,opt,name=short_code,json=shortCode,proto3" json:"short_code,omitempty"`
+	// existing is set when an identical link was returned instead
+	Existing      bool `protobuf:"varint,2,opt,name=existing,proto3" json:"existing,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateLinkResponse) Reset() {
+	*x = CreateLinkResponse{}
+	mi := &file_smolearl_v1_smolearl_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateLinkResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateLinkResponse) ProtoMessage() {}
+
+func (x *CreateLinkResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_smolearl_v1_smolearl_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateLinkResponse.ProtoReflect.Descriptor instead.
+func (*CreateLinkResponse) Descriptor() ([]byte, []int) {
+	return file_smolearl_v1_smolearl_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *CreateLinkResponse) GetShortCode() string {
+	if x != nil {
+		return x.ShortCode
+	}
+	return ""
+}
+
+func (x *CreateLinkResponse) GetExisting() bool {
+	if x != nil {
+		return x.Existing
+	}
+	return false
+}
+
+type GetLinkRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ShortCode     string                 `protobuf:"bytes,1,opt,name=short_code,json=shortCode,proto3" json:"short_code,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetLinkRequest) Reset() {
+	*x = GetLinkRequest{}
+	mi := &file_smolearl_v1_smolearl_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetLinkRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetLinkRequest) ProtoMessage() {}
+
+func (x *GetLinkRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_smolearl_v1_smolearl_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetLinkRequest.ProtoReflect.Descriptor instead.
+func (*GetLinkRequest) Descriptor() ([]byte, []int) {
+	return file_smolearl_v1_smolearl_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *GetLinkRequest) GetShortCode() string {
+	if x != nil {
+		return x.ShortCode
+	}
+	return ""
+}
+
+type Link struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ShortCode     string                 `protobuf:"bytes,1,opt,name=short_code,json=shortCode,proto3" json:"short_code,omitempty"`
+	Url           string                 `protobuf:"bytes,2,opt,name=url,proto3" json:"url,omitempty"`
+	Clicks        int64                  `protobuf:"varint,3,opt,name=clicks,proto3" json:"clicks,omitempty"`
+	CreatedAt     *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	Destinations  []*Destination         `protobuf:"bytes,5,rep,name=destinations,proto3" json:"destinations,omitempty"`
+	Sticky        string                 `protobuf:"bytes,6,opt,name=sticky,proto3" json:"sticky,omitempty"`
+	DeepLink      *DeepLink              `protobuf:"bytes,7,opt,name=deep_link,json=deepLink,proto3" json:"deep_link,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Link) Reset() {
+	*x = Link{}
+	mi := &file_smolearl_v1_smolearl_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Link) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Link) ProtoMessage() {}
+
+func (x *Link) ProtoReflect() protoreflect.Message {
+	mi := &file_smolearl_v1_smolearl_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Link.ProtoReflect.Descriptor instead.
+func (*Link) Descriptor() ([]byte, []int) {
+	return file_smolearl_v1_smolearl_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *Link) GetShortCode() string {
+	if x != nil {
+		return x.ShortCode
+	}
+	return ""
+}
+
+func (x *Link) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+func (x *Link) GetClicks() int64 {
+	if x != nil {
+		return x.Clicks
+	}
+	return 0
+}
+
+func (x *Link) GetCreatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+func (x *Link) GetDestinations() []*Destination {
+	if x != nil {
+		return x.Destinations
+	}
+	return nil
+}
+
+func (x *Link) GetSticky() string {
+	if x != nil {
+		return x.Sticky
+	}
+	return ""
+}
+
+func (x *Link) GetDeepLink() *DeepLink {
+	if x != nil {
+		return x.DeepLink
+	}
+	return nil
+}
+
+type ResolveLinkRequest struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	ShortCode string                 `protobuf:"bytes,1,opt,name=short_code,json=shortCode,proto3" json:"short_code,omitempty"`
+	// Details of the visitor the link is resolved for
+	ClientIp       string            `protobuf:"bytes,2,opt,name=client_ip,json=clientIp,proto3" json:"client_ip,omitempty"`
+	UserAgent      string            `protobuf:"bytes,3,opt,name=user_agent,json=userAgent,proto3" json:"user_agent,omitempty"`
+	Referer        string            `protobuf:"bytes,4,opt,name=referer,proto3" json:"referer,omitempty"`
+	AcceptLanguage string            `protobuf:"bytes,5,opt,name=accept_language,json=acceptLanguage,proto3" json:"accept_language,omitempty"`
+	Query          map[string]string `protobuf:"bytes,6,rep,name=query,proto3" json:"query,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// variant is the split variant previously served to the visitor
+	Variant string `protobuf:"bytes,7,opt,name=variant,proto3" json:"variant,omitempty"`
+	// record_click counts the resolve in the link's analytics
+	RecordClick   bool `protobuf:"varint,8,opt,name=record_click,json=recordClick,proto3" json:"record_click,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ResolveLinkRequest) Reset() {
+	*x = ResolveLinkRequest{}
+	mi := &file_smolearl_v1_smolearl_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ResolveLinkRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ResolveLinkRequest) ProtoMessage() {}
+
+func (x *ResolveLinkRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_smolearl_v1_smolearl_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ResolveLinkRequest.ProtoReflect.Descriptor instead.
+func (*ResolveLinkRequest) Descriptor() ([]byte, []int) {
+	return file_smolearl_v1_smolearl_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *ResolveLinkRequest) GetShortCode() string {
+	if x != nil {
+		return x.ShortCode
+	}
+	return ""
+}
+
+func (x *ResolveLinkRequest) GetClientIp() string {
+	if x != nil {
+		return x.ClientIp
+	}
+	return ""
+}
+
+func (x *ResolveLinkRequest) GetUserAgent() string {
+	if x != nil {
+		return x.UserAgent
+	}
+	return ""
+}
+
+func (x *ResolveLinkRequest) GetReferer() string {
+	if x != nil {
+		return x.Referer
+	}
+	return ""
+}
+
+func (x *ResolveLinkRequest) GetAcceptLanguage() string {
+	if x != nil {
+		return x.AcceptLanguage
+	}
+	return ""
+}
+
+func (x *ResolveLinkRequest) GetQuery() map[string]string {
+	if x != nil {
+		return x.Query
+	}
+	return nil
+}
+
+func (x *ResolveLinkRequest) GetVariant() string {
+	if x != nil {
+		return x.Variant
+	}
+	return ""
+}
+
+func (x *ResolveLinkRequest) GetRecordClick() bool {
+	if x != nil {
+		return x.RecordClick
+	}
+	return false
+}
+
+type ResolveLinkResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ShortCode     string                 `protobuf:"bytes,1,opt,name=short_code,json=shortCode,proto3" json:"short_code,omitempty"`
+	Url           string                 `protobuf:"bytes,2,opt,name=url,proto3" json:"url,omitempty"`
+	Variant       string                 `protobuf:"bytes,3,opt,name=variant,proto3" json:"variant,omitempty"`
+	Rule          string                 `protobuf:"bytes,4,opt,name=rule,proto3" json:"rule,omitempty"`
+	Platform      string                 `protobuf:"bytes,5,opt,name=platform,proto3" json:"platform,omitempty"`
+	AppUrl        string                 `protobuf:"bytes,6,opt,name=app_url,json=appUrl,proto3" json:"app_url,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ResolveLinkResponse) Reset() {
+	*x = ResolveLinkResponse{}
+	mi := &file_smolearl_v1_smolearl_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ResolveLinkResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ResolveLinkResponse) ProtoMessage() {}
+
+func (x *ResolveLinkResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_smolearl_v1_smolearl_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ResolveLinkResponse.ProtoReflect.Descriptor instead.
+func (*ResolveLinkResponse) Descriptor() ([]byte, []int) {
+	return file_smolearl_v1_smolearl_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *ResolveLinkResponse) GetShortCode() string {
+	if x != nil {
+		return x.ShortCode
+	}
+	return ""
+}
+
+func (x *ResolveLinkResponse) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+func (x *ResolveLinkResponse) GetVariant() string {
+	if x != nil {
+		return x.Variant
+	}
+	return ""
+}
+
+func (x *ResolveLinkResponse) GetRule() string {
+	if x != nil {
+		return x.Rule
+	}
+	return ""
+}
+
+func (x *ResolveLinkResponse) GetPlatform() string {
+	if x != nil {
+		return x.Platform
+	}
+	return ""
+}
+
+func (x *ResolveLinkResponse) GetAppUrl() string {
+	if x != nil {
+		return x.AppUrl
+	}
+	return ""
+}
+
+type GetStatsRequest struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	ShortCode string                 `protobuf:"bytes,1,opt,name=short_code,json=shortCode,proto3" json:"short_code,omitempty"`
+	// Unique visitors are counted over the UTC days from and to, the last 30
+	// days by default
+	From          *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=from,proto3" json:"from,omitempty"`
+	To            *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=to,proto3" json:"to,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetStatsRequest) Reset() {
+	*x = GetStatsRequest{}
+	mi := &file_smolearl_v1_smolearl_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetStatsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetStatsRequest) ProtoMessage() {}
+
+func (x *GetStatsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_smolearl_v1_smolearl_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetStatsRequest.ProtoReflect.Descriptor instead.
+func (*GetStatsRequest) Descriptor() ([]byte, []int) {
+	return file_smolearl_v1_smolearl_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *GetStatsRequest) GetShortCode() string {
+	if x != nil {
+		return x.ShortCode
+	}
+	return ""
+}
+
+func (x *GetStatsRequest) GetFrom() *timestamppb.Timestamp {
+	if x != nil {
+		return x.From
+	}
+	return nil
+}
+
+func (x *GetStatsRequest) GetTo() *timestamppb.Timestamp {
+	if x != nil {
+		return x.To
+	}
+	return nil
+}
+
+type Count struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Clicks        int64                  `protobuf:"varint,2,opt,name=clicks,proto3" json:"clicks,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Count) Reset() {
+	*x = Count{}
+	mi := &file_smolearl_v1_smolearl_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Count) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Count) ProtoMessage() {}
+
+func (x *Count) ProtoReflect() protoreflect.Message {
+	mi := &file_smolearl_v1_smolearl_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Count.ProtoReflect.Descriptor instead.
+func (*Count) Descriptor() ([]byte, []int) {
+	return file_smolearl_v1_smolearl_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *Count) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Count) GetClicks() int64 {
+	if x != nil {
+		return x.Clicks
+	}
+	return 0
+}
+
+type VariantStats struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Variant       string                 `protobuf:"bytes,1,opt,name=variant,proto3" json:"variant,omitempty"`
+	Url           string                 `protobuf:"bytes,2,opt,name=url,proto3" json:"url,omitempty"`
+	Weight        int32                  `protobuf:"varint,3,opt,name=weight,proto3" json:"weight,omitempty"`
+	Clicks        int64                  `protobuf:"varint,4,opt,name=clicks,proto3" json:"clicks,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *VariantStats) Reset() {
+	*x = VariantStats{}
+	mi := &file_smolearl_v1_smolearl_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *VariantStats) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*VariantStats) ProtoMessage() {}
+
+func (x *VariantStats) ProtoReflect() protoreflect.Message {
+	mi := &file_smolearl_v1_smolearl_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use VariantStats.ProtoReflect.Descriptor instead.
+func (*VariantStats) Descriptor() ([]byte, []int) {
+	return file_smolearl_v1_smolearl_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *VariantStats) GetVariant() string {
+	if x != nil {
+		return x.Variant
+	}
+	return ""
+}
+
+func (x *VariantStats) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+func (x *VariantStats) GetWeight() int32 {
+	if x != nil {
+		return x.Weight
+	}
+	return 0
+}
+
+func (x *VariantStats) GetClicks() int64 {
+	if x != nil {
+		return x.Clicks
+	}
+	return 0
+}
+
+type DailyVisitors struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Day           string                 `protobuf:"bytes,1,opt,name=day,proto3" json:"day,omitempty"`
+	Visitors      int64                  `protobuf:"varint,2,opt,name=visitors,proto3" json:"visitors,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DailyVisitors) Reset() {
+	*x = DailyVisitors{}
+	mi := &file_smolearl_v1_smolearl_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DailyVisitors) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DailyVisitors) ProtoMessage() {}
+
+func (x *DailyVisitors) ProtoReflect() protoreflect.Message {
+	mi := &file_smolearl_v1_smolearl_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DailyVisitors.ProtoReflect.Descriptor instead.
+func (*DailyVisitors) Descriptor() ([]byte, []int) {
+	return file_smolearl_v1_smolearl_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *DailyVisitors) GetDay() string {
+	if x != nil {
+		return x.Day
+	}
+	return ""
+}
+
+func (x *DailyVisitors) GetVisitors() int64 {
+	if x != nil {
+		return x.Visitors
+	}
+	return 0
+}
+
+type Stats struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	ShortCode      string                 `protobuf:"bytes,1,opt,name=short_code,json=shortCode,proto3" json:"short_code,omitempty"`
+	Clicks         int64                  `protobuf:"varint,2,opt,name=clicks,proto3" json:"clicks,omitempty"`
+	CreatedAt      *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	Countries      []*Count               `protobuf:"bytes,4,rep,name=countries,proto3" json:"countries,omitempty"`
+	Channels       []*Count               `protobuf:"bytes,5,rep,name=channels,proto3" json:"channels,omitempty"`
+	Variants       []*VariantStats        `protobuf:"bytes,6,rep,name=variants,proto3" json:"variants,omitempty"`
+	UniqueVisitors int64                  `protobuf:"varint,7,opt,name=unique_visitors,json=uniqueVisitors,proto3" json:"unique_visitors,omitempty"`
+	DailyVisitors  []*DailyVisitors       `protobuf:"bytes,8,rep,name=daily_visitors,json=dailyVisitors,proto3" json:"daily_visitors,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *Stats) Reset() {
+	*x = Stats{}
+	mi := &file_smolearl_v1_smolearl_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Stats) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Stats) ProtoMessage() {}
+
+func (x *Stats) ProtoReflect() protoreflect.Message {
+	mi := &file_smolearl_v1_smolearl_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Stats.ProtoReflect.Descriptor instead.
+func (*Stats) Descriptor() ([]byte, []int) {
+	return file_smolearl_v1_smolearl_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *Stats) GetShortCode() string {
+	if x != nil {
+		return x.ShortCode
+	}
+	return ""
+}
+
+func (x *Stats) GetClicks() int64 {
+	if x != nil {
+		return x.Clicks
+	}
+	return 0
+}
+
+func (x *Stats) GetCreatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+func (x *Stats) GetCountries() []*Count {
+	if x != nil {
+		return x.Countries
+	}
+	return nil
+}
+
+func (x *Stats) GetChannels() []*Count {
+	if x != nil {
+		return x.Channels
+	}
+	return nil
+}
+
+func (x *Stats) GetVariants() []*VariantStats {
+	if x != nil {
+		return x.Variants
+	}
+	return nil
+}
+
+func (x *Stats) GetUniqueVisitors() int64 {
+	if x != nil {
+		return x.UniqueVisitors
+	}
+	return 0
+}
+
+func (x *Stats) GetDailyVisitors() []*DailyVisitors {
+	if x != nil {
+		return x.DailyVisitors
+	}
+	return nil
+}
+
+type BatchItem struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Url           string                 `protobuf:"bytes,1,opt,name=url,proto3" json:"url,omitempty"`
+	CustomAlias   string                 `protobuf:"bytes,2,opt,name=custom_alias,json=customAlias,proto3" json:"custom_alias,omitempty"`
+	Owner         string                 `protobuf:"bytes,3,opt,name=owner,proto3" json:"owner,omitempty"`
+	Metadata      *structpb.Struct       `protobuf:"bytes,4,opt,name=metadata,proto3" json:"metadata,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchItem) Reset() {
+	*x = BatchItem{}
+	mi := &file_smolearl_v1_smolearl_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchItem) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchItem) ProtoMessage() {}
+
+func (x *BatchItem) ProtoReflect() protoreflect.Message {
+	mi := &file_smolearl_v1_smolearl_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchItem.ProtoReflect.Descriptor instead.
+func (*BatchItem) Descriptor() ([]byte, []int) {
+	return file_smolearl_v1_smolearl_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *BatchItem) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+func (x *BatchItem) GetCustomAlias() string {
+	if x != nil {
+		return x.CustomAlias
+	}
+	return ""
+}
+
+func (x *BatchItem) GetOwner() string {
+	if x != nil {
+		return x.Owner
+	}
+	return ""
+}
+
+func (x *BatchItem) GetMetadata() *structpb.Struct {
+	if x != nil {
+		return x.Metadata
+	}
+	return nil
+}
+
+type BatchCreateRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Items         []*BatchItem           `protobuf:"bytes,1,rep,name=items,proto3" json:"items,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchCreateRequest) Reset() {
+	*x = BatchCreateRequest{}
+	mi := &file_smolearl_v1_smolearl_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchCreateRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchCreateRequest) ProtoMessage() {}
+
+func (x *BatchCreateRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_smolearl_v1_smolearl_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchCreateRequest.ProtoReflect.Descriptor instead.
+func (*BatchCreateRequest) Descriptor() ([]byte, []int) {
+	return file_smolearl_v1_smolearl_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *BatchCreateRequest) GetItems() []*BatchItem {
+	if x != nil {
+		return x.Items
+	}
+	return nil
+}
+
+type BatchResult struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Index         int32                  `protobuf:"varint,1,opt,name=index,proto3" json:"index,omitempty"`
+	Url           string                 `protobuf:"bytes,2,opt,name=url,proto3" json:"url,omitempty"`
+	ShortCode     string                 `protobuf:"bytes,3,opt,name=short_code,json=shortCode,proto3" json:"short_code,omitempty"`
+	Error         string                 `protobuf:"bytes,4,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchResult) Reset() {
+	*x = BatchResult{}
+	mi := &file_smolearl_v1_smolearl_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchResult) ProtoMessage() {}
+
+func (x *BatchResult) ProtoReflect() protoreflect.Message {
+	mi := &file_smolearl_v1_smolearl_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchResult.ProtoReflect.Descriptor instead.
+func (*BatchResult) Descriptor() ([]byte, []int) {
+	return file_smolearl_v1_smolearl_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *BatchResult) GetIndex() int32 {
+	if x != nil {
+		return x.Index
+	}
+	return 0
+}
+
+func (x *BatchResult) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+func (x *BatchResult) GetShortCode() string {
+	if x != nil {
+		return x.ShortCode
+	}
+	return ""
+}
+
+func (x *BatchResult) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+type BatchCreateResponse struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Created int32                  `protobuf:"varint,1,opt,name=created,proto3" json:"created,omitempty"`
+	Failed  int32                  `protobuf:"varint,2,opt,name=failed,proto3" json:"failed,omitempty"`
+	// results has one entry per item, in request order
+	Results       []*BatchResult `protobuf:"bytes,3,rep,name=results,proto3" json:"results,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchCreateResponse) Reset() {
+	*x = BatchCreateResponse{}
+	mi := &file_smolearl_v1_smolearl_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchCreateResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchCreateResponse) ProtoMessage() {}
+
+func (x *BatchCreateResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_smolearl_v1_smolearl_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchCreateResponse.ProtoReflect.Descriptor instead.
+func (*BatchCreateResponse) Descriptor() ([]byte, []int) {
+	return file_smolearl_v1_smolearl_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *BatchCreateResponse) GetCreated() int32 {
+	if x != nil {
+		return x.Created
+	}
+	return 0
+}
+
+func (x *BatchCreateResponse) GetFailed() int32 {
+	if x != nil {
+		return x.Failed
+	}
+	return 0
+}
+
+func (x *BatchCreateResponse) GetResults() []*BatchResult {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+type StreamClicksRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// short_codes limits the stream to some links; empty streams every click
+	ShortCodes    []string `protobuf:"bytes,1,rep,name=short_codes,json=shortCodes,proto3" json:"short_codes,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamClicksRequest) Reset() {
+	*x = StreamClicksRequest{}
+	mi := &file_smolearl_v1_smolearl_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamClicksRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamClicksRequest) ProtoMessage() {}
+
+func (x *StreamClicksRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_smolearl_v1_smolearl_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamClicksRequest.ProtoReflect.Descriptor instead.
+func (*StreamClicksRequest) Descriptor() ([]byte, []int) {
+	return file_smolearl_v1_smolearl_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *StreamClicksRequest) GetShortCodes() []string {
+	if x != nil {
+		return x.ShortCodes
+	}
+	return nil
+}
+
+type ClickEvent struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	ShortCode      string                 `protobuf:"bytes,1,opt,name=short_code,json=shortCode,proto3" json:"short_code,omitempty"`
+	OccurredAt     *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=occurred_at,json=occurredAt,proto3" json:"occurred_at,omitempty"`
+	Country        string                 `protobuf:"bytes,3,opt,name=country,proto3" json:"country,omitempty"`
+	Region         string                 `protobuf:"bytes,4,opt,name=region,proto3" json:"region,omitempty"`
+	City           string                 `protobuf:"bytes,5,opt,name=city,proto3" json:"city,omitempty"`
+	Browser        string                 `protobuf:"bytes,6,opt,name=browser,proto3" json:"browser,omitempty"`
+	Os             string                 `protobuf:"bytes,7,opt,name=os,proto3" json:"os,omitempty"`
+	Device         string                 `protobuf:"bytes,8,opt,name=device,proto3" json:"device,omitempty"`
+	Bot            bool                   `protobuf:"varint,9,opt,name=bot,proto3" json:"bot,omitempty"`
+	ReferrerDomain string                 `protobuf:"bytes,10,opt,name=referrer_domain,json=referrerDomain,proto3" json:"referrer_domain,omitempty"`
+	Channel        string                 `protobuf:"bytes,11,opt,name=channel,proto3" json:"channel,omitempty"`
+	Utm            *UTM                   `protobuf:"bytes,12,opt,name=utm,proto3" json:"utm,omitempty"`
+	Variant        string                 `protobuf:"bytes,13,opt,name=variant,proto3" json:"variant,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *ClickEvent) Reset() {
+	*x = ClickEvent{}
+	mi := &file_smolearl_v1_smolearl_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ClickEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ClickEvent) ProtoMessage() {}
+
+func (x *ClickEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_smolearl_v1_smolearl_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ClickEvent.ProtoReflect.Descriptor instead.
+func (*ClickEvent) Descriptor() ([]byte, []int) {
+	return file_smolearl_v1_smolearl_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *ClickEvent) GetShortCode() string {
+	if x != nil {
+		return x.ShortCode
+	}
+	return ""
+}
+
+func (x *ClickEvent) GetOccurredAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.OccurredAt
+	}
+	return nil
+}
+
+func (x *ClickEvent) GetCountry() string {
+	if x != nil {
+		return x.Country
+	}
+	return ""
+}
+
+func (x *ClickEvent) GetRegion() string {
+	if x != nil {
+		return x.Region
+	}
+	return ""
+}
+
+func (x *ClickEvent) GetCity() string {
+	if x != nil {
+		return x.City
+	}
+	return ""
+}
+
+func (x *ClickEvent) GetBrowser() string {
+	if x != nil {
+		return x.Browser
+	}
+	return ""
+}
+
+func (x *ClickEvent) GetOs() string {
+	if x != nil {
+		return x.Os
+	}
+	return ""
+}
+
+func (x *ClickEvent) GetDevice() string {
+	if x != nil {
+		return x.Device
+	}
+	return ""
+}
+
+func (x *ClickEvent) GetBot() bool {
+	if x != nil {
+		return x.Bot
+	}
+	return false
+}
+
+func (x *ClickEvent) GetReferrerDomain() string {
+	if x != nil {
+		return x.ReferrerDomain
+	}
+	return ""
+}
+
+func (x *ClickEvent) GetChannel() string {
+	if x != nil {
+		return x.Channel
+	}
+	return ""
+}
+
+func (x *ClickEvent) GetUtm() *UTM {
+	if x != nil {
+		return x.Utm
+	}
+	return nil
+}
+
+func (x *ClickEvent) GetVariant() string {
+	if x != nil {
+		return x.Variant
+	}
+	return ""
+}
+
+var File_smolearl_v1_smolearl_proto protoreflect.FileDescriptor
+
+const file_smolearl_v1_smolearl_proto_rawDesc = "" +
+	"\n" +
+	"\x1asmolearl/v1/smolearl.proto\x12\vsmolearl.v1\x1a\x1cgoogle/protobuf/struct.proto\x1a\x1fgoogle/protobuf/timestamp.proto\"\x7f\n" +
+	"\x03UTM\x12\x16\n" +
+	"\x06source\x18\x01 \x01(\tR\x06source\x12\x16\n" +
+	"\x06medium\x18\x02 \x01(\tR\x06medium\x12\x1a\n" +
+	"\bcampaign\x18\x03 \x01(\tR\bcampaign\x12\x12\n" +
+	"\x04term\x18\x04 \x01(\tR\x04term\x12\x18\n" +
+	"\acontent\x18\x05 \x01(\tR\acontent\"Q\n" +
+	"\vDestination\x12\x18\n" +
+	"\avariant\x18\x01 \x01(\tR\avariant\x12\x10\n" +
+	"\x03url\x18\x02 \x01(\tR\x03url\x12\x16\n" +
+	"\x06weight\x18\x03 \x01(\x05R\x06weight\"6\n" +
+	"\bDeepLink\x12\x10\n" +
+	"\x03ios\x18\x01 \x01(\tR\x03ios\x12\x18\n" +
+	"\aandroid\x18\x02 \x01(\tR\aandroid\"\xd3\x02\n" +
+	"\x11CreateLinkRequest\x12\x10\n" +
+	"\x03url\x18\x01 \x01(\tR\x03url\x12!\n" +
+	"\fcustom_alias\x18\x02 \x01(\tR\vcustomAlias\x12\x14\n" +
+	"\x05owner\x18\x03 \x01(\tR\x05owner\x12<\n" +
+	"\fdestinations\x18\x04 \x03(\v2\x18.smolearl.v1.DestinationR\fdestinations\x12\x16\n" +
+	"\x06sticky\x18\x05 \x01(\tR\x06sticky\x122\n" +
+	"\tdeep_link\x18\x06 \x01(\v2\x15.smolearl.v1.DeepLinkR\bdeepLink\x12\"\n" +
+	"\x03utm\x18\a \x01(\v2\x10.smolearl.v1.UTMR\x03utm\x12\x1d\n" +
+	"\n" +
+	"utm_preset\x18\b \x01(\tR\tutmPreset\x12\x1b\n" +
+	"\x06dedupe\x18\t \x01(\bH\x00R\x06dedupe\x88\x01\x01B\t\n" +
+	"\a_dedupe\"O\n" +
+	"\x12CreateLinkResponse\x12\x1d\n" +
+	"\n" +
+	"short_code\x18\x01 \x01(\tR\tshortCode\x12\x1a\n" +
+	"\bexisting\x18\x02 \x01(\bR\bexisting\"/\n" +
+	"\x0eGetLinkRequest\x12\x1d\n" +
+	"\n" +
+	"short_code\x18\x01 \x01(\tR\tshortCode\"\x94\x02\n" +
+	"\x04Link\x12\x1d\n" +
+	"\n" +
+	"short_code\x18\x01 \x01(\tR\tshortCode\x12\x10\n" +
+	"\x03url\x18\x02 \x01(\tR\x03url\x12\x16\n" +
+	"\x06clicks\x18\x03 \x01(\x03R\x06clicks\x129\n" +
+	"\n" +
+	"created_at\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\x12<\n" +
+	"\fdestinations\x18\x05 \x03(\v2\x18.smolearl.v1.DestinationR\fdestinations\x12\x16\n" +
+	"\x06sticky\x18\x06 \x01(\tR\x06sticky\x122\n" +
+	"\tdeep_link\x18\a \x01(\v2\x15.smolearl.v1.DeepLinkR\bdeepLink\"\xeb\x02\n" +
+	"\x12ResolveLinkRequest\x12\x1d\n" +
+	"\n" +
+	"short_code\x18\x01 \x01(\tR\tshortCode\x12\x1b\n" +
+	"\tclient_ip\x18\x02 \x01(\tR\bclientIp\x12\x1d\n" +
+	"\n" +
+	"user_agent\x18\x03 \x01(\tR\tuserAgent\x12\x18\n" +
+	"\areferer\x18\x04 \x01(\tR\areferer\x12'\n" +
+	"\x0faccept_language\x18\x05 \x01(\tR\x0eacceptLanguage\x12@\n" +
+	"\x05query\x18\x06 \x03(\v2*.smolearl.v1.ResolveLinkRequest.QueryEntryR\x05query\x12\x18\n" +
+	"\avariant\x18\a \x01(\tR\avariant\x12!\n" +
+	"\frecord_click\x18\b \x01(\bR\vrecordClick\x1a8\n" +
+	"\n" +
+	"QueryEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\xa9\x01\n" +
+	"\x13ResolveLinkResponse\x12\x1d\n" +
+	"\n" +
+	"short_code\x18\x01 \x01(\tR\tshortCode\x12\x10\n" +
+	"\x03url\x18\x02 \x01(\tR\x03url\x12\x18\n" +
+	"\avariant\x18\x03 \x01(\tR\avariant\x12\x12\n" +
+	"\x04rule\x18\x04 \x01(\tR\x04rule\x12\x1a\n" +
+	"\bplatform\x18\x05 \x01(\tR\bplatform\x12\x17\n" +
+	"\aapp_url\x18\x06 \x01(\tR\x06appUrl\"\x8c\x01\n" +
+	"\x0fGetStatsRequest\x12\x1d\n" +
+	"\n" +
+	"short_code\x18\x01 \x01(\tR\tshortCode\x12.\n" +
+	"\x04from\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\x04from\x12*\n" +
+	"\x02to\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\x02to\"3\n" +
+	"\x05Count\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x16\n" +
+	"\x06clicks\x18\x02 \x01(\x03R\x06clicks\"j\n" +
+	"\fVariantStats\x12\x18\n" +
+	"\avariant\x18\x01 \x01(\tR\avariant\x12\x10\n" +
+	"\x03url\x18\x02 \x01(\tR\x03url\x12\x16\n" +
+	"\x06weight\x18\x03 \x01(\x05R\x06weight\x12\x16\n" +
+	"\x06clicks\x18\x04 \x01(\x03R\x06clicks\"=\n" +
+	"\rDailyVisitors\x12\x10\n" +
+	"\x03day\x18\x01 \x01(\tR\x03day\x12\x1a\n" +
+	"\bvisitors\x18\x02 \x01(\x03R\bvisitors\"\xfe\x02\n" +
+	"\x05Stats\x12\x1d\n" +
+	"\n" +
+	"short_code\x18\x01 \x01(\tR\tshortCode\x12\x16\n" +
+	"\x06clicks\x18\x02 \x01(\x03R\x06clicks\x129\n" +
+	"\n" +
+	"created_at\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\x120\n" +
+	"\tcountries\x18\x04 \x03(\v2\x12.smolearl.v1.CountR\tcountries\x12.\n" +
+	"\bchannels\x18\x05 \x03(\v2\x12.smolearl.v1.CountR\bchannels\x125\n" +
+	"\bvariants\x18\x06 \x03(\v2\x19.smolearl.v1.VariantStatsR\bvariants\x12'\n" +
+	"\x0funique_visitors\x18\a \x01(\x03R\x0euniqueVisitors\x12A\n" +
+	"\x0edaily_visitors\x18\b \x03(\v2\x1a.smolearl.v1.DailyVisitorsR\rdailyVisitors\"\x8b\x01\n" +
+	"\tBatchItem\x12\x10\n" +
+	"\x03url\x18\x01 \x01(\tR\x03url\x12!\n" +
+	"\fcustom_alias\x18\x02 \x01(\tR\vcustomAlias\x12\x14\n" +
+	"\x05owner\x18\x03 \x01(\tR\x05owner\x123\n" +
+	"\bmetadata\x18\x04 \x01(\v2\x17.google.protobuf.StructR\bmetadata\"B\n" +
+	"\x12BatchCreateRequest\x12,\n" +
+	"\x05items\x18\x01 \x03(\v2\x16.smolearl.v1.BatchItemR\x05items\"j\n" +
+	"\vBatchResult\x12\x14\n" +
+	"\x05index\x18\x01 \x01(\x05R\x05index\x12\x10\n" +
+	"\x03url\x18\x02 \x01(\tR\x03url\x12\x1d\n" +
+	"\n" +
+	"short_code\x18\x03 \x01(\tR\tshortCode\x12\x14\n" +
+	"\x05error\x18\x04 \x01(\tR\x05error\"{\n" +
+	"\x13BatchCreateResponse\x12\x18\n" +
+	"\acreated\x18\x01 \x01(\x05R\acreated\x12\x16\n" +
+	"\x06failed\x18\x02 \x01(\x05R\x06failed\x122\n" +
+	"\aresults\x18\x03 \x03(\v2\x18.smolearl.v1.BatchResultR\aresults\"6\n" +
+	"\x13StreamClicksRequest\x12\x1f\n" +
+	"\vshort_codes\x18\x01 \x03(\tR\n" +
+	"shortCodes\"\x83\x03\n" +
+	"\n" +
+	"ClickEvent\x12\x1d\n" +
+	"\n" +
+	"short_code\x18\x01 \x01(\tR\tshortCode\x12;\n" +
+	"\voccurred_at\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"occurredAt\x12\x18\n" +
+	"\acountry\x18\x03 \x01(\tR\acountry\x12\x16\n" +
+	"\x06region\x18\x04 \x01(\tR\x06region\x12\x12\n" +
+	"\x04city\x18\x05 \x01(\tR\x04city\x12\x18\n" +
+	"\abrowser\x18\x06 \x01(\tR\abrowser\x12\x0e\n" +
+	"\x02os\x18\a \x01(\tR\x02os\x12\x16\n" +
+	"\x06device\x18\b \x01(\tR\x06device\x12\x10\n" +
+	"\x03bot\x18\t \x01(\bR\x03bot\x12'\n" +
+	"\x0freferrer_domain\x18\n" +
+	" \x01(\tR\x0ereferrerDomain\x12\x18\n" +
+	"\achannel\x18\v \x01(\tR\achannel\x12\"\n" +
+	"\x03utm\x18\f \x01(\v2\x10.smolearl.v1.UTMR\x03utm\x12\x18\n" +
+	"\avariant\x18\r \x01(\tR\avariant2\xc6\x03\n" +
+	"\vLinkService\x12M\n" +
+	"\n" +
+	"CreateLink\x12\x1e.smolearl.v1.CreateLinkRequest\x1a\x1f.smolearl.v1.CreateLinkResponse\x129\n" +
+	"\aGetLink\x12\x1b.smolearl.v1.GetLinkRequest\x1a\x11.smolearl.v1.Link\x12P\n" +
+	"\vResolveLink\x12\x1f.smolearl.v1.ResolveLinkRequest\x1a .smolearl.v1.ResolveLinkResponse\x12<\n" +
+	"\bGetStats\x12\x1c.smolearl.v1.GetStatsRequest\x1a\x12.smolearl.v1.Stats\x12P\n" +
+	"\vBatchCreate\x12\x1f.smolearl.v1.BatchCreateRequest\x1a .smolearl.v1.BatchCreateResponse\x12K\n" +
+	"\fStreamClicks\x12 .smolearl.v1.StreamClicksRequest\x1a\x17.smolearl.v1.ClickEvent0\x01B:Z8github.com/mahopon/SmolEarl/proto/smolearl/v1;smolearlv1b\x06proto3"
+
+var (
+	file_smolearl_v1_smolearl_proto_rawDescOnce sync.Once
+	file_smolearl_v1_smolearl_proto_rawDescData []byte
+)
+
+func file_smolearl_v1_smolearl_proto_rawDescGZIP() []byte {
+	file_smolearl_v1_smolearl_proto_rawDescOnce.Do(func() {
+		file_smolearl_v1_smolearl_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_smolearl_v1_smolearl_proto_rawDesc), len(file_smolearl_v1_smolearl_proto_rawDesc)))
+	})
+	return file_smolearl_v1_smolearl_proto_rawDescData
+}
+
+var file_smolearl_v1_smolearl_proto_msgTypes = make([]protoimpl.MessageInfo, 21)
+var file_smolearl_v1_smolearl_proto_goTypes = []any{
+	(*UTM)(nil),                   // 0: smolearl.v1.UTM
+	(*Destination)(nil),           // 1: smolearl.v1.Destination
+	(*DeepLink)(nil),              // 2: smolearl.v1.DeepLink
+	(*CreateLinkRequest)(nil),     // 3: smolearl.v1.CreateLinkRequest
+	(*CreateLinkResponse)(nil),    // 4: smolearl.v1.CreateLinkResponse
+	(*GetLinkRequest)(nil),        // 5: smolearl.v1.GetLinkRequest
+	(*Link)(nil),                  // 6: smolearl.v1.Link
+	(*ResolveLinkRequest)(nil),    // 7: smolearl.v1.ResolveLinkRequest
+	(*ResolveLinkResponse)(nil),   // 8: smolearl.v1.ResolveLinkResponse
+	(*GetStatsRequest)(nil),       // 9: smolearl.v1.GetStatsRequest
+	(*Count)(nil),                 // 10: smolearl.v1.Count
+	(*VariantStats)(nil),          // 11: smolearl.v1.VariantStats
+	(*DailyVisitors)(nil),         // 12: smolearl.v1.DailyVisitors
+	(*Stats)(nil),                 // 13: smolearl.v1.Stats
+	(*BatchItem)(nil),             // 14: smolearl.v1.BatchItem
+	(*BatchCreateRequest)(nil),    // 15: smolearl.v1.BatchCreateRequest
+	(*BatchResult)(nil),           // 16: smolearl.v1.BatchResult
+	(*BatchCreateResponse)(nil),   // 17: smolearl.v1.BatchCreateResponse
+	(*StreamClicksRequest)(nil),   // 18: smolearl.v1.StreamClicksRequest
+	(*ClickEvent)(nil),            // 19: smolearl.v1.ClickEvent
+	nil,                           // 20: smolearl.v1.ResolveLinkRequest.QueryEntry
+	(*timestamppb.Timestamp)(nil), // 21: google.protobuf.Timestamp
+	(*structpb.Struct)(nil),       // 22: google.protobuf.Struct
+}
+var file_smolearl_v1_smolearl_proto_depIdxs = []int32{
+	1,  // 0: smolearl.v1.CreateLinkRequest.destinations:type_name -> smolearl.v1.Destination
+	2,  // 1: smolearl.v1.CreateLinkRequest.deep_link:type_name -> smolearl.v1.DeepLink
+	0,  // 2: smolearl.v1.CreateLinkRequest.utm:type_name -> smolearl.v1.UTM
+	21, // 3: smolearl.v1.Link.created_at:type_name -> google.protobuf.Timestamp
+	1,  // 4: smolearl.v1.Link.destinations:type_name -> smolearl.v1.Destination
+	2,  // 5: smolearl.v1.Link.deep_link:type_name -> smolearl.v1.DeepLink
+	20, // 6: smolearl.v1.ResolveLinkRequest.query:type_name -> smolearl.v1.ResolveLinkRequest.QueryEntry
+	21, // 7: smolearl.v1.GetStatsRequest.from:type_name -> google.protobuf.Timestamp
+	21, // 8: smolearl.v1.GetStatsRequest.to:type_name -> google.protobuf.Timestamp
+	21, // 9: smolearl.v1.Stats.created_at:type_name -> google.protobuf.Timestamp
+	10, // 10: smolearl.v1.Stats.countries:type_name -> smolearl.v1.Count
+	10, // 11: smolearl.v1.Stats.channels:type_name -> smolearl.v1.Count
+	11, // 12: smolearl.v1.Stats.variants:type_name -> smolearl.v1.VariantStats
+	12, // 13: smolearl.v1.Stats.daily_visitors:type_name -> smolearl.v1.DailyVisitors
+	22, // 14: smolearl.v1.BatchItem.metadata:type_name -> google.protobuf.Struct
+	14, // 15: smolearl.v1.BatchCreateRequest.items:type_name -> smolearl.v1.BatchItem
+	16, // 16: smolearl.v1.BatchCreateResponse.results:type_name -> smolearl.v1.BatchResult
+	21, // 17: smolearl.v1.ClickEvent.occurred_at:type_name -> google.protobuf.Timestamp
+	0,  // 18: smolearl.v1.ClickEvent.utm:type_name -> smolearl.v1.UTM
+	3,  // 19: smolearl.v1.LinkService.CreateLink:input_type -> smolearl.v1.CreateLinkRequest
+	5,  // 20: smolearl.v1.LinkService.GetLink:input_type -> smolearl.v1.GetLinkRequest
+	7,  // 21: smolearl.v1.LinkService.ResolveLink:input_type -> smolearl.v1.ResolveLinkRequest
+	9,  // 22: smolearl.v1.LinkService.GetStats:input_type -> smolearl.v1.GetStatsRequest
+	15, // 23: smolearl.v1.LinkService.BatchCreate:input_type -> smolearl.v1.BatchCreateRequest
+	18, // 24: smolearl.v1.LinkService.StreamClicks:input_type -> smolearl.v1.StreamClicksRequest
+	4,  // 25: smolearl.v1.LinkService.CreateLink:output_type -> smolearl.v1.CreateLinkResponse
+	6,  // 26: smolearl.v1.LinkService.GetLink:output_type -> smolearl.v1.Link
+	8,  // 27: smolearl.v1.LinkService.ResolveLink:output_type -> smolearl.v1.ResolveLinkResponse
+	13, // 28: smolearl.v1.LinkService.GetStats:output_type -> smolearl.v1.Stats
+	17, // 29: smolearl.v1.LinkService.BatchCreate:output_type -> smolearl.v1.BatchCreateResponse
+	19, // 30: smolearl.v1.LinkService.StreamClicks:output_type -> smolearl.v1.ClickEvent
+	25, // [25:31] is the sub-list for method output_type
+	19, // [19:25] is the sub-list for method input_type
+	19, // [19:19] is the sub-list for extension type_name
+	19, // [19:19] is the sub-list for extension extendee
+	0,  // [0:19] is the sub-list for field type_name
+}
+
+func init() { file_smolearl_v1_smolearl_proto_init() }
+func file_smolearl_v1_smolearl_proto_init() {
+	if File_smolearl_v1_smolearl_proto != nil {
+		return
+	}
+	file_smolearl_v1_smolearl_proto_msgTypes[3].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_smolearl_v1_smolearl_proto_rawDesc), len(file_smolearl_v1_smolearl_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   21,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_smolearl_v1_smolearl_proto_goTypes,
+		DependencyIndexes: file_smolearl_v1_smolearl_proto_depIdxs,
+		MessageInfos:      file_smolearl_v1_smolearl_proto_msgTypes,
+	}.Build()
+	File_smolearl_v1_smolearl_proto = out.File
+	file_smolearl_v1_smolearl_proto_goTypes = nil
+	file_smolearl_v1_smolearl_proto_depIdxs = nil
+}
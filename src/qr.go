@@ -0,0 +1,352 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// QR code output formats
+const (
+	QRFormatPNG = "png"
+	QRFormatSVG = "svg"
+)
+
+const (
+	defaultQRSize   = 256
+	minQRSize       = 64
+	maxQRSize       = 2048
+	defaultQRMargin = 4
+	maxQRMargin     = 16
+	// qrLogoFraction is the share of the code's width covered by the logo
+	qrLogoFraction = 0.2
+	// minQRContrast is the WCAG contrast ratio below which scanners struggle
+	minQRContrast = 3.0
+)
+
+// qrLevels maps the ecc parameter to a recovery level
+var qrLevels = map[string]qrcode.RecoveryLevel{
+	"L": qrcode.Low,
+	"M": qrcode.Medium,
+	"Q": qrcode.High,
+	"H": qrcode.Highest,
+}
+
+// QROptions controls how a QR code is rendered
+type QROptions struct {
+	Format     string
+	Size       int
+	ECC        string
+	Margin     int
+	Foreground color.NRGBA
+	Background color.NRGBA
+	Logo       bool
+}
+
+// parseQROptions reads format, size, ecc, margin, fg, bg and logo from the
+// query string. A logo defaults the error correction to H so the covered
+// modules can be recovered.
+func parseQROptions(values url.Values) (QROptions, error) {
+	opts := QROptions{
+		Format:     QRFormatPNG,
+		Size:       defaultQRSize,
+		ECC:        "M",
+		Margin:     defaultQRMargin,
+		Foreground: color.NRGBA{A: 0xff},
+		Background: color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff},
+	}
+
+	if format := values.Get("format"); format != "" {
+		if format != QRFormatPNG && format != QRFormatSVG {
+			return opts, fmt.Errorf("format must be png or svg")
+		}
+		opts.Format = format
+	}
+
+	var err error
+	if raw := values.Get("size"); raw != "" {
+		if opts.Size, err = strconv.Atoi(raw); err != nil || opts.Size < minQRSize || opts.Size > maxQRSize {
+			return opts, fmt.Errorf("size must be between %d and %d", minQRSize, maxQRSize)
+		}
+	}
+	if raw := values.Get("margin"); raw != "" {
+		if opts.Margin, err = strconv.Atoi(raw); err != nil || opts.Margin < 0 || opts.Margin > maxQRMargin {
+			return opts, fmt.Errorf("margin must be between 0 and %d", maxQRMargin)
+		}
+	}
+
+	if raw := values.Get("logo"); raw != "" {
+		if opts.Logo, err = strconv.ParseBool(raw); err != nil {
+			return opts, fmt.Errorf("logo must be true or false")
+		}
+	}
+	if opts.Logo {
+		opts.ECC = "H"
+	}
+	if raw := values.Get("ecc"); raw != "" {
+		raw = strings.ToUpper(raw)
+		if _, ok := qrLevels[raw]; !ok {
+			return opts, fmt.Errorf("ecc must be L, M, Q or H")
+		}
+		if opts.Logo && raw != "Q" && raw != "H" {
+			return opts, fmt.Errorf("a logo requires ecc Q or H")
+		}
+		opts.ECC = raw
+	}
+
+	if raw := values.Get("fg"); raw != "" {
+		if opts.Foreground, err = parseHexColor(raw); err != nil {
+			return opts, fmt.Errorf("invalid fg: %w", err)
+		}
+	}
+	if raw := values.Get("bg"); raw != "" {
+		if opts.Background, err = parseHexColor(raw); err != nil {
+			return opts, fmt.Errorf("invalid bg: %w", err)
+		}
+	}
+	fg, bg := luminance(opts.Foreground), luminance(opts.Background)
+	if fg >= bg || (bg+0.05)/(fg+0.05) < minQRContrast {
+		return opts, fmt.Errorf("fg must be darker than bg with a contrast ratio of at least %.0f:1", minQRContrast)
+	}
+	return opts, nil
+}
+
+// parseHexColor parses RGB or RRGGBB, with or without a leading #
+func parseHexColor(raw string) (color.NRGBA, error) {
+	s := strings.TrimPrefix(raw, "#")
+	if len(s) == 3 {
+		s = string([]byte{s[0], s[0], s[1], s[1], s[2], s[2]})
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != 3 {
+		return color.NRGBA{}, fmt.Errorf("%q is not a hex color", raw)
+	}
+	return color.NRGBA{R: b[0], G: b[1], B: b[2], A: 0xff}, nil
+}
+
+// luminance returns the WCAG relative luminance of c
+func luminance(c color.NRGBA) float64 {
+	channel := func(v uint8) float64 {
+		f := float64(v) / 255
+		if f <= 0.03928 {
+			return f / 12.92
+		}
+		return math.Pow((f+0.055)/1.055, 2.4)
+	}
+	return 0.2126*channel(c.R) + 0.7152*channel(c.G) + 0.0722*channel(c.B)
+}
+
+// hexColor formats c as #rrggbb
+func hexColor(c color.NRGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// QRRenderer draws QR codes pointing at short links
+type QRRenderer struct {
+	baseURL  string
+	logo     image.Image
+	logoPNG  []byte
+	logoHash string
+}
+
+// NewQRRenderer creates a QRRenderer for links under baseURL
+func NewQRRenderer(baseURL string) *QRRenderer {
+	return &QRRenderer{baseURL: strings.TrimSuffix(baseURL, "/")}
+}
+
+// SetLogo sets the PNG drawn in the center of codes requested with a logo
+func (q *QRRenderer) SetLogo(data []byte) error {
+	logo, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to decode QR logo: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	q.logo, q.logoPNG, q.logoHash = logo, data, hex.EncodeToString(sum[:8])
+	return nil
+}
+
+// HasLogo reports whether a logo is configured
+func (q *QRRenderer) HasLogo() bool {
+	return q.logo != nil
+}
+
+// LinkURL returns the public URL of a short code
+func (q *QRRenderer) LinkURL(shortCode string) string {
+	return q.baseURL + "/" + url.PathEscape(shortCode)
+}
+
+// ETag identifies the image Render produces for the same arguments
+func (q *QRRenderer) ETag(shortCode string, opts QROptions) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%d\x00%s\x00%d\x00%s\x00%s\x00%t\x00%s",
+		q.LinkURL(shortCode), opts.Format, opts.Size, opts.ECC, opts.Margin,
+		hexColor(opts.Foreground), hexColor(opts.Background), opts.Logo, q.logoHash)
+	return `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+// Render draws the QR code of a short code and returns it with its media type
+func (q *QRRenderer) Render(shortCode string, opts QROptions) ([]byte, string, error) {
+	if opts.Logo && q.logo == nil {
+		return nil, "", fmt.Errorf("no QR logo is configured")
+	}
+
+	code, err := qrcode.New(q.LinkURL(shortCode), qrLevels[opts.ECC])
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to encode QR code: %w", err)
+	}
+	code.DisableBorder = true
+	modules := code.Bitmap()
+
+	// The logo replaces a centered square of modules, kept at the same
+	// parity as the code so it sits exactly in the middle
+	logoModules := 0
+	if opts.Logo {
+		logoModules = int(float64(len(modules)) * qrLogoFraction)
+		if (len(modules)-logoModules)%2 != 0 {
+			logoModules++
+		}
+	}
+	layout := qrLayout{modules: modules, margin: opts.Margin, logoModules: logoModules}
+
+	if opts.Format == QRFormatSVG {
+		return q.renderSVG(layout, opts), "image/svg+xml", nil
+	}
+	data, err := q.renderPNG(layout, opts)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, "image/png", nil
+}
+
+// qrLayout places the modules of a code inside its margin
+type qrLayout struct {
+	modules     [][]bool
+	margin      int
+	logoModules int
+}
+
+// total is the width of the code including its margin, in modules
+func (l qrLayout) total() int {
+	return len(l.modules) + 2*l.margin
+}
+
+// logoStart is the first module row and column covered by the logo
+func (l qrLayout) logoStart() int {
+	return (len(l.modules) - l.logoModules) / 2
+}
+
+// dark reports whether the module at x, y is drawn in the foreground color
+func (l qrLayout) dark(x, y int) bool {
+	if l.logoModules > 0 {
+		start := l.logoStart()
+		if x >= start && x < start+l.logoModules && y >= start && y < start+l.logoModules {
+			return false
+		}
+	}
+	return l.modules[y][x]
+}
+
+// renderPNG draws square modules of a whole number of pixels, centering the
+// code when size is not a multiple of its width
+func (q *QRRenderer) renderPNG(layout qrLayout, opts QROptions) ([]byte, error) {
+	scale := opts.Size / layout.total()
+	if scale < 1 {
+		return nil, fmt.Errorf("size %d is too small for a code of %d modules", opts.Size, layout.total())
+	}
+	offset := (opts.Size - scale*len(layout.modules)) / 2
+
+	img := image.NewNRGBA(image.Rect(0, 0, opts.Size, opts.Size))
+	draw.Draw(img, img.Bounds(), image.NewUniform(opts.Background), image.Point{}, draw.Src)
+	fg := image.NewUniform(opts.Foreground)
+	for y, row := range layout.modules {
+		for x := range row {
+			if layout.dark(x, y) {
+				r := image.Rect(offset+x*scale, offset+y*scale, offset+(x+1)*scale, offset+(y+1)*scale)
+				draw.Draw(img, r, fg, image.Point{}, draw.Src)
+			}
+		}
+	}
+
+	if layout.logoModules > 0 {
+		// Leave a one module gap between the logo and the code
+		start := offset + (layout.logoStart()+1)*scale
+		box := image.Rect(start, start, start+(layout.logoModules-2)*scale, start+(layout.logoModules-2)*scale)
+		drawScaled(img, box, q.logo)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode PNG: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// drawScaled draws src over dst, fitted into box with its aspect ratio kept,
+// using nearest neighbour sampling
+func drawScaled(dst draw.Image, box image.Rectangle, src image.Image) {
+	sb := src.Bounds()
+	if box.Empty() || sb.Empty() {
+		return
+	}
+	ratio := math.Min(float64(box.Dx())/float64(sb.Dx()), float64(box.Dy())/float64(sb.Dy()))
+	w, h := int(float64(sb.Dx())*ratio), int(float64(sb.Dy())*ratio)
+	if w < 1 || h < 1 {
+		return
+	}
+
+	scaled := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := range h {
+		for x := range w {
+			scaled.Set(x, y, src.At(sb.Min.X+x*sb.Dx()/w, sb.Min.Y+y*sb.Dy()/h))
+		}
+	}
+	at := image.Pt(box.Min.X+(box.Dx()-w)/2, box.Min.Y+(box.Dy()-h)/2)
+	draw.Draw(dst, scaled.Bounds().Add(at), scaled, image.Point{}, draw.Over)
+}
+
+// renderSVG draws the code in module units, scaled to size by the viewBox
+func (q *QRRenderer) renderSVG(layout qrLayout, opts QROptions) []byte {
+	total := layout.total()
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		opts.Size, opts.Size, total, total)
+	fmt.Fprintf(&buf, `<rect width="%d" height="%d" fill="%s"/>`, total, total, hexColor(opts.Background))
+
+	// One horizontal run of dark modules per subpath keeps the output small
+	fmt.Fprintf(&buf, `<path fill="%s" d="`, hexColor(opts.Foreground))
+	for y, row := range layout.modules {
+		for x := 0; x < len(row); {
+			if !layout.dark(x, y) {
+				x++
+				continue
+			}
+			run := 0
+			for x+run < len(row) && layout.dark(x+run, y) {
+				run++
+			}
+			fmt.Fprintf(&buf, "M%d %dh%dv1h-%dz", x+layout.margin, y+layout.margin, run, run)
+			x += run
+		}
+	}
+	buf.WriteString(`"/>`)
+
+	if layout.logoModules > 0 {
+		start := layout.margin + layout.logoStart() + 1
+		fmt.Fprintf(&buf, `<image x="%d" y="%d" width="%d" height="%d" preserveAspectRatio="xMidYMid meet" href="data:image/png;base64,%s"/>`,
+			start, start, layout.logoModules-2, layout.logoModules-2, base64.StdEncoding.EncodeToString(q.logoPNG))
+	}
+	buf.WriteString(`</svg>`)
+	return buf.Bytes()
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"net"
+	"net/url"
+	"strings"
+)
+
+// Traffic channels a click can be attributed to
+const (
+	ChannelDirect   = "direct"
+	ChannelSocial   = "social"
+	ChannelSearch   = "search"
+	ChannelEmail    = "email"
+	ChannelPaid     = "paid"
+	ChannelReferral = "referral"
+)
+
+// UTM holds the campaign parameters of a resolve request or a destination
+type UTM struct {
+	Source   string `json:"source,omitempty"`
+	Medium   string `json:"medium,omitempty"`
+	Campaign string `json:"campaign,omitempty"`
+	Term     string `json:"term,omitempty"`
+	Content  string `json:"content,omitempty"`
+}
+
+// maxUTMLength bounds stored utm_* values, in bytes
+const maxUTMLength = 255
+
+// utmFromQuery extracts the utm_* parameters from a query string
+func utmFromQuery(query url.Values) UTM {
+	get := func(key string) string {
+		return truncate(strings.TrimSpace(query.Get(key)), maxUTMLength)
+	}
+	return UTM{
+		Source:   get("utm_source"),
+		Medium:   get("utm_medium"),
+		Campaign: get("utm_campaign"),
+		Term:     get("utm_term"),
+		Content:  get("utm_content"),
+	}
+}
+
+// socialDomains, searchDomains and emailDomains are matched against the
+// normalized referrer domain and its parent domains
+var (
+	socialDomains = map[string]bool{
+		"facebook.com": true, "fb.com": true, "instagram.com": true, "t.co": true,
+		"twitter.com": true, "x.com": true, "linkedin.com": true, "lnkd.in": true,
+		"reddit.com": true, "youtube.com": true, "tiktok.com": true, "pinterest.com": true,
+		"threads.net": true, "bsky.app": true, "news.ycombinator.com": true, "whatsapp.com": true,
+		"telegram.org": true, "t.me": true, "discord.com": true, "mastodon.social": true,
+	}
+	searchDomains = map[string]bool{
+		"google.com": true, "bing.com": true, "duckduckgo.com": true, "search.yahoo.com": true,
+		"baidu.com": true, "yandex.ru": true, "yandex.com": true, "ecosia.org": true,
+		"search.brave.com": true, "startpage.com": true, "naver.com": true,
+	}
+	emailDomains = map[string]bool{
+		"mail.google.com": true, "outlook.live.com": true, "outlook.office.com": true,
+		"outlook.office365.com": true, "mail.yahoo.com": true, "mail.proton.me": true,
+		"mail.aol.com": true,
+	}
+)
+
+// normalizeReferrer reduces a Referer header to a lowercase host without port
+// or leading www. Unparseable values yield an empty domain.
+func normalizeReferrer(referer string) string {
+	u, err := url.Parse(strings.TrimSpace(referer))
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	host := strings.ToLower(u.Host)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(host, ".")
+	return strings.TrimPrefix(host, "www.")
+}
+
+// matchesDomain reports whether domain or one of its parents is in set. Google
+// style country domains (google.co.uk) match their .com entry.
+func matchesDomain(set map[string]bool, domain string) bool {
+	for d := domain; d != ""; {
+		if set[d] {
+			return true
+		}
+		if label, rest, ok := strings.Cut(d, "."); ok {
+			if (label == "google" || label == "bing" || label == "yandex") && set[label+".com"] {
+				return true
+			}
+			d = rest
+		} else {
+			break
+		}
+	}
+	return false
+}
+
+// classifyChannel attributes a click to a channel. An explicit utm_medium wins
+// over the referrer since campaign links are often opened from apps that send
+// no Referer at all.
+func classifyChannel(domain string, utm UTM) string {
+	switch strings.ToLower(utm.Medium) {
+	case "email", "e-mail", "newsletter":
+		return ChannelEmail
+	case "social", "social-media", "social_media":
+		return ChannelSocial
+	case "cpc", "ppc", "paid", "paidsearch", "display":
+		return ChannelPaid
+	}
+
+	switch {
+	case domain == "":
+		return ChannelDirect
+	case matchesDomain(emailDomains, domain):
+		return ChannelEmail
+	case matchesDomain(searchDomains, domain):
+		return ChannelSearch
+	case matchesDomain(socialDomains, domain):
+		return ChannelSocial
+	default:
+		return ChannelReferral
+	}
+}
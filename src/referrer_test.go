@@ -0,0 +1,33 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestUTMFromQueryTruncates(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{"short", " news ", "news"},
+		{"ascii", strings.Repeat("a", 300), strings.Repeat("a", maxUTMLength)},
+		// "é" is two bytes, so byte 255 falls inside the 128th
+		{"multibyte", strings.Repeat("é", 200), strings.Repeat("é", 127)},
+		{"emoji", "a" + strings.Repeat("🙂", 70), "a" + strings.Repeat("🙂", 63)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := utmFromQuery(url.Values{"utm_source": {tt.value}}).Source
+			if got != tt.want {
+				t.Errorf("Source = %q (%d bytes), want %q", got, len(got), tt.want)
+			}
+			if !utf8.ValidString(got) || len(got) > maxUTMLength {
+				t.Errorf("Source is %d bytes, valid UTF-8 %v", len(got), utf8.ValidString(got))
+			}
+		})
+	}
+}
@@ -2,46 +2,253 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/mahopon/SmolEarl/infra/db"
 )
 
 // EntryRepository handles database operations for entries
 type EntryRepository struct {
-	pool *pgxpool.Pool
+	db *db.DB
 }
 
 // NewEntryRepository creates a new EntryRepository
-func NewEntryRepository(pool *pgxpool.Pool) *EntryRepository {
+func NewEntryRepository(database *db.DB) *EntryRepository {
 	return &EntryRepository{
-		pool: pool,
+		db: database,
 	}
 }
 
 // Entry represents a shortened URL entry
 type Entry struct {
-	ShortCode  string
+	ID          int64
+	ShortCode   string
 	OriginalURL string
-	Clicks     int
-	CreatedAt  time.Time
+	Clicks      int
+	CreatedAt   time.Time
+	Owner       string
+	Metadata    map[string]any
+	Sticky      string
+	DeepLink    DeepLink
+	ExpiresAt   *time.Time
+	Details     LinkDetails
 }
 
-// Create inserts a new entry into the database
-func (r *EntryRepository) Create(ctx context.Context, shortCode, originalURL string, clicks int, createdAt time.Time) error {
-	_, err := r.pool.Exec(ctx,
-		"INSERT INTO entries (short_code, original_url, clicks, created_at) VALUES ($1, $2, $3, $4) ON CONFLICT (short_code) DO NOTHING",
-		shortCode, originalURL, clicks, createdAt)
+// campaignArgs returns the utm_source, utm_medium and utm_campaign columns of
+// an entry, taken from its destination's query string
+func campaignArgs(originalURL string) []any {
+	var utm UTM
+	if u, err := url.Parse(originalURL); err == nil {
+		utm = utmFromQuery(u.Query())
+	}
+	return []any{utm.Source, utm.Medium, utm.Campaign}
+}
+
+// Create inserts a new entry with its details into the database in one
+// transaction. created is false when the short code already exists, in which
+// case nothing is written.
+func (r *EntryRepository) Create(ctx context.Context, shortCode, originalURL, owner string, clicks int, createdAt time.Time, deepLink DeepLink, expiresAt *time.Time, details LinkDetails) (bool, error) {
+	tx, err := r.db.Pool().Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx,
+		`INSERT INTO entries (short_code, original_url, owner, clicks, created_at, url_hash, utm_source, utm_medium, utm_campaign,
+			ios_url, android_url, title, description, notes, folder_id, expires_at)
+		VALUES ($1, $2, $3, $4, $5, sha256(convert_to($2, 'UTF8')), $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+		ON CONFLICT (short_code) DO NOTHING`,
+		append(append([]any{shortCode, originalURL, owner, clicks, createdAt}, campaignArgs(originalURL)...),
+			deepLink.IOS, deepLink.Android, details.Title, details.Description, details.Notes, details.FolderID, expiresAt)...)
+	if err != nil {
+		return false, err
+	}
+	if tag.RowsAffected() == 0 {
+		return false, nil
+	}
+	if err := insertTags(ctx, tx, shortCode, details.Tags); err != nil {
+		return false, err
+	}
+	return true, tx.Commit(ctx)
+}
+
+// insertTags tags an entry inserted in tx
+func insertTags(ctx context.Context, tx pgx.Tx, shortCode string, tags []string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	_, err := tx.Exec(ctx, insertTagsQuery, shortCode, tags)
 	return err
 }
 
+// CreateSplit inserts an entry with several weighted destinations and its
+// details in one transaction. The first destination is stored as the entry's
+// original_url. created is false when the short code already exists.
+func (r *EntryRepository) CreateSplit(ctx context.Context, shortCode, owner, sticky string, variants []Variant, createdAt time.Time, deepLink DeepLink, expiresAt *time.Time, details LinkDetails) (bool, error) {
+	tx, err := r.db.Pool().Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx,
+		`INSERT INTO entries (short_code, original_url, owner, clicks, created_at, url_hash, utm_source, utm_medium, utm_campaign,
+			sticky, ios_url, android_url, title, description, notes, folder_id, expires_at)
+		VALUES ($1, $2, $3, 0, $4, sha256(convert_to($2, 'UTF8')), $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+		ON CONFLICT (short_code) DO NOTHING`,
+		append(append([]any{shortCode, variants[0].URL, owner, createdAt}, campaignArgs(variants[0].URL)...),
+			sticky, deepLink.IOS, deepLink.Android, details.Title, details.Description, details.Notes, details.FolderID,
+			expiresAt)...)
+	if err != nil {
+		return false, err
+	}
+	if tag.RowsAffected() == 0 {
+		return false, nil
+	}
+
+	for i, v := range variants {
+		_, err := tx.Exec(ctx,
+			`INSERT INTO entry_destinations (short_code, variant, url, weight, position) VALUES ($1, $2, $3, $4, $5)`,
+			shortCode, v.Name, v.URL, v.Weight, i)
+		if err != nil {
+			return false, err
+		}
+	}
+	if err := insertTags(ctx, tx, shortCode, details.Tags); err != nil {
+		return false, err
+	}
+	return true, tx.Commit(ctx)
+}
+
+// GetVariants returns the destinations of a split link in order, or none for
+// a plain link
+func (r *EntryRepository) GetVariants(ctx context.Context, shortCode string) ([]Variant, error) {
+	rows, err := r.db.Query(ctx,
+		"SELECT variant, url, weight FROM entry_destinations WHERE short_code = $1 ORDER BY position", shortCode)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToStructByPos[Variant])
+}
+
+// GetVariantStats counts the human clicks served by each destination of a
+// split link
+func (r *EntryRepository) GetVariantStats(ctx context.Context, shortCode string) ([]VariantStats, error) {
+	rows, err := r.db.Query(ctx,
+		`SELECT d.variant, d.url, d.weight, COUNT(c.id) FROM entry_destinations d
+		LEFT JOIN click_events c ON c.short_code = d.short_code AND c.variant = d.variant AND NOT c.is_bot
+		WHERE d.short_code = $1 GROUP BY d.variant, d.url, d.weight, d.position ORDER BY d.position`, shortCode)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToStructByPos[VariantStats])
+}
+
+// GetRules returns the routing rules of an entry and whether the entry
+// exists
+func (r *EntryRepository) GetRules(ctx context.Context, shortCode string) ([]Rule, bool, error) {
+	var rules []Rule
+	err := r.db.QueryRow(ctx,
+		`SELECT COALESCE(r.rules, '[]') FROM entries e LEFT JOIN entry_rules r ON r.short_code = e.short_code
+		WHERE e.short_code = $1`, shortCode).Scan(&rules)
+	if err == pgx.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return rules, true, nil
+}
+
+// SaveRules replaces the routing rules of an entry and reports whether the
+// entry exists. An empty list removes them.
+func (r *EntryRepository) SaveRules(ctx context.Context, shortCode string, rules []Rule) (bool, error) {
+	if len(rules) == 0 {
+		var exists bool
+		err := r.db.QueryRow(ctx,
+			`WITH deleted AS (DELETE FROM entry_rules WHERE short_code = $1)
+			SELECT EXISTS (SELECT 1 FROM entries WHERE short_code = $1)`, shortCode).Scan(&exists)
+		return exists, err
+	}
+	tag, err := r.db.Exec(ctx,
+		`INSERT INTO entry_rules (short_code, rules, updated_at)
+		SELECT short_code, $2::jsonb, NOW() FROM entries WHERE short_code = $1
+		ON CONFLICT (short_code) DO UPDATE SET rules = EXCLUDED.rules, updated_at = EXCLUDED.updated_at`,
+		shortCode, rules)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// CreateBatch inserts many entries with their details in one transaction and
+// reports, per entry, whether it was inserted or skipped because its short
+// code exists
+func (r *EntryRepository) CreateBatch(ctx context.Context, entries []Entry) ([]bool, error) {
+	tx, err := r.db.Pool().Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	batch := &pgx.Batch{}
+	for _, e := range entries {
+		metadata := e.Metadata
+		if metadata == nil {
+			metadata = map[string]any{}
+		}
+		batch.Queue(
+			`INSERT INTO entries (short_code, original_url, owner, clicks, created_at, metadata, url_hash,
+				utm_source, utm_medium, utm_campaign, title, description, notes, folder_id)
+			VALUES ($1, $2, $3, 0, $4, $5, sha256(convert_to($2, 'UTF8')), $6, $7, $8, $9, $10, $11, $12)
+			ON CONFLICT (short_code) DO NOTHING`,
+			append(append([]any{e.ShortCode, e.OriginalURL, e.Owner, e.CreatedAt, metadata}, campaignArgs(e.OriginalURL)...),
+				e.Details.Title, e.Details.Description, e.Details.Notes, e.Details.FolderID)...)
+	}
+
+	results := tx.SendBatch(ctx, batch)
+	defer results.Close()
+
+	inserted := make([]bool, len(entries))
+	for i := range entries {
+		tag, err := results.Exec()
+		if err != nil {
+			return nil, err
+		}
+		inserted[i] = tag.RowsAffected() == 1
+	}
+	if err := results.Close(); err != nil {
+		return nil, err
+	}
+
+	tags := &pgx.Batch{}
+	for i, e := range entries {
+		if inserted[i] && len(e.Details.Tags) > 0 {
+			tags.Queue(insertTagsQuery, e.ShortCode, e.Details.Tags)
+		}
+	}
+	if tags.Len() > 0 {
+		if err := tx.SendBatch(ctx, tags).Close(); err != nil {
+			return nil, err
+		}
+	}
+	return inserted, tx.Commit(ctx)
+}
+
 // GetByShortCode retrieves an entry by its short code
 func (r *EntryRepository) GetByShortCode(ctx context.Context, shortCode string) (*Entry, error) {
 	var entry Entry
-	err := r.pool.QueryRow(ctx,
-		"SELECT original_url, clicks, created_at FROM entries WHERE short_code = $1", shortCode).
-		Scan(&entry.OriginalURL, &entry.Clicks, &entry.CreatedAt)
+	err := r.db.QueryRow(ctx,
+		`SELECT original_url, clicks, created_at, owner, sticky, ios_url, android_url, expires_at FROM entries
+		WHERE short_code = $1`, shortCode).
+		Scan(&entry.OriginalURL, &entry.Clicks, &entry.CreatedAt, &entry.Owner, &entry.Sticky,
+			&entry.DeepLink.IOS, &entry.DeepLink.Android, &entry.ExpiresAt)
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			return nil, nil
@@ -52,11 +259,41 @@ func (r *EntryRepository) GetByShortCode(ctx context.Context, shortCode string)
 	return &entry, nil
 }
 
+// DeleteEntry removes an entry with its details, destinations, rules and
+// recorded clicks in one transaction, and returns the deleted entry or nil if
+// it did not exist
+func (r *EntryRepository) DeleteEntry(ctx context.Context, shortCode string) (*Entry, error) {
+	tx, err := r.db.Pool().Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	entry := Entry{ShortCode: shortCode}
+	err = tx.QueryRow(ctx,
+		"DELETE FROM entries WHERE short_code = $1 RETURNING original_url, owner, created_at", shortCode).
+		Scan(&entry.OriginalURL, &entry.Owner, &entry.CreatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Clicks are not tied to entries by a foreign key, so a code reused
+	// later would inherit them
+	for _, table := range []string{"click_events", "click_rollups_hourly", "click_rollups_daily", "unique_visitors_daily"} {
+		if _, err := tx.Exec(ctx, "DELETE FROM "+table+" WHERE short_code = $1", shortCode); err != nil {
+			return nil, err
+		}
+	}
+	return &entry, tx.Commit(ctx)
+}
+
 // GetStats retrieves stats for an entry by its short code
 func (r *EntryRepository) GetStats(ctx context.Context, shortCode string) (int, time.Time, error) {
 	var clicks int
 	var createdAt time.Time
-	err := r.pool.QueryRow(ctx,
+	err := r.db.QueryRow(ctx,
 		"SELECT clicks, created_at FROM entries WHERE short_code = $1", shortCode).
 		Scan(&clicks, &createdAt)
 	if err != nil {
@@ -67,3 +304,1018 @@ func (r *EntryRepository) GetStats(ctx context.Context, shortCode string) (int,
 	}
 	return clicks, createdAt, nil
 }
+
+// RecordClick stores a click event and increments the entry's click counter
+func (r *EntryRepository) RecordClick(ctx context.Context, click Click) error {
+	tx, err := r.db.Pool().Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO click_events (short_code, occurred_at, country, region, city,
+			browser, browser_version, os, device, is_bot, bot_name,
+			referrer_domain, channel, utm_source, utm_medium, utm_campaign, utm_term, utm_content, variant)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19)`,
+		click.ShortCode, click.OccurredAt, click.Country, click.Region, click.City,
+		click.Browser, click.BrowserVersion, click.OS, click.Device, click.Bot, click.BotName,
+		click.ReferrerDomain, click.Channel, click.UTM.Source, click.UTM.Medium, click.UTM.Campaign,
+		click.UTM.Term, click.UTM.Content, click.Variant)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, "UPDATE entries SET clicks = clicks + 1 WHERE short_code = $1", click.ShortCode)
+	if err != nil {
+		return err
+	}
+
+	for _, rollup := range []struct{ table, unit string }{
+		{"click_rollups_hourly", "hour"},
+		{"click_rollups_daily", "day"},
+	} {
+		_, err = tx.Exec(ctx, fmt.Sprintf(
+			`INSERT INTO %[1]s (short_code, bucket, clicks) VALUES ($1, date_trunc('%[2]s', $2::timestamptz, 'UTC'), 1)
+			ON CONFLICT (short_code, bucket) DO UPDATE SET clicks = %[1]s.clicks + 1`, rollup.table, rollup.unit),
+			click.ShortCode, click.OccurredAt)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// GetCountryBreakdown counts the clicks of an entry per country, most clicks first
+func (r *EntryRepository) GetCountryBreakdown(ctx context.Context, shortCode string) ([]CountryCount, error) {
+	rows, err := r.db.Query(ctx,
+		`SELECT COALESCE(NULLIF(country, ''), 'unknown'), COUNT(*) FROM click_events
+		WHERE short_code = $1 GROUP BY 1 ORDER BY 2 DESC, 1`, shortCode)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowToStructByPos[CountryCount])
+}
+
+// breakdownColumns whitelists the click_events columns GetBreakdown may group by
+var breakdownColumns = map[string]bool{
+	"browser":         true,
+	"os":              true,
+	"device":          true,
+	"bot_name":        true,
+	"referrer_domain": true,
+	"channel":         true,
+	"utm_source":      true,
+	"utm_medium":      true,
+	"utm_campaign":    true,
+}
+
+// GetBreakdown counts the clicks of an entry per value of column, most clicks
+// first and at most limit rows when limit is positive. Bot clicks are excluded
+// unless column is bot_name.
+func (r *EntryRepository) GetBreakdown(ctx context.Context, shortCode, column string, limit int) ([]BreakdownItem, error) {
+	if !breakdownColumns[column] {
+		return nil, fmt.Errorf("unsupported breakdown column %q", column)
+	}
+
+	filter := "NOT is_bot"
+	if column == "bot_name" {
+		filter = "is_bot"
+	}
+
+	rows, err := r.db.Query(ctx, fmt.Sprintf(
+		`SELECT COALESCE(NULLIF(%[1]s, ''), 'unknown'), COUNT(*) FROM click_events
+		WHERE short_code = $1 AND %[2]s GROUP BY 1 ORDER BY 2 DESC, 1
+		LIMIT NULLIF($2, 0)`, column, filter), shortCode, limit)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToStructByPos[BreakdownItem])
+}
+
+// timeSeriesQueries aggregates a TimeSeriesQuery from each source. $2 is the
+// bucket unit and $3 the time zone name.
+var timeSeriesQueries = map[string]string{
+	sourceEvents: `SELECT date_trunc($2::text, occurred_at, $3::text), COUNT(*) FROM click_events
+		WHERE short_code = $1 AND occurred_at >= $4 AND occurred_at < $5 GROUP BY 1`,
+	sourceHourly: `SELECT date_trunc($2::text, bucket, $3::text), SUM(clicks)::bigint FROM click_rollups_hourly
+		WHERE short_code = $1 AND bucket >= $4 AND bucket < $5 GROUP BY 1`,
+	sourceDaily: `SELECT date_trunc($2::text, bucket, $3::text), SUM(clicks)::bigint FROM click_rollups_daily
+		WHERE short_code = $1 AND bucket >= $4 AND bucket < $5 GROUP BY 1`,
+}
+
+// GetClickBuckets counts the clicks of an entry per bucket, keyed by bucket
+// start in Unix seconds. Empty buckets are omitted.
+func (r *EntryRepository) GetClickBuckets(ctx context.Context, q TimeSeriesQuery) (map[int64]int, error) {
+	rows, err := r.db.Query(ctx, timeSeriesQueries[q.source()],
+		q.ShortCode, q.Interval, q.Location.String(), q.From, q.end())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[int64]int)
+	for rows.Next() {
+		var start time.Time
+		var clicks int
+		if err := rows.Scan(&start, &clicks); err != nil {
+			return nil, err
+		}
+		counts[start.Unix()] += clicks
+	}
+	return counts, rows.Err()
+}
+
+// SaveVisitorHLL stores the raw HyperLogLog of an entry's visitors on day
+func (r *EntryRepository) SaveVisitorHLL(ctx context.Context, shortCode, day string, hll []byte) error {
+	_, err := r.db.Exec(ctx,
+		`INSERT INTO unique_visitors_daily (short_code, day, hll, updated_at) VALUES ($1, $2::date, $3, NOW())
+		ON CONFLICT (short_code, day) DO UPDATE SET hll = EXCLUDED.hll, updated_at = EXCLUDED.updated_at`,
+		shortCode, day, hll)
+	return err
+}
+
+// GetVisitorHLLs returns the persisted HyperLogLogs of an entry between from
+// and to inclusive, keyed by YYYY-MM-DD day
+func (r *EntryRepository) GetVisitorHLLs(ctx context.Context, shortCode string, days []string) (map[string][]byte, error) {
+	rows, err := r.db.Query(ctx,
+		"SELECT day, hll FROM unique_visitors_daily WHERE short_code = $1 AND day = ANY ($2::date[])",
+		shortCode, days)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hlls := make(map[string][]byte)
+	for rows.Next() {
+		var day time.Time
+		var hll []byte
+		if err := rows.Scan(&day, &hll); err != nil {
+			return nil, err
+		}
+		hlls[day.Format(time.DateOnly)] = hll
+	}
+	return hlls, rows.Err()
+}
+
+// entryRecordColumns are the columns of an entry exported as a LinkRecord,
+// scanned by Entry.recordFields
+const entryRecordColumns = "short_code, original_url, clicks, created_at, owner, metadata, title, description, notes, " +
+	tagsColumn
+
+// recordFields returns the scan destinations of entryRecordColumns
+func (e *Entry) recordFields() []any {
+	return []any{&e.ShortCode, &e.OriginalURL, &e.Clicks, &e.CreatedAt, &e.Owner, &e.Metadata,
+		&e.Details.Title, &e.Details.Description, &e.Details.Notes, &e.Details.Tags}
+}
+
+// filterConditions returns the SQL conditions selecting the entries matching
+// filter, numbering their parameters after args
+func filterConditions(filter ExportFilter, args []any) (string, []any) {
+	var query string
+	if filter.Owner != "" {
+		args = append(args, filter.Owner)
+		query += fmt.Sprintf(" AND owner = $%d", len(args))
+	}
+	if filter.Tag != "" {
+		args = append(args, filter.Tag)
+		query += fmt.Sprintf(" AND EXISTS (SELECT 1 FROM entry_tags t WHERE t.short_code = entries.short_code AND t.tag = $%d)",
+			len(args))
+	}
+	if filter.FolderID != nil {
+		args = append(args, *filter.FolderID)
+		query += fmt.Sprintf(` AND folder_id IN (WITH RECURSIVE subtree AS (
+			SELECT id FROM folders WHERE id = $%d
+			UNION ALL
+			SELECT f.id FROM folders f JOIN subtree s ON f.parent_id = s.id
+		) SELECT id FROM subtree)`, len(args))
+	}
+	if !filter.CreatedAfter.IsZero() {
+		args = append(args, filter.CreatedAfter)
+		query += fmt.Sprintf(" AND created_at >= $%d", len(args))
+	}
+	if !filter.CreatedBefore.IsZero() {
+		args = append(args, filter.CreatedBefore)
+		query += fmt.Sprintf(" AND created_at < $%d", len(args))
+	}
+	return query, args
+}
+
+// likeEscaper escapes the wildcards of a LIKE pattern
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// linkQueryConditions extends filterConditions with the full-text and
+// substring search of q. Words are matched through the search tsvector, and
+// URL fragments the text search parser keeps whole, like paths, through the
+// trigram index on original_url.
+func linkQueryConditions(q LinkQuery) (string, []any) {
+	query, args := filterConditions(q.Filter, nil)
+	if q.Search != "" {
+		args = append(args, q.Search, "%"+likeEscaper.Replace(q.Search)+"%")
+		query += fmt.Sprintf(" AND (search @@ websearch_to_tsquery('simple', $%d) OR original_url ILIKE $%d)",
+			len(args)-1, len(args))
+	}
+	return query, args
+}
+
+// ListEntries returns up to limit entries matching q after q.After, in the
+// order of q.Sort. Clicks keep changing, so a listing by clicks may skip or
+// repeat links that are clicked while it is paged through.
+func (r *EntryRepository) ListEntries(ctx context.Context, q LinkQuery, limit int) ([]Entry, error) {
+	conditions, args := linkQueryConditions(q)
+	column := "created_at"
+	if q.Sort == SortClicks {
+		column = "clicks"
+	}
+	if q.After != nil {
+		var key any = q.After.CreatedAt
+		if q.Sort == SortClicks {
+			key = q.After.Clicks
+		}
+		args = append(args, key, q.After.ID)
+		conditions += fmt.Sprintf(" AND (%s, id) < ($%d, $%d)", column, len(args)-1, len(args))
+	}
+	args = append(args, limit)
+	query := "SELECT " + entryRecordColumns + ", id, folder_id FROM entries WHERE TRUE" +
+		conditions + fmt.Sprintf(" ORDER BY %[1]s DESC, id DESC LIMIT $%[2]d", column, len(args))
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []Entry
+	for rows.Next() {
+		var e Entry
+		if err := rows.Scan(append(e.recordFields(), &e.ID, &e.Details.FolderID)...); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// EstimateEntries returns the planner's estimate of the entries matching q,
+// which unlike COUNT(*) does not scan them
+func (r *EntryRepository) EstimateEntries(ctx context.Context, q LinkQuery) (int64, error) {
+	conditions, args := linkQueryConditions(q)
+	// EXPLAIN takes no bind parameters, so they are interpolated client-side
+	var plan []struct {
+		Plan struct {
+			Rows float64 `json:"Plan Rows"`
+		} `json:"Plan"`
+	}
+	err := r.db.QueryRow(ctx, "EXPLAIN (FORMAT JSON) SELECT 1 FROM entries WHERE TRUE"+conditions,
+		append([]any{pgx.QueryExecModeSimpleProtocol}, args...)...).Scan(&plan)
+	if err != nil {
+		return 0, err
+	}
+	if len(plan) == 0 {
+		return 0, nil
+	}
+	return int64(plan[0].Plan.Rows), nil
+}
+
+// ExportEntries calls fn for every entry matching filter, oldest first,
+// streaming rows instead of loading them all
+func (r *EntryRepository) ExportEntries(ctx context.Context, filter ExportFilter, fn func(Entry) error) error {
+	conditions, args := filterConditions(filter, nil)
+	query := "SELECT " + entryRecordColumns + " FROM entries WHERE TRUE" +
+		conditions + " ORDER BY created_at, short_code"
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e Entry
+		if err := rows.Scan(e.recordFields()...); err != nil {
+			return err
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// importQueries insert an imported entry per conflict mode. Each returns
+// whether a new row was inserted, or no row when an existing one was kept.
+var importQueries = map[string]string{
+	ConflictSkip: `INSERT INTO entries (short_code, original_url, owner, clicks, created_at, metadata, url_hash,
+			utm_source, utm_medium, utm_campaign, title, description, notes)
+		VALUES ($1, $2, $3, $4, $5, $6, sha256(convert_to($2, 'UTF8')), $7, $8, $9, $10, $11, $12)
+		ON CONFLICT (short_code) DO NOTHING RETURNING TRUE`,
+	ConflictFail: `INSERT INTO entries (short_code, original_url, owner, clicks, created_at, metadata, url_hash,
+			utm_source, utm_medium, utm_campaign, title, description, notes)
+		VALUES ($1, $2, $3, $4, $5, $6, sha256(convert_to($2, 'UTF8')), $7, $8, $9, $10, $11, $12)
+		ON CONFLICT (short_code) DO NOTHING RETURNING TRUE`,
+	// Overwritten links become plain links to the imported URL, losing their
+	// split destinations, deep link and routing rules. Their folder is kept.
+	ConflictOverwrite: `WITH cleared AS (DELETE FROM entry_destinations WHERE short_code = $1),
+			unruled AS (DELETE FROM entry_rules WHERE short_code = $1)
+		INSERT INTO entries (short_code, original_url, owner, clicks, created_at, metadata, url_hash,
+			utm_source, utm_medium, utm_campaign, title, description, notes)
+		VALUES ($1, $2, $3, $4, $5, $6, sha256(convert_to($2, 'UTF8')), $7, $8, $9, $10, $11, $12)
+		ON CONFLICT (short_code) DO UPDATE SET original_url = EXCLUDED.original_url, owner = EXCLUDED.owner,
+			clicks = EXCLUDED.clicks, created_at = EXCLUDED.created_at, metadata = EXCLUDED.metadata,
+			url_hash = EXCLUDED.url_hash, utm_source = EXCLUDED.utm_source, utm_medium = EXCLUDED.utm_medium,
+			utm_campaign = EXCLUDED.utm_campaign, sticky = '', ios_url = '', android_url = '',
+			expires_at = NULL, expiry_notified = FALSE,
+			title = EXCLUDED.title, description = EXCLUDED.description, notes = EXCLUDED.notes
+		RETURNING xmax = 0`,
+}
+
+// ImportBatch writes entries in one transaction and reports the outcome of
+// each. With ConflictFail the batch is cut at the first existing short code:
+// the entries before it are committed and the rest are left unprocessed.
+func (r *EntryRepository) ImportBatch(ctx context.Context, entries []Entry, onConflict string) ([]importOutcome, error) {
+	query, ok := importQueries[onConflict]
+	if !ok {
+		return nil, fmt.Errorf("unknown conflict mode %q", onConflict)
+	}
+
+	tx, err := r.db.Pool().Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	batch := &pgx.Batch{}
+	for _, e := range entries {
+		metadata := e.Metadata
+		if metadata == nil {
+			metadata = map[string]any{}
+		}
+		args := append([]any{e.ShortCode, e.OriginalURL, e.Owner, e.Clicks, e.CreatedAt, metadata},
+			campaignArgs(e.OriginalURL)...)
+		batch.Queue(query, append(args, e.Details.Title, e.Details.Description, e.Details.Notes)...)
+	}
+
+	results := tx.SendBatch(ctx, batch)
+	outcomes := make([]importOutcome, len(entries))
+	conflict := -1
+	for i := range entries {
+		var inserted bool
+		err := results.QueryRow().Scan(&inserted)
+		switch {
+		case err == pgx.ErrNoRows && onConflict == ConflictFail:
+			outcomes[i] = outcomeConflict
+			if conflict < 0 {
+				conflict = i
+			}
+		case err == pgx.ErrNoRows:
+			outcomes[i] = outcomeSkipped
+		case err != nil:
+			results.Close()
+			return nil, err
+		case inserted:
+			outcomes[i] = outcomeCreated
+		default:
+			outcomes[i] = outcomeOverwritten
+		}
+	}
+	if err := results.Close(); err != nil {
+		return nil, err
+	}
+
+	if conflict >= 0 {
+		// Roll back and replay only the entries before the conflict
+		if err := tx.Rollback(ctx); err != nil {
+			return nil, err
+		}
+		prefix, err := r.ImportBatch(ctx, entries[:conflict], onConflict)
+		if err != nil {
+			return nil, err
+		}
+		outcomes = make([]importOutcome, len(entries))
+		copy(outcomes, prefix)
+		if !slices.Contains(prefix, outcomeConflict) {
+			// A concurrent insert may have moved the conflict earlier
+			outcomes[conflict] = outcomeConflict
+		}
+		return outcomes, nil
+	}
+
+	// Imported tags replace those of overwritten entries
+	tags := &pgx.Batch{}
+	for i, e := range entries {
+		if outcomes[i] == outcomeOverwritten {
+			tags.Queue("DELETE FROM entry_tags WHERE short_code = $1", e.ShortCode)
+		}
+		if (outcomes[i] == outcomeCreated || outcomes[i] == outcomeOverwritten) && len(e.Details.Tags) > 0 {
+			tags.Queue(insertTagsQuery, e.ShortCode, e.Details.Tags)
+		}
+	}
+	if tags.Len() > 0 {
+		if err := tx.SendBatch(ctx, tags).Close(); err != nil {
+			return nil, err
+		}
+	}
+	return outcomes, tx.Commit(ctx)
+}
+
+// FindOrCreate returns the oldest entry of owner pointing at originalURL, or
+// inserts one under shortCode when there is none. Concurrent calls for the
+// same owner and URL are serialized by an advisory lock, so they agree on a
+// single entry. created reports whether shortCode was inserted, along with
+// details.
+func (r *EntryRepository) FindOrCreate(ctx context.Context, shortCode, originalURL, owner string, createdAt time.Time, details LinkDetails) (string, bool, error) {
+	tx, err := r.db.Pool().Begin(ctx)
+	if err != nil {
+		return "", false, err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx,
+		"SELECT pg_advisory_xact_lock(hashtextextended($1 || E'\\n' || $2, 0))", owner, originalURL); err != nil {
+		return "", false, err
+	}
+
+	var existing string
+	err = tx.QueryRow(ctx,
+		`SELECT short_code FROM entries WHERE owner = $1 AND url_hash = sha256(convert_to($2, 'UTF8'))
+		AND original_url = $2 ORDER BY created_at, id LIMIT 1`,
+		owner, originalURL).Scan(&existing)
+	if err == nil {
+		return existing, false, tx.Commit(ctx)
+	}
+	if err != pgx.ErrNoRows {
+		return "", false, err
+	}
+
+	tag, err := tx.Exec(ctx,
+		`INSERT INTO entries (short_code, original_url, owner, clicks, created_at, url_hash, utm_source, utm_medium, utm_campaign,
+			title, description, notes, folder_id)
+		VALUES ($1, $2, $3, 0, $4, sha256(convert_to($2, 'UTF8')), $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (short_code) DO NOTHING`,
+		append(append([]any{shortCode, originalURL, owner, createdAt}, campaignArgs(originalURL)...),
+			details.Title, details.Description, details.Notes, details.FolderID)...)
+	if err != nil {
+		return "", false, err
+	}
+	if tag.RowsAffected() == 0 {
+		return "", false, errAliasTaken
+	}
+	if err := insertTags(ctx, tx, shortCode, details.Tags); err != nil {
+		return "", false, err
+	}
+	return shortCode, true, tx.Commit(ctx)
+}
+
+// OwnerSettings are the per-owner defaults applied when creating links
+type OwnerSettings struct {
+	Owner string `json:"owner"`
+	// Dedupe returns the existing code when the owner shortens a URL again
+	Dedupe bool `json:"dedupe"`
+}
+
+// GetOwnerSettings returns the settings of owner, or the defaults if none
+// were saved
+func (r *EntryRepository) GetOwnerSettings(ctx context.Context, owner string) (OwnerSettings, error) {
+	settings := OwnerSettings{Owner: owner}
+	err := r.db.QueryRow(ctx, "SELECT dedupe FROM owner_settings WHERE owner = $1", owner).
+		Scan(&settings.Dedupe)
+	if err != nil && err != pgx.ErrNoRows {
+		return settings, err
+	}
+	return settings, nil
+}
+
+// SaveOwnerSettings creates or replaces the settings of an owner
+func (r *EntryRepository) SaveOwnerSettings(ctx context.Context, settings OwnerSettings) error {
+	_, err := r.db.Exec(ctx,
+		`INSERT INTO owner_settings (owner, dedupe, updated_at) VALUES ($1, $2, NOW())
+		ON CONFLICT (owner) DO UPDATE SET dedupe = EXCLUDED.dedupe, updated_at = EXCLUDED.updated_at`,
+		settings.Owner, settings.Dedupe)
+	return err
+}
+
+// campaignBackfillBatch is the number of entries updated per backfill round
+const campaignBackfillBatch = 1000
+
+// BackfillCampaigns fills the campaign columns of entries that predate them
+// and returns how many were updated
+func (r *EntryRepository) BackfillCampaigns(ctx context.Context) (int, error) {
+	updated := 0
+	for {
+		rows, err := r.db.Query(ctx,
+			"SELECT short_code, original_url FROM entries WHERE utm_campaign IS NULL LIMIT $1", campaignBackfillBatch)
+		if err != nil {
+			return updated, err
+		}
+		type pending struct{ Code, URL string }
+		todo, err := pgx.CollectRows(rows, pgx.RowToStructByPos[pending])
+		if err != nil {
+			return updated, err
+		}
+		if len(todo) == 0 {
+			return updated, nil
+		}
+
+		batch := &pgx.Batch{}
+		for _, p := range todo {
+			batch.Queue("UPDATE entries SET utm_source = $2, utm_medium = $3, utm_campaign = $4 WHERE short_code = $1",
+				append([]any{p.Code}, campaignArgs(p.URL)...)...)
+		}
+		if err := r.db.Pool().SendBatch(ctx, batch).Close(); err != nil {
+			return updated, err
+		}
+		updated += len(todo)
+	}
+}
+
+// GetUTMPreset returns a preset of owner, or nil if it does not exist
+func (r *EntryRepository) GetUTMPreset(ctx context.Context, owner, name string) (*UTMPreset, error) {
+	preset := UTMPreset{Owner: owner, Name: name}
+	err := r.db.QueryRow(ctx,
+		`SELECT utm_source, utm_medium, utm_campaign, utm_term, utm_content FROM utm_presets
+		WHERE owner = $1 AND name = $2`, owner, name).
+		Scan(&preset.Source, &preset.Medium, &preset.Campaign, &preset.Term, &preset.Content)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &preset, nil
+}
+
+// ListUTMPresets returns every preset of owner ordered by name
+func (r *EntryRepository) ListUTMPresets(ctx context.Context, owner string) ([]UTMPreset, error) {
+	rows, err := r.db.Query(ctx,
+		`SELECT name, utm_source, utm_medium, utm_campaign, utm_term, utm_content FROM utm_presets
+		WHERE owner = $1 ORDER BY name`, owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	presets := []UTMPreset{}
+	for rows.Next() {
+		preset := UTMPreset{Owner: owner}
+		if err := rows.Scan(&preset.Name, &preset.Source, &preset.Medium, &preset.Campaign, &preset.Term, &preset.Content); err != nil {
+			return nil, err
+		}
+		presets = append(presets, preset)
+	}
+	return presets, rows.Err()
+}
+
+// SaveUTMPreset creates or replaces a preset
+func (r *EntryRepository) SaveUTMPreset(ctx context.Context, preset UTMPreset) error {
+	_, err := r.db.Exec(ctx,
+		`INSERT INTO utm_presets (owner, name, utm_source, utm_medium, utm_campaign, utm_term, utm_content, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW())
+		ON CONFLICT (owner, name) DO UPDATE SET utm_source = EXCLUDED.utm_source, utm_medium = EXCLUDED.utm_medium,
+			utm_campaign = EXCLUDED.utm_campaign, utm_term = EXCLUDED.utm_term, utm_content = EXCLUDED.utm_content,
+			updated_at = EXCLUDED.updated_at`,
+		preset.Owner, preset.Name, preset.Source, preset.Medium, preset.Campaign, preset.Term, preset.Content)
+	return err
+}
+
+// DeleteUTMPreset removes a preset and reports whether it existed
+func (r *EntryRepository) DeleteUTMPreset(ctx context.Context, owner, name string) (bool, error) {
+	tag, err := r.db.Exec(ctx, "DELETE FROM utm_presets WHERE owner = $1 AND name = $2", owner, name)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// GetCampaignStats counts links and clicks per utm_campaign, optionally for
+// a single owner
+func (r *EntryRepository) GetCampaignStats(ctx context.Context, owner string, limit int) ([]CampaignStats, error) {
+	rows, err := r.db.Query(ctx,
+		`SELECT utm_campaign, COUNT(*), COALESCE(SUM(clicks), 0) FROM entries
+		WHERE utm_campaign <> '' AND ($1 = '' OR owner = $1)
+		GROUP BY utm_campaign ORDER BY 3 DESC, 1 LIMIT $2`, owner, limit)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToStructByPos[CampaignStats])
+}
+
+// GetCampaignLinks lists the links of a campaign, most clicked first
+func (r *EntryRepository) GetCampaignLinks(ctx context.Context, owner, campaign string, limit int) ([]CampaignLink, error) {
+	rows, err := r.db.Query(ctx,
+		`SELECT short_code, original_url, utm_source, utm_medium, clicks FROM entries
+		WHERE utm_campaign = $1 AND ($2 = '' OR owner = $2)
+		ORDER BY clicks DESC, short_code LIMIT $3`, campaign, owner, limit)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToStructByPos[CampaignLink])
+}
+
+// GetOwners returns the owner of each existing short code
+func (r *EntryRepository) GetOwners(ctx context.Context, shortCodes []string) (map[string]string, error) {
+	rows, err := r.db.Query(ctx, "SELECT short_code, owner FROM entries WHERE short_code = ANY($1)", shortCodes)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	owners := make(map[string]string, len(shortCodes))
+	for rows.Next() {
+		var code, owner string
+		if err := rows.Scan(&code, &owner); err != nil {
+			return nil, err
+		}
+		owners[code] = owner
+	}
+	return owners, rows.Err()
+}
+
+// CreateWebhook inserts an endpoint and sets its ID and creation time
+func (r *EntryRepository) CreateWebhook(ctx context.Context, endpoint *WebhookEndpoint) error {
+	return r.db.QueryRow(ctx,
+		`INSERT INTO webhook_endpoints (owner, url, secret, events) VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at`,
+		endpoint.Owner, endpoint.URL, endpoint.Secret, endpoint.Events).Scan(&endpoint.ID, &endpoint.CreatedAt)
+}
+
+// ListWebhooks returns the endpoints of owner without their secrets
+func (r *EntryRepository) ListWebhooks(ctx context.Context, owner string) ([]WebhookEndpoint, error) {
+	rows, err := r.db.Query(ctx,
+		`SELECT id, owner, url, events, '', created_at FROM webhook_endpoints
+		WHERE owner = $1 ORDER BY id`, owner)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToStructByPos[WebhookEndpoint])
+}
+
+// DeleteWebhook removes an endpoint and its deliveries
+func (r *EntryRepository) DeleteWebhook(ctx context.Context, id int64) (bool, error) {
+	tag, err := r.db.Exec(ctx, "DELETE FROM webhook_endpoints WHERE id = $1", id)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// enqueueWebhookQuery queues the payload $3 of event $1 for every endpoint of
+// owner $2 subscribed to it
+const enqueueWebhookQuery = `INSERT INTO webhook_deliveries (endpoint_id, event, payload)
+	SELECT id, $1, $3 FROM webhook_endpoints WHERE $1 = ANY (events) AND owner = $2`
+
+// EnqueueWebhookEvent queues payload for every endpoint of owner subscribed
+// to event, and returns how many were queued
+func (r *EntryRepository) EnqueueWebhookEvent(ctx context.Context, event, owner string, payload []byte) (int64, error) {
+	tag, err := r.db.Exec(ctx, enqueueWebhookQuery, event, owner, payload)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// ExpireEntries marks up to limit entries that expired without being
+// notified and, in the same transaction, queues the payload built by event
+// for every endpoint of their owner subscribed to link.expired. It returns
+// the entries and how many deliveries were queued.
+func (r *EntryRepository) ExpireEntries(ctx context.Context, limit int, event func(Entry) ([]byte, error)) ([]Entry, int64, error) {
+	tx, err := r.db.Pool().Begin(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx,
+		`WITH due AS (
+			SELECT id FROM entries WHERE expires_at <= NOW() AND NOT expiry_notified
+			ORDER BY expires_at LIMIT $1 FOR UPDATE SKIP LOCKED
+		)
+		UPDATE entries e SET expiry_notified = TRUE FROM due WHERE e.id = due.id
+		RETURNING e.short_code, e.original_url, e.owner, e.created_at, e.expires_at`, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	entries, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (Entry, error) {
+		var e Entry
+		err := row.Scan(&e.ShortCode, &e.OriginalURL, &e.Owner, &e.CreatedAt, &e.ExpiresAt)
+		return e, err
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var queued int64
+	for _, e := range entries {
+		if e.Owner == "" {
+			continue
+		}
+		payload, err := event(e)
+		if err != nil {
+			return nil, 0, err
+		}
+		tag, err := tx.Exec(ctx, enqueueWebhookQuery, EventLinkExpired, e.Owner, payload)
+		if err != nil {
+			return nil, 0, err
+		}
+		queued += tag.RowsAffected()
+	}
+	return entries, queued, tx.Commit(ctx)
+}
+
+// ClaimWebhookDelivery leases the next due delivery for lease, so no other
+// worker picks it up meanwhile, or returns nil when none is due. The lease
+// expiry is returned as the job's claim and must be passed back when the
+// outcome is recorded.
+func (r *EntryRepository) ClaimWebhookDelivery(ctx context.Context, lease time.Duration) (*webhookJob, error) {
+	rows, err := r.db.Query(ctx,
+		`WITH due AS (
+			SELECT id FROM webhook_deliveries WHERE status = 'pending' AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at LIMIT 1 FOR UPDATE SKIP LOCKED
+		)
+		UPDATE webhook_deliveries d SET next_attempt_at = NOW() + make_interval(secs => $1)
+		FROM due, webhook_endpoints e
+		WHERE d.id = due.id AND e.id = d.endpoint_id
+		RETURNING d.id, d.event, d.payload, d.attempts, e.url, e.secret, d.next_attempt_at`,
+		lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	job, err := pgx.CollectOneRow(rows, pgx.RowToStructByPos[webhookJob])
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// CompleteWebhookDelivery records a successful attempt. It returns
+// errLeaseLost when the claim no longer holds.
+func (r *EntryRepository) CompleteWebhookDelivery(ctx context.Context, job webhookJob, statusCode int) error {
+	tag, err := r.db.Exec(ctx,
+		`UPDATE webhook_deliveries SET status = 'delivered', attempts = attempts + 1, last_status_code = $3,
+			last_error = '', delivered_at = NOW()
+		WHERE id = $1 AND status = 'pending' AND next_attempt_at = $2`, job.ID, job.Claim, statusCode)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return errLeaseLost
+	}
+	return nil
+}
+
+// FailWebhookDelivery records a failed attempt, scheduling the next one after
+// retryIn or dead-lettering the delivery once maxAttempts is reached. It
+// reports whether the delivery is dead, and returns errLeaseLost when the
+// claim no longer holds.
+func (r *EntryRepository) FailWebhookDelivery(ctx context.Context, job webhookJob, statusCode int, message string, maxAttempts int, retryIn time.Duration) (bool, error) {
+	var status string
+	err := r.db.QueryRow(ctx,
+		`UPDATE webhook_deliveries SET attempts = attempts + 1, last_status_code = NULLIF($3, 0), last_error = $4,
+			status = CASE WHEN attempts + 1 >= $5 THEN 'dead' ELSE 'pending' END,
+			next_attempt_at = NOW() + make_interval(secs => $6)
+		WHERE id = $1 AND status = 'pending' AND next_attempt_at = $2 RETURNING status`,
+		job.ID, job.Claim, statusCode, message, maxAttempts, retryIn.Seconds()).Scan(&status)
+	if err == pgx.ErrNoRows {
+		return false, errLeaseLost
+	}
+	return status == deliveryDead, err
+}
+
+// ListWebhookDeliveries returns the deliveries of an endpoint, newest first
+func (r *EntryRepository) ListWebhookDeliveries(ctx context.Context, endpointID int64, status string, limit int) ([]WebhookDelivery, error) {
+	rows, err := r.db.Query(ctx,
+		`SELECT id, event, status, attempts, COALESCE(last_status_code, 0), last_error,
+			CASE WHEN status = 'pending' THEN next_attempt_at END, created_at, delivered_at, payload
+		FROM webhook_deliveries WHERE endpoint_id = $1 AND ($2 = '' OR status = $2)
+		ORDER BY id DESC LIMIT $3`, endpointID, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToStructByPos[WebhookDelivery])
+}
+
+// RetryWebhookDelivery makes a delivery due now with a fresh attempt budget
+func (r *EntryRepository) RetryWebhookDelivery(ctx context.Context, endpointID, deliveryID int64) (bool, error) {
+	tag, err := r.db.Exec(ctx,
+		`UPDATE webhook_deliveries SET status = 'pending', attempts = 0, next_attempt_at = NOW()
+		WHERE id = $1 AND endpoint_id = $2`, deliveryID, endpointID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// PruneWebhookDeliveries removes deliveries completed before cutoff
+func (r *EntryRepository) PruneWebhookDeliveries(ctx context.Context, cutoff time.Time) (int64, error) {
+	tag, err := r.db.Exec(ctx,
+		"DELETE FROM webhook_deliveries WHERE status = 'delivered' AND delivered_at < $1", cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// insertTagsQuery tags an entry with every tag of $2 it does not have yet
+const insertTagsQuery = `INSERT INTO entry_tags (short_code, tag) SELECT $1, unnest($2::text[])
+	ON CONFLICT DO NOTHING`
+
+// tagsColumn selects the tags of an entry of the outer query, sorted
+const tagsColumn = `ARRAY(SELECT tag FROM entry_tags t WHERE t.short_code = entries.short_code ORDER BY tag)`
+
+// GetDetails returns the details of an entry, or nil if it does not exist
+func (r *EntryRepository) GetDetails(ctx context.Context, shortCode string) (*LinkDetails, error) {
+	var d LinkDetails
+	err := r.db.QueryRow(ctx,
+		`SELECT title, description, notes, folder_id, `+tagsColumn+` FROM entries WHERE short_code = $1`,
+		shortCode).Scan(&d.Title, &d.Description, &d.Notes, &d.FolderID, &d.Tags)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// UpdateDetails changes the text details set in update and reports whether
+// the entry exists
+func (r *EntryRepository) UpdateDetails(ctx context.Context, shortCode string, update DetailsUpdate) (bool, error) {
+	tag, err := r.db.Exec(ctx,
+		`UPDATE entries SET title = COALESCE($2, title), description = COALESCE($3, description),
+			notes = COALESCE($4, notes)
+		WHERE short_code = $1`, shortCode, update.Title, update.Description, update.Notes)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// AddTags tags an entry and returns all of its tags. Nothing is stored when
+// the entry would end up with more than max tags.
+func (r *EntryRepository) AddTags(ctx context.Context, shortCode string, tags []string, max int) ([]string, bool, error) {
+	tx, err := r.db.Pool().Begin(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Locking the entry serializes concurrent changes of its tags
+	var all []string
+	err = tx.QueryRow(ctx, "SELECT short_code FROM entries WHERE short_code = $1 FOR UPDATE", shortCode).Scan(new(string))
+	if err == pgx.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if _, err := tx.Exec(ctx, insertTagsQuery, shortCode, tags); err != nil {
+		return nil, false, err
+	}
+	err = tx.QueryRow(ctx, "SELECT "+tagsColumn+" FROM entries WHERE short_code = $1", shortCode).Scan(&all)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(all) > max {
+		return all, true, nil
+	}
+	return all, true, tx.Commit(ctx)
+}
+
+// RemoveTag untags an entry and returns its remaining tags
+func (r *EntryRepository) RemoveTag(ctx context.Context, shortCode, tag string) ([]string, bool, error) {
+	var tags []string
+	err := r.db.QueryRow(ctx,
+		`WITH removed AS (DELETE FROM entry_tags WHERE short_code = $1 AND tag = $2 RETURNING tag)
+		SELECT ARRAY(SELECT t.tag FROM entry_tags t WHERE t.short_code = $1 AND t.tag NOT IN (SELECT tag FROM removed)
+			ORDER BY t.tag)
+		FROM entries WHERE short_code = $1`, shortCode, tag).Scan(&tags)
+	if err == pgx.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return tags, true, nil
+}
+
+// CreateFolder inserts a folder and fills in its ID and creation time. It
+// reports false when the parent already has a folder of that name.
+func (r *EntryRepository) CreateFolder(ctx context.Context, folder *Folder) (bool, error) {
+	err := r.db.QueryRow(ctx,
+		`INSERT INTO folders (owner, name, parent_id) VALUES ($1, $2, $3)
+		ON CONFLICT (owner, parent_id, name) DO NOTHING RETURNING id, created_at`,
+		folder.Owner, folder.Name, folder.ParentID).Scan(&folder.ID, &folder.CreatedAt)
+	if err == pgx.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// GetFolder returns a folder, or nil if it does not exist
+func (r *EntryRepository) GetFolder(ctx context.Context, id int64) (*Folder, error) {
+	var f Folder
+	err := r.db.QueryRow(ctx, "SELECT id, owner, name, parent_id, created_at FROM folders WHERE id = $1", id).
+		Scan(&f.ID, &f.Owner, &f.Name, &f.ParentID, &f.CreatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// FolderDepth returns how many folders lead to id, counting id itself
+func (r *EntryRepository) FolderDepth(ctx context.Context, id int64) (int, error) {
+	var depth int
+	err := r.db.QueryRow(ctx,
+		`WITH RECURSIVE ancestors AS (
+			SELECT id, parent_id FROM folders WHERE id = $1
+			UNION ALL
+			SELECT f.id, f.parent_id FROM folders f JOIN ancestors a ON f.id = a.parent_id
+		)
+		SELECT COUNT(*) FROM ancestors`, id).Scan(&depth)
+	return depth, err
+}
+
+// ListFolders returns the folders of owner, or all folders when owner is
+// empty. Parents are created first, so ordering by ID lists them before their
+// children.
+func (r *EntryRepository) ListFolders(ctx context.Context, owner string) ([]Folder, error) {
+	rows, err := r.db.Query(ctx,
+		`SELECT id, owner, name, parent_id, created_at FROM folders WHERE $1 = '' OR owner = $1 ORDER BY id`, owner)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToStructByPos[Folder])
+}
+
+// DeleteFolder deletes a folder; its subfolders go with it and their entries
+// lose their folder
+func (r *EntryRepository) DeleteFolder(ctx context.Context, id int64) (bool, error) {
+	tag, err := r.db.Exec(ctx, "DELETE FROM folders WHERE id = $1", id)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// MoveEntries moves entries into folderID, or out of their folders when it
+// is nil, and returns the moved entries. Entries of another owner than the
+// folder are left alone.
+func (r *EntryRepository) MoveEntries(ctx context.Context, shortCodes []string, folderID *int64) ([]Entry, error) {
+	rows, err := r.db.Query(ctx,
+		`UPDATE entries SET folder_id = $2
+		WHERE short_code = ANY($1) AND ($2::bigint IS NULL OR owner = (SELECT owner FROM folders WHERE id = $2))
+		RETURNING short_code, original_url, owner, created_at`, shortCodes, folderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []Entry
+	for rows.Next() {
+		var e Entry
+		if err := rows.Scan(&e.ShortCode, &e.OriginalURL, &e.Owner, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// GetTagStats counts the entries and clicks of each tag, most clicked first
+func (r *EntryRepository) GetTagStats(ctx context.Context, owner string, limit int) ([]TagStats, error) {
+	rows, err := r.db.Query(ctx,
+		`SELECT t.tag, COUNT(*), COALESCE(SUM(e.clicks), 0) FROM entry_tags t
+		JOIN entries e ON e.short_code = t.short_code
+		WHERE $1 = '' OR e.owner = $1
+		GROUP BY t.tag ORDER BY 3 DESC, 1 LIMIT $2`, owner, limit)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToStructByPos[TagStats])
+}
+
+// GetFolderStats counts the entries and clicks of each folder of owner,
+// including those of its subfolders
+func (r *EntryRepository) GetFolderStats(ctx context.Context, owner string) ([]FolderStats, error) {
+	rows, err := r.db.Query(ctx,
+		`WITH RECURSIVE subtree AS (
+			SELECT id AS root, id FROM folders WHERE $1 = '' OR owner = $1
+			UNION ALL
+			SELECT s.root, f.id FROM folders f JOIN subtree s ON f.parent_id = s.id
+		)
+		SELECT f.id, f.name, f.parent_id, COUNT(e.id), COALESCE(SUM(e.clicks), 0)
+		FROM folders f
+		JOIN subtree s ON s.root = f.id
+		LEFT JOIN entries e ON e.folder_id = s.id
+		GROUP BY f.id ORDER BY f.id`, owner)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToStructByPos[FolderStats])
+}
@@ -24,8 +24,31 @@ func NewRouter(controller *Controller) *Router {
 // Init initializes all routes
 func (r *Router) Init() *http.ServeMux {
 	mux := http.NewServeMux()
+	mux.HandleFunc("GET /stats/campaigns", r.controller.CampaignStatsHandler)
+	mux.HandleFunc("GET /stats/tags", r.controller.TagStatsHandler)
+	mux.HandleFunc("GET /stats/folders", r.controller.FolderStatsHandler)
 	mux.HandleFunc("GET /stats/{id}", r.controller.StatsHandler)
+	mux.HandleFunc("GET /stats/{id}/devices", r.controller.DeviceStatsHandler)
+	mux.HandleFunc("GET /stats/{id}/referrers", r.controller.ReferrerStatsHandler)
+	mux.HandleFunc("GET /stats/{id}/timeseries", r.controller.TimeSeriesHandler)
+	mux.HandleFunc("GET /owners/{owner}/settings", r.controller.GetOwnerSettingsHandler)
+	mux.HandleFunc("PUT /owners/{owner}/settings", r.controller.PutOwnerSettingsHandler)
+	mux.HandleFunc("GET /owners/{owner}/utm-presets", r.controller.ListUTMPresetsHandler)
+	mux.HandleFunc("PUT /owners/{owner}/utm-presets/{name}", r.controller.PutUTMPresetHandler)
+	mux.HandleFunc("DELETE /owners/{owner}/utm-presets/{name}", r.controller.DeleteUTMPresetHandler)
+	mux.HandleFunc("POST /folders", r.controller.CreateFolderHandler)
+	mux.HandleFunc("GET /folders", r.controller.ListFoldersHandler)
+	mux.HandleFunc("DELETE /folders/{id}", r.controller.DeleteFolderHandler)
+	mux.HandleFunc("POST /webhooks", r.controller.CreateWebhookHandler)
+	mux.HandleFunc("GET /webhooks", r.controller.ListWebhooksHandler)
+	mux.HandleFunc("DELETE /webhooks/{id}", r.controller.DeleteWebhookHandler)
+	mux.HandleFunc("GET /webhooks/{id}/deliveries", r.controller.WebhookDeliveriesHandler)
+	mux.HandleFunc("POST /webhooks/{id}/deliveries/{delivery}/retry", r.controller.RetryWebhookDeliveryHandler)
 	mux.HandleFunc("GET /status", r.controller.StatusHandler)
+	mux.HandleFunc("GET /openapi.json", r.controller.OpenAPIHandler)
+	mux.HandleFunc("GET /.well-known/apple-app-site-association", r.controller.AppleAppSiteAssociationHandler)
+	mux.HandleFunc("GET /apple-app-site-association", r.controller.AppleAppSiteAssociationHandler)
+	mux.HandleFunc("GET /.well-known/assetlinks.json", r.controller.AssetLinksHandler)
 	return mux
 }
 
@@ -42,6 +65,20 @@ func NewLinkRouter(controller *Controller) *LinkRouter {
 func (r *LinkRouter) Init() *http.ServeMux {
 	mux := http.NewServeMux()
 	mux.HandleFunc("POST /create", r.controller.CreateHandler)
+	mux.HandleFunc("POST /bulk", r.controller.BulkCreateHandler)
+	mux.HandleFunc("GET /export", r.controller.ExportHandler)
+	mux.HandleFunc("POST /import", r.controller.ImportHandler)
+	mux.HandleFunc("POST /move", r.controller.MoveLinksHandler)
+	mux.HandleFunc("GET /{code}/details", r.controller.GetDetailsHandler)
+	mux.HandleFunc("PATCH /{code}", r.controller.UpdateDetailsHandler)
+	mux.HandleFunc("DELETE /{code}", r.controller.DeleteLinkHandler)
+	mux.HandleFunc("POST /{code}/tags", r.controller.AddTagsHandler)
+	mux.HandleFunc("DELETE /{code}/tags/{tag}", r.controller.RemoveTagHandler)
+	mux.HandleFunc("GET /{code}/qr", r.controller.QRHandler)
+	mux.HandleFunc("GET /{code}/rules", r.controller.GetRulesHandler)
+	mux.HandleFunc("PUT /{code}/rules", r.controller.PutRulesHandler)
+	mux.HandleFunc("POST /{code}/rules/dry-run", r.controller.DryRunRulesHandler)
+	mux.HandleFunc("POST /{code}/rules/{rule}/dry-run", r.controller.DryRunRulesHandler)
 	mux.HandleFunc("GET /{path}", r.controller.GetHandler)
 	return mux
 }
@@ -0,0 +1,570 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mahopon/SmolEarl/useragent"
+)
+
+// ErrInvalidRule is wrapped by every routing rule validation failure
+var ErrInvalidRule = newError(CodeInvalidInput, "invalid rule")
+
+const (
+	// maxRules bounds the routing rules of one link
+	maxRules = 50
+	// ruleCacheTTL is how long compiled rules are reused before they are
+	// reloaded, so changes made through other instances are picked up
+	ruleCacheTTL = 30 * time.Second
+	// maxCachedRuleSets bounds the number of links whose rules are cached
+	maxCachedRuleSets = 10000
+)
+
+// ruleDays maps the weekday names accepted in rules
+var ruleDays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// ruleDevices lists the device classes rules may match
+var ruleDevices = []string{useragent.DeviceDesktop, useragent.DeviceMobile, useragent.DeviceTablet, useragent.DeviceBot}
+
+// Rule sends visitors matching every condition of Match to Destination
+type Rule struct {
+	Name        string    `json:"name,omitempty"`
+	Destination string    `json:"destination" openapi:"required"`
+	Match       RuleMatch `json:"match" openapi:"required"`
+}
+
+// RuleMatch lists the conditions of a rule. A rule matches when every
+// condition set matches, and a condition matches when any of its values does.
+type RuleMatch struct {
+	// Countries are ISO 3166-1 alpha-2 codes
+	Countries []string `json:"countries,omitempty"`
+	// Devices are device classes: desktop, mobile, tablet or bot
+	Devices []string `json:"devices,omitempty"`
+	// OS are operating system families, such as iOS or Android
+	OS []string `json:"os,omitempty"`
+	// Languages match the visitor's preferred language; "en" matches any
+	// English variant and "en-GB" only British English
+	Languages []string `json:"languages,omitempty"`
+	// Days are weekdays: mon, tue, wed, thu, fri, sat or sun
+	Days []string `json:"days,omitempty"`
+	// Time is a window of the day, which wraps around midnight when From is
+	// after To
+	Time *TimeWindow `json:"time,omitempty"`
+	// Timezone applies to Days and Time, UTC by default
+	Timezone string `json:"timezone,omitempty"`
+	// Query maps parameter names to their required value, or "*" for any
+	Query map[string]string `json:"query,omitempty"`
+}
+
+// TimeWindow is a range of the day as HH:MM, From inclusive and To exclusive
+type TimeWindow struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// RuleResult reports whether one rule matched a dry run request, and the
+// conditions that did not
+type RuleResult struct {
+	Index      int      `json:"index"`
+	Name       string   `json:"name,omitempty"`
+	Matched    bool     `json:"matched"`
+	Mismatches []string `json:"mismatches,omitempty"`
+}
+
+// DryRunRequest is a synthetic visit to test routing rules with. The
+// country is looked up from IP when not given, and Rules are tested instead
+// of the saved ones when set.
+type DryRunRequest struct {
+	Rules          []Rule            `json:"rules,omitempty"`
+	Country        string            `json:"country,omitempty"`
+	IP             string            `json:"ip,omitempty"`
+	UserAgent      string            `json:"user_agent,omitempty"`
+	AcceptLanguage string            `json:"accept_language,omitempty"`
+	Time           *time.Time        `json:"time,omitempty"`
+	Query          map[string]string `json:"query,omitempty"`
+}
+
+// DryRunResult reports how a link would resolve a DryRunRequest
+type DryRunResult struct {
+	Request     ruleRequest  `json:"request"`
+	Rules       []RuleResult `json:"rules"`
+	Matched     *int         `json:"matched"`
+	Destination string       `json:"destination"`
+}
+
+// ruleRequest is what routing rules are matched against
+type ruleRequest struct {
+	Country  string     `json:"country"`
+	Device   string     `json:"device"`
+	OS       string     `json:"os"`
+	Language string     `json:"language"`
+	At       time.Time  `json:"time"`
+	Query    url.Values `json:"query"`
+}
+
+// compiledRule is a validated Rule prepared for matching
+type compiledRule struct {
+	Rule
+	countries map[string]bool
+	devices   map[string]bool
+	os        map[string]bool
+	languages []string
+	days      map[time.Weekday]bool
+	location  *time.Location
+	from, to  int
+	windowed  bool
+}
+
+// label names a rule in responses and logs
+func (r *compiledRule) label(index int) string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return strconv.Itoa(index)
+}
+
+// compileRule validates rule and prepares it for matching. The destination
+// must already be normalized.
+func compileRule(rule Rule) (compiledRule, error) {
+	m := rule.Match
+	c := compiledRule{Rule: rule, location: time.UTC}
+	if rule.Destination == "" {
+		return c, fmt.Errorf("%w: destination is required", ErrInvalidRule)
+	}
+	if len(m.Countries) == 0 && len(m.Devices) == 0 && len(m.OS) == 0 && len(m.Languages) == 0 &&
+		len(m.Days) == 0 && m.Time == nil && len(m.Query) == 0 {
+		return c, fmt.Errorf("%w: at least one condition is required", ErrInvalidRule)
+	}
+
+	if len(m.Countries) > 0 {
+		c.countries = make(map[string]bool)
+		for _, country := range m.Countries {
+			if len(country) != 2 || !isLetters(country) {
+				return c, fmt.Errorf("%w: country %q must be a two letter code", ErrInvalidRule, country)
+			}
+			c.countries[strings.ToUpper(country)] = true
+		}
+	}
+	if len(m.Devices) > 0 {
+		c.devices = make(map[string]bool)
+		for _, device := range m.Devices {
+			device = strings.ToLower(device)
+			if !slices.Contains(ruleDevices, device) {
+				return c, fmt.Errorf("%w: device must be one of %s", ErrInvalidRule, strings.Join(ruleDevices, ", "))
+			}
+			c.devices[device] = true
+		}
+	}
+	if len(m.OS) > 0 {
+		c.os = make(map[string]bool)
+		for _, os := range m.OS {
+			if strings.TrimSpace(os) == "" {
+				return c, fmt.Errorf("%w: os must not be empty", ErrInvalidRule)
+			}
+			c.os[strings.ToLower(strings.TrimSpace(os))] = true
+		}
+	}
+	for _, lang := range m.Languages {
+		primary, region, _ := strings.Cut(lang, "-")
+		if len(primary) < 2 || len(primary) > 3 || !isLetters(primary) || (region != "" && !isAlphanumeric(region)) {
+			return c, fmt.Errorf("%w: language %q is not a language tag", ErrInvalidRule, lang)
+		}
+		c.languages = append(c.languages, strings.ToLower(lang))
+	}
+	if len(m.Days) > 0 {
+		c.days = make(map[time.Weekday]bool)
+		for _, day := range m.Days {
+			weekday, ok := ruleDays[strings.ToLower(day)]
+			if !ok {
+				return c, fmt.Errorf("%w: day %q must be one of mon, tue, wed, thu, fri, sat or sun", ErrInvalidRule, day)
+			}
+			c.days[weekday] = true
+		}
+	}
+	if m.Time != nil {
+		var err error
+		if c.from, err = parseClock(m.Time.From); err != nil {
+			return c, err
+		}
+		if c.to, err = parseClock(m.Time.To); err != nil {
+			return c, err
+		}
+		if c.from == c.to {
+			return c, fmt.Errorf("%w: time window is empty", ErrInvalidRule)
+		}
+		c.windowed = true
+	}
+	if m.Timezone != "" {
+		loc, err := time.LoadLocation(m.Timezone)
+		if err != nil {
+			return c, fmt.Errorf("%w: unknown timezone %q", ErrInvalidRule, m.Timezone)
+		}
+		c.location = loc
+	}
+	for name := range m.Query {
+		if name == "" {
+			return c, fmt.Errorf("%w: query parameter names must not be empty", ErrInvalidRule)
+		}
+	}
+	return c, nil
+}
+
+// parseClock parses HH:MM into minutes since midnight
+func parseClock(clock string) (int, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, fmt.Errorf("%w: time %q must be HH:MM", ErrInvalidRule, clock)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// isLetters reports whether s only contains ASCII letters
+func isLetters(s string) bool {
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// isAlphanumeric reports whether s is non-empty and only contains ASCII
+// letters and digits
+func isAlphanumeric(s string) bool {
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// mismatches returns the conditions of the rule that req does not meet; the
+// rule matches when there are none
+func (c *compiledRule) mismatches(req ruleRequest) []string {
+	var failed []string
+	if c.countries != nil && !c.countries[req.Country] {
+		failed = append(failed, "countries")
+	}
+	if c.devices != nil && !c.devices[req.Device] {
+		failed = append(failed, "devices")
+	}
+	if c.os != nil && !c.os[strings.ToLower(req.OS)] {
+		failed = append(failed, "os")
+	}
+	if len(c.languages) > 0 && !c.matchesLanguage(req.Language) {
+		failed = append(failed, "languages")
+	}
+
+	local := req.At.In(c.location)
+	if c.days != nil && !c.days[local.Weekday()] {
+		failed = append(failed, "days")
+	}
+	if c.windowed {
+		minute := local.Hour()*60 + local.Minute()
+		inside := minute >= c.from && minute < c.to
+		if c.from > c.to {
+			inside = minute >= c.from || minute < c.to
+		}
+		if !inside {
+			failed = append(failed, "time")
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(c.Match.Query)) {
+		want := c.Match.Query[name]
+		values, ok := req.Query[name]
+		if !ok || (want != "*" && !slices.Contains(values, want)) {
+			failed = append(failed, "query."+name)
+		}
+	}
+	return failed
+}
+
+// matchesLanguage reports whether a language tag matches one of the rule's
+func (c *compiledRule) matchesLanguage(tag string) bool {
+	tag = strings.ToLower(tag)
+	for _, want := range c.languages {
+		if tag == want || strings.HasPrefix(tag, want+"-") {
+			return true
+		}
+	}
+	return false
+}
+
+// preferredLanguage returns the most preferred language of an
+// Accept-Language header, ignoring the wildcard and refused languages
+func preferredLanguage(header string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.TrimSpace(tag)
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if q > bestQ {
+			best, bestQ = tag, q
+		}
+	}
+	return best
+}
+
+// firstMatch returns the index of the first rule req matches, or -1
+func firstMatch(rules []compiledRule, req ruleRequest) int {
+	for i := range rules {
+		if len(rules[i].mismatches(req)) == 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// ruleCache keeps the compiled rules of recently resolved links in memory
+type ruleCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]cachedRules
+}
+
+// cachedRules are the compiled rules of one link, possibly none
+type cachedRules struct {
+	rules   []compiledRule
+	expires time.Time
+}
+
+// newRuleCache creates a ruleCache keeping rules for ttl
+func newRuleCache(ttl time.Duration) *ruleCache {
+	return &ruleCache{ttl: ttl, entries: make(map[string]cachedRules)}
+}
+
+// get returns the cached rules of shortCode, if fresh
+func (c *ruleCache) get(shortCode string, now time.Time) ([]compiledRule, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cached, ok := c.entries[shortCode]
+	if !ok || now.After(cached.expires) {
+		return nil, false
+	}
+	return cached.rules, true
+}
+
+// put caches the rules of shortCode. The cache is emptied when full rather
+// than tracking recency, since entries are cheap to reload.
+func (c *ruleCache) put(shortCode string, rules []compiledRule, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= maxCachedRuleSets {
+		clear(c.entries)
+	}
+	c.entries[shortCode] = cachedRules{rules: rules, expires: now.Add(c.ttl)}
+}
+
+// forget drops the cached rules of shortCode
+func (c *ruleCache) forget(shortCode string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, shortCode)
+}
+
+// GetRules returns the routing rules of a link, in evaluation order
+func (s *Service) GetRules(ctx context.Context, shortCode string) ([]Rule, error) {
+	rules, found, err := s.repo.GetRules(ctx, shortCode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query PostgreSQL: %w", err)
+	}
+	if !found {
+		return nil, ErrEntryNotFound
+	}
+	return rules, nil
+}
+
+// SaveRules validates and replaces the routing rules of a link. Destinations
+// are normalized and screened like those of new links.
+func (s *Service) SaveRules(ctx context.Context, shortCode string, rules []Rule) ([]Rule, error) {
+	rules, _, err := s.compileRules(ctx, rules)
+	if err != nil {
+		return nil, err
+	}
+	found, err := s.repo.SaveRules(ctx, shortCode, rules)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store in PostgreSQL: %w", err)
+	}
+	if !found {
+		return nil, ErrEntryNotFound
+	}
+	s.rules.forget(shortCode)
+	slog.InfoContext(ctx, "Saved routing rules", "code", shortCode, "rules", len(rules))
+
+	if s.webhooks != nil {
+		if entry, err := s.repo.GetByShortCode(ctx, shortCode); err != nil {
+			slog.WarnContext(ctx, "Failed to load entry for webhook event", "code", shortCode, "error", err)
+		} else if entry != nil {
+			s.emitLinkEvent(ctx, EventLinkUpdated, *entry, "rules")
+		}
+	}
+	return rules, nil
+}
+
+// compileRules validates rules and returns them with normalized destinations,
+// along with their compiled form
+func (s *Service) compileRules(ctx context.Context, rules []Rule) ([]Rule, []compiledRule, error) {
+	if len(rules) > maxRules {
+		return nil, nil, fmt.Errorf("%w: at most %d rules are allowed", ErrInvalidRule, maxRules)
+	}
+	compiled := make([]compiledRule, len(rules))
+	for i, rule := range rules {
+		destination, err := s.prepareDestination(ctx, rule.Destination, UTM{})
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: rule %d: %w", ErrInvalidRule, i, err)
+		}
+		rules[i].Destination = destination
+		if compiled[i], err = compileRule(rules[i]); err != nil {
+			return nil, nil, fmt.Errorf("rule %d: %w", i, err)
+		}
+	}
+	return rules, compiled, nil
+}
+
+// routingRules returns the compiled rules of a link from the cache, loading
+// them from PostgreSQL when missing or stale
+func (s *Service) routingRules(ctx context.Context, shortCode string) ([]compiledRule, error) {
+	now := time.Now()
+	if rules, ok := s.rules.get(shortCode, now); ok {
+		return rules, nil
+	}
+	rules, _, err := s.repo.GetRules(ctx, shortCode)
+	if err != nil {
+		return nil, err
+	}
+	compiled := make([]compiledRule, 0, len(rules))
+	for i, rule := range rules {
+		c, err := compileRule(rule)
+		if err != nil {
+			// Rules are validated on write, so this only happens when the
+			// validation got stricter; the rule is skipped rather than
+			// breaking the link
+			slog.WarnContext(ctx, "Skipping invalid routing rule", "code", shortCode, "rule", i, "error", err)
+			continue
+		}
+		compiled = append(compiled, c)
+	}
+	s.rules.put(shortCode, compiled, now)
+	return compiled, nil
+}
+
+// newRuleRequest derives what rules match on from a visit
+func (s *Service) newRuleRequest(ctx context.Context, visit Visit) ruleRequest {
+	agent := s.agents.Parse(visit.UserAgent)
+	req := ruleRequest{
+		Device:   agent.Device,
+		OS:       agent.OS,
+		Language: preferredLanguage(visit.AcceptLanguage),
+		At:       visit.At,
+		Query:    visit.Query,
+	}
+	if s.geo != nil {
+		loc, err := s.geo.Lookup(visit.IP)
+		if err != nil {
+			slog.WarnContext(ctx, "GeoIP lookup failed", "ip", visit.IP, "error", err)
+		}
+		req.Country = loc.Country
+	}
+	return req
+}
+
+// DryRunRules evaluates the rules of a link against a synthetic request
+// without recording anything. With ruleID, the index or name of a rule, only
+// that rule is evaluated.
+func (s *Service) DryRunRules(ctx context.Context, shortCode, ruleID string, dry DryRunRequest) (DryRunResult, error) {
+	entry, err := s.repo.GetByShortCode(ctx, shortCode)
+	if err != nil {
+		return DryRunResult{}, fmt.Errorf("failed to query PostgreSQL: %w", err)
+	}
+	if entry == nil {
+		return DryRunResult{}, ErrEntryNotFound
+	}
+
+	rules := dry.Rules
+	if rules == nil {
+		if rules, _, err = s.repo.GetRules(ctx, shortCode); err != nil {
+			return DryRunResult{}, fmt.Errorf("failed to query PostgreSQL: %w", err)
+		}
+	}
+	rules, compiled, err := s.compileRules(ctx, slices.Clone(rules))
+	if err != nil {
+		return DryRunResult{}, err
+	}
+
+	indexes := make([]int, len(rules))
+	for i := range rules {
+		indexes[i] = i
+	}
+	if ruleID != "" {
+		i := slices.IndexFunc(rules, func(r Rule) bool { return r.Name == ruleID })
+		if n, err := strconv.Atoi(ruleID); err == nil && i < 0 {
+			i = n
+		}
+		if i < 0 || i >= len(rules) {
+			return DryRunResult{}, fmt.Errorf("%w: no rule %q", ErrEntryNotFound, ruleID)
+		}
+		indexes = []int{i}
+	}
+
+	visit := Visit{UserAgent: dry.UserAgent, AcceptLanguage: dry.AcceptLanguage, At: time.Now().UTC(), Query: url.Values{}}
+	if dry.Time != nil {
+		visit.At = *dry.Time
+	}
+	for name, value := range dry.Query {
+		visit.Query.Set(name, value)
+	}
+	if dry.IP != "" {
+		if visit.IP, err = netip.ParseAddr(dry.IP); err != nil {
+			return DryRunResult{}, fmt.Errorf("%w: invalid ip %q", ErrInvalidRule, dry.IP)
+		}
+	}
+	req := s.newRuleRequest(ctx, visit)
+	if dry.Country != "" {
+		req.Country = strings.ToUpper(dry.Country)
+	}
+
+	result := DryRunResult{Request: req, Rules: []RuleResult{}, Destination: entry.OriginalURL}
+	for _, i := range indexes {
+		mismatches := compiled[i].mismatches(req)
+		result.Rules = append(result.Rules, RuleResult{
+			Index:      i,
+			Name:       rules[i].Name,
+			Matched:    len(mismatches) == 0,
+			Mismatches: mismatches,
+		})
+		if len(mismatches) == 0 && result.Matched == nil {
+			result.Matched = &i
+			result.Destination = rules[i].Destination
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,306 @@
+package screening
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.yaml.in/yaml/v3"
+	"golang.org/x/net/idna"
+)
+
+// Lists a destination can be flagged by
+const (
+	ListDomain     = "domain"
+	ListPattern    = "pattern"
+	ListHashPrefix = "hash_prefix"
+)
+
+// Verdict explains why a destination was flagged
+type Verdict struct {
+	// List is the kind of entry that matched
+	List string
+	// Rule is the matching domain, pattern or hash prefix
+	Rule string
+}
+
+// blocklistFile mirrors the layout of the denylist file
+type blocklistFile struct {
+	Domains  []string `yaml:"domains"`
+	Patterns []string `yaml:"patterns"`
+}
+
+// lists is an immutable snapshot of the loaded lists
+type lists struct {
+	domains  map[string]bool
+	patterns []*regexp.Regexp
+	// prefixes holds hex encoded hash prefixes keyed by their length in bytes
+	prefixes map[int]map[string]bool
+}
+
+// source is a watched list file
+type source struct {
+	path    string
+	modTime time.Time
+	size    int64
+}
+
+// changed reports whether the file differs from when it was last loaded
+func (s *source) changed() (bool, error) {
+	if s.path == "" {
+		return false, nil
+	}
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return false, err
+	}
+	return !info.ModTime().Equal(s.modTime) || info.Size() != s.size, nil
+}
+
+// read returns the file's content and remembers its version
+func (s *source) read() ([]byte, error) {
+	if s.path == "" {
+		return nil, nil
+	}
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+	s.modTime, s.size = info.ModTime(), info.Size()
+	return data, nil
+}
+
+// Screener checks destinations against a domain and pattern denylist and a
+// list of SHA-256 hash prefixes of URL expressions in the style of Safe
+// Browsing. Both files are reloaded when they change.
+type Screener struct {
+	blocklist  source
+	hashPrefix source
+	lists      atomic.Pointer[lists]
+}
+
+// New loads the denylist at blocklistPath and the hash prefixes at
+// hashPrefixPath. Either path may be empty.
+func New(blocklistPath, hashPrefixPath string) (*Screener, error) {
+	s := &Screener{
+		blocklist:  source{path: blocklistPath},
+		hashPrefix: source{path: hashPrefixPath},
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load parses both files and swaps them in together
+func (s *Screener) load() error {
+	l := &lists{domains: make(map[string]bool), prefixes: make(map[int]map[string]bool)}
+
+	data, err := s.blocklist.read()
+	if err != nil {
+		return fmt.Errorf("failed to read blocklist: %w", err)
+	}
+	var file blocklistFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("failed to parse blocklist %s: %w", s.blocklist.path, err)
+	}
+	for _, domain := range file.Domains {
+		host, err := canonicalHost(domain)
+		if err != nil {
+			return fmt.Errorf("blocklist %s: domain %q: %w", s.blocklist.path, domain, err)
+		}
+		l.domains[host] = true
+	}
+	for _, pattern := range file.Patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("blocklist %s: pattern %q: %w", s.blocklist.path, pattern, err)
+		}
+		l.patterns = append(l.patterns, re)
+	}
+
+	data, err = s.hashPrefix.read()
+	if err != nil {
+		return fmt.Errorf("failed to read hash prefixes: %w", err)
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		prefix := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if prefix == "" || strings.HasPrefix(prefix, "#") {
+			continue
+		}
+		raw, err := hex.DecodeString(prefix)
+		if err != nil || len(raw) < 4 || len(raw) > sha256.Size {
+			return fmt.Errorf("hash prefixes %s:%d: must be 4 to 32 hex encoded bytes", s.hashPrefix.path, line)
+		}
+		if l.prefixes[len(raw)] == nil {
+			l.prefixes[len(raw)] = make(map[string]bool)
+		}
+		l.prefixes[len(raw)][prefix] = true
+	}
+
+	s.lists.Store(l)
+	slog.Info("Loaded URL screening lists",
+		"domains", len(l.domains), "patterns", len(l.patterns), "hash_prefix_lengths", len(l.prefixes))
+	return nil
+}
+
+// Reload reloads the lists if either file changed. The previous lists stay
+// active when the new ones are invalid.
+func (s *Screener) Reload() error {
+	blocklistChanged, err := s.blocklist.changed()
+	if err != nil {
+		return fmt.Errorf("failed to stat blocklist: %w", err)
+	}
+	hashPrefixChanged, err := s.hashPrefix.changed()
+	if err != nil {
+		return fmt.Errorf("failed to stat hash prefixes: %w", err)
+	}
+	if !blocklistChanged && !hashPrefixChanged {
+		return nil
+	}
+	return s.load()
+}
+
+// Run checks the files for changes every interval until ctx is cancelled
+func (s *Screener) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Reload(); err != nil {
+				slog.ErrorContext(ctx, "Failed to reload URL screening lists", "error", err)
+			}
+		}
+	}
+}
+
+// Check reports whether rawURL is flagged by any list
+func (s *Screener) Check(rawURL string) (Verdict, bool) {
+	l := s.lists.Load()
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return Verdict{}, false
+	}
+	host, err := canonicalHost(u.Hostname())
+	if err != nil {
+		return Verdict{}, false
+	}
+
+	for _, candidate := range hostSuffixes(host, len(host)) {
+		if l.domains[candidate] {
+			return Verdict{List: ListDomain, Rule: candidate}, true
+		}
+	}
+	for _, re := range l.patterns {
+		if re.MatchString(rawURL) {
+			return Verdict{List: ListPattern, Rule: re.String()}, true
+		}
+	}
+	if len(l.prefixes) > 0 {
+		for _, expression := range expressions(host, u) {
+			sum := sha256.Sum256([]byte(expression))
+			for length, prefixes := range l.prefixes {
+				if prefix := hex.EncodeToString(sum[:length]); prefixes[prefix] {
+					return Verdict{List: ListHashPrefix, Rule: prefix}, true
+				}
+			}
+		}
+	}
+	return Verdict{}, false
+}
+
+// canonicalHost lowercases a host and converts it to punycode
+func canonicalHost(host string) (string, error) {
+	host = strings.TrimSuffix(strings.TrimSpace(host), ".")
+	if ip := net.ParseIP(strings.Trim(host, "[]")); ip != nil {
+		return ip.String(), nil
+	}
+	ascii, err := idna.Lookup.ToASCII(host)
+	if err != nil {
+		return "", err
+	}
+	return strings.ToLower(ascii), nil
+}
+
+// hostSuffixes returns host followed by its parent domains, stopping before
+// the top-level domain, at most limit entries in total
+func hostSuffixes(host string, limit int) []string {
+	if net.ParseIP(host) != nil {
+		return []string{host}
+	}
+	suffixes := []string{host}
+	labels := strings.Split(host, ".")
+	for i := 1; i < len(labels)-1 && len(suffixes) < limit; i++ {
+		suffixes = append(suffixes, strings.Join(labels[i:], "."))
+	}
+	return suffixes
+}
+
+// expressions returns the host suffix and path prefix combinations Safe
+// Browsing hashes for a URL, e.g. "b.c/1/" for http://a.b.c/1/2.html
+func expressions(host string, u *url.URL) []string {
+	// Safe Browsing looks up the exact host and at most four suffixes built
+	// from its last five labels
+	hosts := []string{host}
+	if net.ParseIP(host) == nil {
+		labels := strings.Split(host, ".")
+		if len(labels) > 5 {
+			labels = labels[len(labels)-5:]
+		}
+		for _, suffix := range hostSuffixes(strings.Join(labels, "."), 5) {
+			if suffix != host {
+				hosts = append(hosts, suffix)
+			}
+		}
+	}
+
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	var paths []string
+	if u.RawQuery != "" {
+		paths = append(paths, path+"?"+u.RawQuery)
+	}
+	paths = append(paths, path)
+	prefix := "/"
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i := 0; i < len(segments) && len(paths) < 6; i++ {
+		if prefix != path {
+			paths = append(paths, prefix)
+		}
+		prefix += segments[i] + "/"
+	}
+
+	var out []string
+	seen := make(map[string]bool)
+	for _, h := range hosts {
+		for _, p := range paths {
+			if expression := h + p; !seen[expression] {
+				seen[expression] = true
+				out = append(out, expression)
+			}
+		}
+	}
+	return out
+}
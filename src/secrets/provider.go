@@ -0,0 +1,82 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNotFound is returned when a provider has no value for a secret
+var ErrNotFound = errors.New("secret not found")
+
+// Provider resolves secrets such as database passwords by name. Names are the
+// environment variable names of the settings they replace, e.g.
+// POSTGRES_PASSWORD.
+type Provider interface {
+	// Name identifies the provider in logs and config output
+	Name() string
+	// GetSecret returns the current value of the named secret or ErrNotFound
+	GetSecret(ctx context.Context, name string) (string, error)
+}
+
+// Rotator is implemented by providers whose secrets can change at runtime
+type Rotator interface {
+	// OnRotate registers fn to be called with the new value whenever the
+	// named secret changes
+	OnRotate(name string, fn func(ctx context.Context, value string))
+	// Run keeps secrets fresh until ctx is cancelled
+	Run(ctx context.Context)
+}
+
+// EnvProvider reads secrets from environment variables
+type EnvProvider struct{}
+
+// Name implements Provider
+func (EnvProvider) Name() string {
+	return "env"
+}
+
+// GetSecret implements Provider
+func (EnvProvider) GetSecret(_ context.Context, name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok || value == "" {
+		return "", fmt.Errorf("%s: %w", name, ErrNotFound)
+	}
+	return value, nil
+}
+
+// FileProvider reads secrets from one file per secret inside a directory, the
+// layout Kubernetes uses when mounting a Secret as a volume
+type FileProvider struct {
+	dir string
+}
+
+// NewFileProvider creates a FileProvider rooted at dir
+func NewFileProvider(dir string) *FileProvider {
+	return &FileProvider{dir: dir}
+}
+
+// Name implements Provider
+func (p *FileProvider) Name() string {
+	return "file"
+}
+
+// GetSecret implements Provider. Trailing newlines are trimmed since most
+// tooling writes them.
+func (p *FileProvider) GetSecret(_ context.Context, name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return "", fmt.Errorf("invalid secret name %q", name)
+	}
+
+	data, err := os.ReadFile(filepath.Join(p.dir, name))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("%s: %w", name, ErrNotFound)
+		}
+		return "", fmt.Errorf("failed to read secret %s: %w", name, err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
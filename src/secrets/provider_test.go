@@ -0,0 +1,40 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEnvProvider(t *testing.T) {
+	t.Setenv("SMOLEARL_TEST_SECRET", "from-env")
+
+	if got, err := (EnvProvider{}).GetSecret(context.Background(), "SMOLEARL_TEST_SECRET"); err != nil || got != "from-env" {
+		t.Errorf("GetSecret = %q, %v; want from-env", got, err)
+	}
+	if _, err := (EnvProvider{}).GetSecret(context.Background(), "SMOLEARL_TEST_UNSET"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetSecret of an unset variable error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestFileProvider(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "POSTGRES_PASSWORD"), []byte("pg-secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	p := NewFileProvider(dir)
+
+	if got, err := p.GetSecret(context.Background(), "POSTGRES_PASSWORD"); err != nil || got != "pg-secret" {
+		t.Errorf("GetSecret = %q, %v; want pg-secret without the trailing newline", got, err)
+	}
+	if _, err := p.GetSecret(context.Background(), "REDIS_PASSWORD"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetSecret of a missing file error = %v, want ErrNotFound", err)
+	}
+	for _, name := range []string{"", ".", "..", "../etc/passwd", `a\b`} {
+		if _, err := p.GetSecret(context.Background(), name); err == nil || errors.Is(err, ErrNotFound) {
+			t.Errorf("GetSecret(%q) error = %v, want an invalid name error", name, err)
+		}
+	}
+}
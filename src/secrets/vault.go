@@ -0,0 +1,351 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// VaultConfig configures access to a HashiCorp Vault KV v2 secret
+type VaultConfig struct {
+	// Address is the base URL of the Vault server, e.g. https://vault:8200
+	Address string
+	// Token authenticates directly when set
+	Token string
+	// RoleID and SecretID authenticate through AppRole when Token is empty
+	RoleID   string
+	SecretID string
+	// AuthMount is the AppRole mount path, "approle" by default
+	AuthMount string
+	// Mount is the KV v2 engine mount path, "secret" by default
+	Mount string
+	// Path is the secret path inside the mount
+	Path string
+	// PollInterval controls how often the secret is re-read to detect rotation
+	PollInterval time.Duration
+	// HTTPClient is used for every request, a client giving up after
+	// defaultVaultTimeout by default
+	HTTPClient *http.Client
+}
+
+// VaultProvider reads secrets from a single KV v2 secret. The token is renewed
+// before its lease expires and the secret is polled so that rotations reach
+// registered callbacks.
+type VaultProvider struct {
+	cfg    VaultConfig
+	client *http.Client
+
+	mu        sync.RWMutex
+	token     string
+	tokenTTL  time.Duration
+	renewable bool
+	data      map[string]string
+	version   int
+	callbacks map[string][]func(ctx context.Context, value string)
+}
+
+// vaultResponse covers the parts of Vault's response envelope that we use
+type vaultResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Auth   *vaultAuth      `json:"auth"`
+	Errors []string        `json:"errors"`
+}
+
+type vaultAuth struct {
+	ClientToken   string `json:"client_token"`
+	LeaseDuration int    `json:"lease_duration"`
+	Renewable     bool   `json:"renewable"`
+}
+
+type kvData struct {
+	Data     map[string]any `json:"data"`
+	Metadata struct {
+		Version int `json:"version"`
+	} `json:"metadata"`
+}
+
+type tokenLookup struct {
+	TTL       int  `json:"ttl"`
+	Renewable bool `json:"renewable"`
+}
+
+// minRenewDelay keeps short-lived tokens from spinning the renew loop
+const minRenewDelay = 5 * time.Second
+
+// defaultVaultTimeout bounds each request, so an unreachable Vault fails
+// startup instead of hanging it
+const defaultVaultTimeout = 10 * time.Second
+
+// NewVaultProvider authenticates against Vault and reads the secret once so
+// that configuration errors surface at startup
+func NewVaultProvider(ctx context.Context, cfg VaultConfig) (*VaultProvider, error) {
+	if cfg.Address == "" {
+		return nil, errors.New("vault address is required")
+	}
+	if cfg.Path == "" {
+		return nil, errors.New("vault secret path is required")
+	}
+	if cfg.Token == "" && (cfg.RoleID == "" || cfg.SecretID == "") {
+		return nil, errors.New("vault requires a token or an AppRole role_id and secret_id")
+	}
+	if cfg.AuthMount == "" {
+		cfg.AuthMount = "approle"
+	}
+	if cfg.Mount == "" {
+		cfg.Mount = "secret"
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Minute
+	}
+
+	v := &VaultProvider{
+		cfg:       cfg,
+		client:    cfg.HTTPClient,
+		callbacks: make(map[string][]func(ctx context.Context, value string)),
+	}
+	if v.client == nil {
+		v.client = &http.Client{Timeout: defaultVaultTimeout}
+	}
+
+	if err := v.login(ctx); err != nil {
+		return nil, err
+	}
+	if _, err := v.refresh(ctx); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Name implements Provider
+func (v *VaultProvider) Name() string {
+	return "vault"
+}
+
+// GetSecret implements Provider using the most recently read secret version
+func (v *VaultProvider) GetSecret(_ context.Context, name string) (string, error) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	value, ok := v.data[name]
+	if !ok {
+		return "", fmt.Errorf("%s: %w", name, ErrNotFound)
+	}
+	return value, nil
+}
+
+// OnRotate implements Rotator
+func (v *VaultProvider) OnRotate(name string, fn func(ctx context.Context, value string)) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.callbacks[name] = append(v.callbacks[name], fn)
+}
+
+// Run implements Rotator. It renews the token ahead of expiry, logging in
+// again when renewal is impossible, and polls the secret for new versions.
+func (v *VaultProvider) Run(ctx context.Context) {
+	poll := time.NewTicker(v.cfg.PollInterval)
+	defer poll.Stop()
+
+	renew := time.NewTimer(v.renewDelay())
+	defer renew.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-renew.C:
+			if err := v.renewToken(ctx); err != nil {
+				slog.WarnContext(ctx, "Vault token renewal failed, logging in again", "error", err)
+				if err := v.login(ctx); err != nil {
+					slog.ErrorContext(ctx, "Vault login failed", "error", err)
+				}
+			}
+			renew.Reset(v.renewDelay())
+		case <-poll.C:
+			changed, err := v.refresh(ctx)
+			if err != nil {
+				slog.ErrorContext(ctx, "Failed to refresh Vault secret", "path", v.cfg.Path, "error", err)
+				continue
+			}
+			v.notify(ctx, changed)
+		}
+	}
+}
+
+// renewDelay schedules renewal at two thirds of the token TTL
+func (v *VaultProvider) renewDelay() time.Duration {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	if v.tokenTTL <= 0 {
+		// Non-expiring tokens only need an occasional sanity check
+		return time.Hour
+	}
+	return max(v.tokenTTL*2/3, minRenewDelay)
+}
+
+// login obtains a token through AppRole, or validates a static token
+func (v *VaultProvider) login(ctx context.Context) error {
+	if v.cfg.Token != "" {
+		var lookup tokenLookup
+		resp, err := v.do(ctx, http.MethodGet, "auth/token/lookup-self", v.cfg.Token, nil)
+		if err != nil {
+			return fmt.Errorf("vault token lookup failed: %w", err)
+		}
+		if err := json.Unmarshal(resp.Data, &lookup); err != nil {
+			return fmt.Errorf("invalid vault token lookup response: %w", err)
+		}
+		v.setToken(v.cfg.Token, lookup.TTL, lookup.Renewable)
+		return nil
+	}
+
+	body := map[string]string{"role_id": v.cfg.RoleID, "secret_id": v.cfg.SecretID}
+	resp, err := v.do(ctx, http.MethodPost, "auth/"+v.cfg.AuthMount+"/login", "", body)
+	if err != nil {
+		return fmt.Errorf("vault approle login failed: %w", err)
+	}
+	if resp.Auth == nil || resp.Auth.ClientToken == "" {
+		return errors.New("vault approle login returned no token")
+	}
+	v.setToken(resp.Auth.ClientToken, resp.Auth.LeaseDuration, resp.Auth.Renewable)
+	return nil
+}
+
+// renewToken extends the current token lease
+func (v *VaultProvider) renewToken(ctx context.Context) error {
+	v.mu.RLock()
+	token, renewable := v.token, v.renewable
+	v.mu.RUnlock()
+
+	if !renewable {
+		return errors.New("token is not renewable")
+	}
+	resp, err := v.do(ctx, http.MethodPost, "auth/token/renew-self", token, map[string]string{})
+	if err != nil {
+		return err
+	}
+	if resp.Auth == nil {
+		return errors.New("vault renewal returned no auth data")
+	}
+	v.setToken(token, resp.Auth.LeaseDuration, resp.Auth.Renewable)
+	return nil
+}
+
+func (v *VaultProvider) setToken(token string, ttlSeconds int, renewable bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.token = token
+	v.tokenTTL = time.Duration(ttlSeconds) * time.Second
+	v.renewable = renewable
+}
+
+// refresh reads the latest secret version and returns the keys whose values
+// changed since the previous read
+func (v *VaultProvider) refresh(ctx context.Context) (map[string]string, error) {
+	v.mu.RLock()
+	token := v.token
+	v.mu.RUnlock()
+
+	resp, err := v.do(ctx, http.MethodGet, v.cfg.Mount+"/data/"+strings.TrimPrefix(v.cfg.Path, "/"), token, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vault secret %s: %w", v.cfg.Path, err)
+	}
+
+	var kv kvData
+	if err := json.Unmarshal(resp.Data, &kv); err != nil {
+		return nil, fmt.Errorf("invalid vault secret %s: %w", v.cfg.Path, err)
+	}
+
+	data := make(map[string]string, len(kv.Data))
+	for key, value := range kv.Data {
+		if s, ok := value.(string); ok {
+			data[key] = s
+		} else {
+			data[key] = fmt.Sprint(value)
+		}
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	changed := map[string]string{}
+	if v.data != nil && kv.Metadata.Version != v.version {
+		for key, value := range data {
+			if old, ok := v.data[key]; !ok || old != value {
+				changed[key] = value
+			}
+		}
+	}
+	v.data = data
+	v.version = kv.Metadata.Version
+	return changed, nil
+}
+
+// notify runs the rotation callbacks for every changed secret
+func (v *VaultProvider) notify(ctx context.Context, changed map[string]string) {
+	for name, value := range changed {
+		v.mu.RLock()
+		callbacks := v.callbacks[name]
+		v.mu.RUnlock()
+
+		slog.InfoContext(ctx, "Vault secret rotated", "name", name, "callbacks", len(callbacks))
+		for _, fn := range callbacks {
+			fn(ctx, value)
+		}
+	}
+}
+
+// do sends a request to the Vault HTTP API and decodes the response envelope
+func (v *VaultProvider) do(ctx context.Context, method, path, token string, body any) (*vaultResponse, error) {
+	endpoint, err := url.JoinPath(v.cfg.Address, "v1", path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid vault address: %w", err)
+	}
+
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := v.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var out vaultResponse
+	if err := json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(&out); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("invalid vault response (status %d): %w", res.StatusCode, err)
+	}
+	if res.StatusCode >= 300 {
+		if len(out.Errors) > 0 {
+			return nil, fmt.Errorf("vault returned status %d: %s", res.StatusCode, strings.Join(out.Errors, "; "))
+		}
+		return nil, fmt.Errorf("vault returned status %d", res.StatusCode)
+	}
+	return &out, nil
+}
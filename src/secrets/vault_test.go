@@ -0,0 +1,235 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeVault stands in for the parts of the Vault HTTP API the provider uses:
+// AppRole login, token lookup and renewal, and one KV v2 secret at
+// secret/smolearl
+type fakeVault struct {
+	mu       sync.Mutex
+	token    string
+	roleID   string
+	secretID string
+	ttl      int
+	data     map[string]any
+	version  int
+	renewals int
+}
+
+func newFakeVault(t *testing.T) (*fakeVault, *httptest.Server) {
+	t.Helper()
+	f := &fakeVault{
+		token:    "s.client",
+		roleID:   "role",
+		secretID: "secret",
+		ttl:      3600,
+		data:     map[string]any{"POSTGRES_PASSWORD": "pg-secret", "REDIS_PASSWORD": "redis-secret"},
+		version:  1,
+	}
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+	return f, server
+}
+
+// rotate stores a new version of the secret with key set to value
+func (f *fakeVault) rotate(key, value string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data := make(map[string]any, len(f.data))
+	for k, v := range f.data {
+		data[k] = v
+	}
+	data[key] = value
+	f.data = data
+	f.version++
+}
+
+func (f *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	reply := func(status int, body any) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(body)
+	}
+	auth := map[string]any{"client_token": f.token, "lease_duration": f.ttl, "renewable": true}
+
+	if r.Method == http.MethodPost && r.URL.Path == "/v1/auth/approle/login" {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["role_id"] != f.roleID || body["secret_id"] != f.secretID {
+			reply(http.StatusBadRequest, map[string]any{"errors": []string{"invalid role or secret ID"}})
+			return
+		}
+		reply(http.StatusOK, map[string]any{"auth": auth})
+		return
+	}
+	if r.Header.Get("X-Vault-Token") != f.token {
+		reply(http.StatusForbidden, map[string]any{"errors": []string{"permission denied"}})
+		return
+	}
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/v1/auth/token/lookup-self":
+		reply(http.StatusOK, map[string]any{"data": map[string]any{"ttl": f.ttl, "renewable": true}})
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/auth/token/renew-self":
+		f.renewals++
+		reply(http.StatusOK, map[string]any{"auth": auth})
+	case r.Method == http.MethodGet && r.URL.Path == "/v1/secret/data/smolearl":
+		reply(http.StatusOK, map[string]any{"data": map[string]any{
+			"data":     f.data,
+			"metadata": map[string]any{"version": f.version},
+		}})
+	default:
+		reply(http.StatusNotFound, map[string]any{"errors": []string{}})
+	}
+}
+
+func TestVaultProviderReadsSecretWithToken(t *testing.T) {
+	_, server := newFakeVault(t)
+
+	v, err := NewVaultProvider(context.Background(), VaultConfig{Address: server.URL, Token: "s.client", Path: "smolearl"})
+	if err != nil {
+		t.Fatalf("NewVaultProvider: %v", err)
+	}
+	if got, err := v.GetSecret(context.Background(), "POSTGRES_PASSWORD"); err != nil || got != "pg-secret" {
+		t.Errorf("GetSecret(POSTGRES_PASSWORD) = %q, %v; want pg-secret", got, err)
+	}
+	if _, err := v.GetSecret(context.Background(), "MISSING"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetSecret(MISSING) error = %v, want ErrNotFound", err)
+	}
+	if v.client.Timeout != defaultVaultTimeout {
+		t.Errorf("default client timeout = %v, want %v", v.client.Timeout, defaultVaultTimeout)
+	}
+}
+
+func TestVaultProviderLogsInWithAppRole(t *testing.T) {
+	_, server := newFakeVault(t)
+
+	v, err := NewVaultProvider(context.Background(), VaultConfig{
+		Address: server.URL, RoleID: "role", SecretID: "secret", Path: "/smolearl",
+	})
+	if err != nil {
+		t.Fatalf("NewVaultProvider: %v", err)
+	}
+	if got, _ := v.GetSecret(context.Background(), "REDIS_PASSWORD"); got != "redis-secret" {
+		t.Errorf("GetSecret(REDIS_PASSWORD) = %q, want redis-secret", got)
+	}
+	// Renewal is scheduled at two thirds of the 1h lease
+	if got := v.renewDelay(); got != 40*time.Minute {
+		t.Errorf("renewDelay() = %v, want 40m", got)
+	}
+}
+
+func TestVaultProviderReportsVaultErrors(t *testing.T) {
+	_, server := newFakeVault(t)
+
+	tests := []struct {
+		name string
+		cfg  VaultConfig
+		want string
+	}{
+		{"bad token", VaultConfig{Address: server.URL, Token: "s.wrong", Path: "smolearl"}, "permission denied"},
+		{"bad approle", VaultConfig{Address: server.URL, RoleID: "role", SecretID: "wrong", Path: "smolearl"},
+			"invalid role or secret ID"},
+		{"unknown path", VaultConfig{Address: server.URL, Token: "s.client", Path: "other"}, "status 404"},
+		{"no address", VaultConfig{Token: "s.client", Path: "smolearl"}, "address is required"},
+		{"no path", VaultConfig{Address: server.URL, Token: "s.client"}, "path is required"},
+		{"no credentials", VaultConfig{Address: server.URL, Path: "smolearl"}, "requires a token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewVaultProvider(context.Background(), tt.cfg)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("NewVaultProvider error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVaultProviderNotifiesRotations(t *testing.T) {
+	f, server := newFakeVault(t)
+
+	v, err := NewVaultProvider(context.Background(), VaultConfig{
+		Address: server.URL, Token: "s.client", Path: "smolearl", PollInterval: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("NewVaultProvider: %v", err)
+	}
+	rotated := make(chan string, 1)
+	v.OnRotate("POSTGRES_PASSWORD", func(_ context.Context, value string) { rotated <- value })
+	unchanged := make(chan string, 1)
+	v.OnRotate("REDIS_PASSWORD", func(_ context.Context, value string) { unchanged <- value })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go v.Run(ctx)
+
+	f.rotate("POSTGRES_PASSWORD", "pg-rotated")
+	select {
+	case got := <-rotated:
+		if got != "pg-rotated" {
+			t.Errorf("rotation callback got %q, want pg-rotated", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("rotation callback was not called")
+	}
+	if got, _ := v.GetSecret(ctx, "POSTGRES_PASSWORD"); got != "pg-rotated" {
+		t.Errorf("GetSecret after rotation = %q, want pg-rotated", got)
+	}
+	select {
+	case got := <-unchanged:
+		t.Errorf("callback of an unchanged secret was called with %q", got)
+	default:
+	}
+}
+
+func TestVaultProviderRenewsToken(t *testing.T) {
+	f, server := newFakeVault(t)
+	f.ttl = 1
+
+	v, err := NewVaultProvider(context.Background(), VaultConfig{Address: server.URL, Token: "s.client", Path: "smolearl"})
+	if err != nil {
+		t.Fatalf("NewVaultProvider: %v", err)
+	}
+	if err := v.renewToken(context.Background()); err != nil {
+		t.Fatalf("renewToken: %v", err)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.renewals != 1 {
+		t.Errorf("renewals = %d, want 1", f.renewals)
+	}
+	// Short leases are not renewed in a busy loop
+	if got := v.renewDelay(); got != minRenewDelay {
+		t.Errorf("renewDelay() = %v, want %v", got, minRenewDelay)
+	}
+}
+
+func TestVaultProviderGivesUpWithContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := NewVaultProvider(ctx, VaultConfig{Address: server.URL, Token: "s.client", Path: "smolearl"})
+	if err == nil {
+		t.Fatal("NewVaultProvider succeeded against a hanging server")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("NewVaultProvider took %v to give up", elapsed)
+	}
+}
@@ -3,22 +3,54 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"net/url"
+	"log/slog"
 	"time"
 
+	"github.com/mahopon/SmolEarl/infra/geoip"
+	infra_prom "github.com/mahopon/SmolEarl/infra/prometheus"
 	"github.com/mahopon/SmolEarl/infra/redis"
+	"github.com/mahopon/SmolEarl/screening"
+	"github.com/mahopon/SmolEarl/useragent"
 )
 
+// ErrEntryNotFound is returned for unknown short codes
+var ErrEntryNotFound = newError(CodeNotFound, "entry not found")
+
+// ErrClickStreamDisabled is returned when live clicks are not published
+var ErrClickStreamDisabled = newError(CodeUnavailable, "click stream is disabled")
+
 // Service handles business logic for the application
 type Service struct {
-	repo  *EntryRepository
-	redis *redis.Redis
+	repo     *EntryRepository
+	redis    *redis.Redis
+	geo      *geoip.Reader
+	agents   *useragent.Parser
+	visitors *visitorCounter
+	rules    *ruleCache
+	webhooks *webhookDispatcher
+	// clickStream publishes recorded clicks to live subscribers
+	clickStream *clickStream
+	cacheTTL    time.Duration
+
+	destinations     *DestinationValidator
+	screener         *screening.Screener
+	screeningMetrics *infra_prom.ScreeningMetrics
 }
 
+// defaultCacheTTL is how long entries stay in Redis unless configured otherwise
+const defaultCacheTTL = 24 * time.Hour
+
 // NewService creates a new Service instance
 func NewService() *Service {
-	return &Service{}
+	return &Service{
+		agents:   useragent.Default(),
+		rules:    newRuleCache(ruleCacheTTL),
+		cacheTTL: defaultCacheTTL,
+
+		destinations: defaultDestinationValidator(),
+	}
 }
 
 // SetRepository sets the repository for the service
@@ -31,132 +63,509 @@ func (s *Service) SetRedis(r *redis.Redis) {
 	s.redis = r
 }
 
-// Create creates a new entry with write-through to PostgreSQL
-func (s *Service) Create(data map[string]any, customAlias string) (string, error) {
-	incomingUrl := data["url"].(string)
-	if _, err := url.Parse(incomingUrl); err != nil {
-		return "", err
+// SetGeoIP sets the GeoIP database used to locate clicks
+func (s *Service) SetGeoIP(geo *geoip.Reader) {
+	s.geo = geo
+}
+
+// SetVisitorCounter enables unique visitor counting
+func (s *Service) SetVisitorCounter(visitors *visitorCounter) {
+	s.visitors = visitors
+}
+
+// SetCacheTTL sets how long entries are cached in Redis
+func (s *Service) SetCacheTTL(ttl time.Duration) {
+	s.cacheTTL = ttl
+}
+
+// SetDestinationValidator sets how destination URLs are validated
+func (s *Service) SetDestinationValidator(v *DestinationValidator) {
+	s.destinations = v
+}
+
+// SetScreener enables screening destinations against blocklists, counting
+// hits in metrics
+func (s *Service) SetScreener(screener *screening.Screener, metrics *infra_prom.ScreeningMetrics) {
+	s.screener = screener
+	s.screeningMetrics = metrics
+}
+
+// Create creates a new entry with write-through to PostgreSQL. When
+// deduplication applies and the owner already shortened the same URL, the
+// existing code is returned and existing is true. Split links list several
+// weighted destinations instead of a url, and deep links add app URLs to the
+// destination; neither is deduplicated. The title, notes, tags and folder of
+// the request are not applied to an existing entry, and links with an expiry
+// are never deduplicated. A custom alias that is already in use is reported
+// as errAliasTaken.
+func (s *Service) Create(ctx context.Context, req CreateRequest) (string, bool, error) {
+	variants, sticky, err := splitFromRequest(req.Destinations, req.Sticky)
+	if err != nil {
+		return "", false, err
+	}
+	if len(variants) > 0 && req.URL != "" {
+		return "", false, fmt.Errorf("%w: url and destinations cannot be combined", ErrInvalidSplit)
+	}
+	deepLink, err := deepLinkFromRequest(req.DeepLink, s.destinations.maxLength)
+	if err != nil {
+		return "", false, err
+	}
+	owner, customAlias := req.Owner, req.CustomAlias
+	if customAlias != "" {
+		if err := validateAlias(customAlias); err != nil {
+			return "", false, err
+		}
+	}
+	details, err := s.detailsFromRequest(ctx, req)
+	if err != nil {
+		return "", false, err
+	}
+	createdAt := time.Now().UTC()
+	expiresAt, err := expiryFromRequest(req.ExpiresAt, createdAt)
+	if err != nil {
+		return "", false, err
+	}
+
+	utm, err := s.campaignFromRequest(ctx, req)
+	if err != nil {
+		return "", false, err
+	}
+	var incomingUrl string
+	if len(variants) == 0 {
+		if incomingUrl, err = s.prepareDestination(ctx, req.URL, utm); err != nil {
+			return "", false, err
+		}
+	} else {
+		for i := range variants {
+			if variants[i].URL, err = s.prepareDestination(ctx, variants[i].URL, utm); err != nil {
+				return "", false, fmt.Errorf("variant %s: %w", variants[i].Name, err)
+			}
+		}
+		incomingUrl = variants[0].URL
+	}
+
+	dedupe := false
+	if len(variants) == 0 && deepLink.isZero() && expiresAt == nil {
+		if dedupe, err = s.shouldDedupe(ctx, req); err != nil {
+			return "", false, err
+		}
 	}
 
-	// Use customAlias if provided, otherwise generate a short code
 	var shortCode string
-	if customAlias != "" {
+	for attempt := 1; ; attempt++ {
+		// Use customAlias if provided, otherwise generate a short code
 		shortCode = customAlias
-	} else {
-		shortCode = generateShortCode(incomingUrl)
+		if shortCode == "" {
+			shortCode = generateShortCode(ctx, incomingUrl)
+		}
+
+		// PostgreSQL decides whether the code is free, so the entry and its
+		// details are written first
+		var created bool
+		switch {
+		case dedupe:
+			var code string
+			code, created, err = s.repo.FindOrCreate(ctx, shortCode, incomingUrl, owner, createdAt, details)
+			if err == nil && !created {
+				slog.InfoContext(ctx, "Reused existing entry", "code", code)
+				return code, true, nil
+			}
+			if errors.Is(err, errAliasTaken) {
+				err = nil
+			}
+		case len(variants) > 0:
+			created, err = s.repo.CreateSplit(ctx, shortCode, owner, sticky, variants, createdAt, deepLink, expiresAt, details)
+		default:
+			created, err = s.repo.Create(ctx, shortCode, incomingUrl, owner, 0, createdAt, deepLink, expiresAt, details)
+		}
+		if err != nil {
+			return "", false, fmt.Errorf("failed to store in PostgreSQL: %w", err)
+		}
+		if created {
+			break
+		}
+		if customAlias != "" {
+			return "", false, errAliasTaken
+		}
+		if attempt == maxCodeAttempts {
+			return "", false, fmt.Errorf("failed to generate a unique code after %d attempts", attempt)
+		}
+	}
+
+	link := Link{
+		URL:          incomingUrl,
+		ShortCode:    shortCode,
+		CreatedAt:    createdAt.Truncate(time.Second),
+		Destinations: variants,
+		Sticky:       sticky,
+		ExpiresAt:    expiresAt,
+	}
+	if !deepLink.isZero() {
+		link.DeepLink = &deepLink
+	}
+
+	// Cache with the configured expiration. PostgreSQL is the source of
+	// truth; Get repopulates the cache on a miss.
+	if jsonData, err := json.Marshal(link); err != nil {
+		slog.WarnContext(ctx, "Failed to marshal entry for the cache", "code", shortCode, "error", err)
+	} else if err := s.redis.Set(ctx, shortCode, jsonData, s.cacheTTL); err != nil {
+		slog.WarnContext(ctx, "Failed to cache created entry", "code", shortCode, "error", err)
+	}
+
+	s.emitLinkEvent(ctx, EventLinkCreated, Entry{ShortCode: shortCode, OriginalURL: incomingUrl, Owner: owner, CreatedAt: createdAt,
+		ExpiresAt: expiresAt}, "")
+	slog.InfoContext(ctx, "Created entry", "code", shortCode, "custom_alias", customAlias != "")
+	return shortCode, false, nil
+}
+
+// prepareDestination normalizes a destination, merges the campaign fields
+// into it and screens the result
+func (s *Service) prepareDestination(ctx context.Context, rawURL string, utm UTM) (string, error) {
+	destination, err := s.destinations.Normalize(rawURL)
+	if err != nil {
+		return "", err
+	}
+	if !utm.isZero() {
+		if destination, err = withUTM(destination, utm); err == nil {
+			destination, err = s.destinations.Normalize(destination)
+		}
+		if err != nil {
+			return "", err
+		}
 	}
+	if verdict, blocked := s.screen(ctx, screenStageCreate, destination); blocked {
+		return "", fmt.Errorf("%w by the %s list", ErrBlockedURL, verdict.List)
+	}
+	return destination, nil
+}
 
-	// Prepare the entry data with timestamp
-	entryData := map[string]any{
-		"url":       incomingUrl,
-		"shortCode": shortCode,
-		"createdAt": time.Now().UTC().Format(time.RFC3339),
-		"clicks":    0,
+// shouldDedupe decides whether a create reuses an existing entry: the dedupe
+// field of the request wins, otherwise the owner's setting applies. Custom
+// aliases always create the requested code.
+func (s *Service) shouldDedupe(ctx context.Context, req CreateRequest) (bool, error) {
+	if req.CustomAlias != "" {
+		return false, nil
 	}
+	if req.Dedupe != nil {
+		return *req.Dedupe, nil
+	}
+	if req.Owner == "" {
+		return false, nil
+	}
+	settings, err := s.repo.GetOwnerSettings(ctx, req.Owner)
+	if err != nil {
+		return false, fmt.Errorf("failed to load owner settings: %w", err)
+	}
+	return settings.Dedupe, nil
+}
 
-	// Store in Redis with 24-hour expiration
-	jsonData, err := json.Marshal(entryData)
+// GetOwnerSettings returns the link defaults of owner
+func (s *Service) GetOwnerSettings(ctx context.Context, owner string) (OwnerSettings, error) {
+	return s.repo.GetOwnerSettings(ctx, owner)
+}
+
+// SaveOwnerSettings replaces the link defaults of an owner
+func (s *Service) SaveOwnerSettings(ctx context.Context, settings OwnerSettings) error {
+	return s.repo.SaveOwnerSettings(ctx, settings)
+}
+
+// Get retrieves an entry by ID. Entries whose destination has been flagged
+// since they were created are reported as ErrLinkDisabled.
+func (s *Service) Get(ctx context.Context, id string) (Link, error) {
+	link, err := s.lookup(ctx, id)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal data: %w", err)
+		return Link{}, err
 	}
+	return link, s.checkResolvable(ctx, link)
+}
 
-	ctx := context.Background()
-	err = s.redis.Set(ctx, shortCode, jsonData, 24*time.Hour)
+// Resolve looks up an entry for a visit. The first routing rule the visit
+// matches picks the destination, which is returned as the entry's url along
+// with the rule. Otherwise split links resolve to one of their destinations,
+// returned with its variant. Deep links add the app URL of the visitor's
+// platform, with the destination as its web fallback.
+func (s *Service) Resolve(ctx context.Context, id string, visit Visit) (Link, error) {
+	link, err := s.lookup(ctx, id)
 	if err != nil {
-		return "", fmt.Errorf("failed to store in Redis: %w", err)
+		return Link{}, err
 	}
 
-	// Write-through to PostgreSQL via repository
-	createdAt := time.Now().UTC()
-	if err := s.repo.Create(ctx, shortCode, incomingUrl, 0, createdAt); err != nil {
-		return "", fmt.Errorf("failed to store in PostgreSQL: %w", err)
+	// A failure to load rules falls back to the default destination
+	rules, err := s.routingRules(ctx, id)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to load routing rules", "code", id, "error", err)
+	}
+	matched := -1
+	if len(rules) > 0 {
+		matched = firstMatch(rules, s.newRuleRequest(ctx, visit))
+	}
+	if matched >= 0 {
+		link.URL = rules[matched].Destination
+		link.Rule = rules[matched].label(matched)
+	} else if len(link.Destinations) > 0 {
+		chosen := chooseVariant(link.Destinations, link.Sticky, id, visit)
+		link.URL = chosen.URL
+		link.Variant = chosen.Name
 	}
 
-	return shortCode, nil
+	if link.DeepLink != nil {
+		platform := platformOf(s.agents.Parse(visit.UserAgent))
+		if appURL := link.DeepLink.forPlatform(platform); appURL != "" {
+			link.Platform = platform
+			link.AppURL = appURL
+		}
+	}
+	return link, s.checkResolvable(ctx, link)
 }
 
-// Get retrieves an entry by ID (from Redis first, fallback to PostgreSQL)
-func (s *Service) Get(id string) (map[string]any, error) {
-	ctx := context.Background()
+// checkResolvable reports ErrLinkDisabled when the destination of a resolved
+// entry has been flagged since it was created
+func (s *Service) checkResolvable(ctx context.Context, link Link) error {
+	if verdict, blocked := s.screen(ctx, screenStageResolve, link.URL); blocked {
+		return fmt.Errorf("%w: destination flagged by the %s list", ErrLinkDisabled, verdict.List)
+	}
+	return nil
+}
 
+// lookup retrieves an entry by ID (from Redis first, fallback to PostgreSQL).
+// Expired entries are reported as ErrLinkExpired.
+func (s *Service) lookup(ctx context.Context, id string) (Link, error) {
 	// Try Redis first
 	data, err := s.redis.Get(ctx, id)
 	if err == nil {
 		// Cache hit - parse the JSON data
-		var result map[string]any
-		if err := json.Unmarshal([]byte(data), &result); err != nil {
-			return nil, fmt.Errorf("invalid data format: %w", err)
+		var link Link
+		if err := json.Unmarshal([]byte(data), &link); err != nil {
+			return Link{}, fmt.Errorf("invalid data format: %w", err)
 		}
-		return result, nil
+		return link, checkExpiry(link, time.Now())
 	}
 
 	// Cache miss - try PostgreSQL via repository
+	slog.DebugContext(ctx, "Cache miss, falling back to PostgreSQL", "code", id)
 	entry, err := s.repo.GetByShortCode(ctx, id)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query PostgreSQL: %w", err)
+		return Link{}, fmt.Errorf("failed to query PostgreSQL: %w", err)
 	}
 	if entry == nil {
-		return nil, fmt.Errorf("entry not found")
+		return Link{}, ErrEntryNotFound
 	}
 
 	// Rebuild entry data from PostgreSQL
-	result := map[string]any{
-		"url":       entry.OriginalURL,
-		"shortCode": entry.ShortCode,
-		"createdAt": entry.CreatedAt.Format(time.RFC3339),
-		"clicks":    entry.Clicks,
+	link := Link{
+		URL:       entry.OriginalURL,
+		ShortCode: entry.ShortCode,
+		CreatedAt: entry.CreatedAt.UTC().Truncate(time.Second),
+		Clicks:    int64(entry.Clicks),
+	}
+	variants, err := s.repo.GetVariants(ctx, id)
+	if err != nil {
+		return Link{}, fmt.Errorf("failed to query destinations: %w", err)
 	}
+	if len(variants) > 0 {
+		link.Destinations = variants
+		link.Sticky = entry.Sticky
+	}
+	if !entry.DeepLink.isZero() {
+		link.DeepLink = &entry.DeepLink
+	}
+	link.ExpiresAt = entry.ExpiresAt
 
 	// Repopulate Redis cache
-	jsonData, _ := json.Marshal(result)
-	s.redis.Set(ctx, id, jsonData, 24*time.Hour)
+	jsonData, _ := json.Marshal(link)
+	if err := s.redis.Set(ctx, id, jsonData, s.cacheTTL); err != nil {
+		slog.WarnContext(ctx, "Failed to repopulate Redis cache", "code", id, "error", err)
+	}
 
-	return result, nil
+	return link, checkExpiry(link, time.Now())
 }
 
-// GetStats retrieves statistics for an entry by ID (from Redis first, fallback to PostgreSQL)
-func (s *Service) GetStats(id string) (map[string]any, error) {
-	ctx := context.Background()
+// GetStats retrieves statistics for an entry by ID. Click counters are written
+// to PostgreSQL on every resolve, so stats are read from there rather than from
+// the cached entry. Unique visitors are counted over the UTC days from and to.
+func (s *Service) GetStats(ctx context.Context, id string, from, to time.Time) (LinkStats, error) {
+	clicks, createdAt, err := s.repo.GetStats(ctx, id)
+	if err != nil {
+		return LinkStats{}, fmt.Errorf("failed to query PostgreSQL: %w", err)
+	}
+	if clicks == 0 && createdAt.IsZero() {
+		return LinkStats{}, ErrEntryNotFound
+	}
 
-	// Try Redis first
-	data, err := s.redis.Get(ctx, id)
-	var clicks int
-	var createdAt string
-	var size int
+	countries, err := s.repo.GetCountryBreakdown(ctx, id)
+	if err != nil {
+		return LinkStats{}, fmt.Errorf("failed to query country breakdown: %w", err)
+	}
 
-	if err == nil {
-		// Cache hit - parse the JSON data
-		var entryData map[string]any
-		if err := json.Unmarshal([]byte(data), &entryData); err != nil {
-			return nil, fmt.Errorf("invalid data format: %w", err)
-		}
+	channels, err := s.repo.GetBreakdown(ctx, id, "channel", 0)
+	if err != nil {
+		return LinkStats{}, fmt.Errorf("failed to query channel breakdown: %w", err)
+	}
 
-		if clicksVal, ok := entryData["clicks"].(float64); ok {
-			clicks = int(clicksVal)
+	stats := LinkStats{
+		EntryID:   id,
+		Clicks:    clicks,
+		CreatedAt: createdAt.UTC().Truncate(time.Second),
+		Countries: countries,
+		Channels:  channels,
+	}
+
+	if stats.Variants, err = s.repo.GetVariantStats(ctx, id); err != nil {
+		return LinkStats{}, fmt.Errorf("failed to query variant stats: %w", err)
+	}
+
+	if s.visitors != nil {
+		daily, total, err := s.visitors.Count(ctx, id, from, to)
+		if err != nil {
+			return LinkStats{}, fmt.Errorf("failed to count unique visitors: %w", err)
 		}
-		if createdAtVal, ok := entryData["createdAt"].(string); ok {
-			createdAt = createdAtVal
+		stats.UniqueVisitors = &UniqueVisitors{
+			From:  dayKey(from),
+			To:    dayKey(to),
+			Total: total,
+			Daily: daily,
 		}
-		size = len(data)
-	} else {
-		// Cache miss - try PostgreSQL via repository
-		clicks, dbCreatedAt, err := s.repo.GetStats(ctx, id)
+	}
+
+	return stats, nil
+}
+
+// GetDeviceStats breaks the clicks of an entry down by browser, OS and device
+// class. Bot traffic is reported separately per crawler.
+func (s *Service) GetDeviceStats(ctx context.Context, id string) (map[string]any, error) {
+	entry, err := s.repo.GetByShortCode(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query PostgreSQL: %w", err)
+	}
+	if entry == nil {
+		return nil, ErrEntryNotFound
+	}
+
+	stats := map[string]any{"entry_id": id}
+	for key, column := range map[string]string{
+		"browsers": "browser",
+		"os":       "os",
+		"devices":  "device",
+		"bots":     "bot_name",
+	} {
+		items, err := s.repo.GetBreakdown(ctx, id, column, 0)
 		if err != nil {
-			return nil, fmt.Errorf("failed to query PostgreSQL: %w", err)
+			return nil, fmt.Errorf("failed to query %s breakdown: %w", column, err)
 		}
-		if clicks == 0 && dbCreatedAt.IsZero() {
-			return nil, fmt.Errorf("entry not found")
-		}
-		createdAt = dbCreatedAt.Format(time.RFC3339)
-		size = len(id) // Approximate size
+		stats[key] = items
 	}
 
-	stats := map[string]any{
-		"entry_id":  id,
-		"clicks":    clicks,
-		"createdAt": createdAt,
-		"size":      size,
+	return stats, nil
+}
+
+// GetReferrerStats returns the top referrer domains of an entry along with its
+// channel and utm_* breakdowns
+func (s *Service) GetReferrerStats(ctx context.Context, id string, limit int) (map[string]any, error) {
+	entry, err := s.repo.GetByShortCode(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query PostgreSQL: %w", err)
+	}
+	if entry == nil {
+		return nil, ErrEntryNotFound
+	}
+
+	stats := map[string]any{"entry_id": id}
+	for key, column := range map[string]string{
+		"referrers":     "referrer_domain",
+		"channels":      "channel",
+		"utm_sources":   "utm_source",
+		"utm_mediums":   "utm_medium",
+		"utm_campaigns": "utm_campaign",
+	} {
+		items, err := s.repo.GetBreakdown(ctx, id, column, limit)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query %s breakdown: %w", column, err)
+		}
+		stats[key] = items
 	}
 
 	return stats, nil
 }
+
+// GetTimeSeries returns the clicks of an entry per time bucket, including
+// empty buckets
+func (s *Service) GetTimeSeries(ctx context.Context, q TimeSeriesQuery) (map[string]any, error) {
+	entry, err := s.repo.GetByShortCode(ctx, q.ShortCode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query PostgreSQL: %w", err)
+	}
+	if entry == nil {
+		return nil, ErrEntryNotFound
+	}
+
+	counts, err := s.repo.GetClickBuckets(ctx, q)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query click time series: %w", err)
+	}
+
+	buckets := q.zeroFill(counts)
+	total := 0
+	for _, b := range buckets {
+		total += b.Clicks
+	}
+
+	return map[string]any{
+		"entry_id": q.ShortCode,
+		"interval": q.Interval,
+		"timezone": q.Location.String(),
+		"from":     q.From.Format(time.RFC3339),
+		"to":       q.To.In(q.Location).Format(time.RFC3339),
+		"total":    total,
+		"buckets":  buckets,
+	}, nil
+}
+
+// RecordClick enriches a resolve of shortCode with its location, client
+// details and traffic source and stores it
+func (s *Service) RecordClick(ctx context.Context, shortCode string, visit Visit) error {
+	agent := s.agents.Parse(visit.UserAgent)
+	utm := utmFromQuery(visit.Query)
+	domain := normalizeReferrer(visit.Referer)
+	click := Click{
+		ShortCode:      shortCode,
+		OccurredAt:     visit.At,
+		Browser:        agent.Browser,
+		BrowserVersion: agent.BrowserVersion,
+		OS:             agent.OS,
+		Device:         agent.Device,
+		Bot:            agent.Bot,
+		BotName:        agent.BotName,
+		ReferrerDomain: domain,
+		Channel:        classifyChannel(domain, utm),
+		UTM:            utm,
+		Variant:        visit.Variant,
+	}
+
+	if s.geo != nil {
+		loc, err := s.geo.Lookup(visit.IP)
+		if err != nil {
+			slog.WarnContext(ctx, "GeoIP lookup failed", "ip", visit.IP, "error", err)
+		}
+		click.Country, click.Region, click.City = loc.Country, loc.Region, loc.City
+	}
+
+	if err := s.repo.RecordClick(ctx, click); err != nil {
+		return fmt.Errorf("failed to record click: %w", err)
+	}
+
+	if s.webhooks != nil {
+		s.webhooks.AddClick(click)
+	}
+	if s.clickStream != nil {
+		if err := s.clickStream.Publish(ctx, click); err != nil {
+			slog.WarnContext(ctx, "Failed to publish click", "code", shortCode, "error", err)
+		}
+	}
+
+	if s.visitors != nil && !agent.Bot {
+		if err := s.visitors.Track(ctx, shortCode, visit); err != nil {
+			slog.WarnContext(ctx, "Failed to track unique visitor", "code", shortCode, "error", err)
+		}
+	}
+	return nil
+}
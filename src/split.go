@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+	"net/http"
+	"time"
+)
+
+// ErrInvalidSplit is wrapped by invalid multi-destination requests
+var ErrInvalidSplit = newError(CodeInvalidInput, "invalid destinations")
+
+const (
+	// minVariants and maxVariants bound the destinations of a split link
+	minVariants = 2
+	maxVariants = 10
+	// maxVariantWeight bounds the weight of one destination
+	maxVariantWeight = 1000
+	// maxVariantNameLength bounds the name of a variant
+	maxVariantNameLength = 32
+	// variantCookiePrefix and variantCookieMaxAge describe the cookies that
+	// keep visitors on one variant
+	variantCookiePrefix = "smolearl_variant_"
+	variantCookieMaxAge = 30 * 24 * time.Hour
+)
+
+// How visitors of a split link are kept on the same variant
+const (
+	stickyNone   = ""
+	stickyCookie = "cookie"
+	stickyHash   = "hash"
+)
+
+// Variant is one weighted destination of a split link
+type Variant struct {
+	Name   string `json:"variant"`
+	URL    string `json:"url"`
+	Weight int    `json:"weight"`
+}
+
+// VariantStats is the performance of one destination of a split link
+type VariantStats struct {
+	Variant string `json:"variant"`
+	URL     string `json:"url"`
+	Weight  int    `json:"weight"`
+	Clicks  int    `json:"clicks"`
+}
+
+// splitFromRequest validates the destinations and sticky fields of a create
+// request. Variants without a name are named a, b, c and so on, and the weight
+// defaults to 1. URLs are returned as given.
+func splitFromRequest(items []DestinationRequest, sticky string) ([]Variant, string, error) {
+	if len(items) == 0 {
+		if sticky != "" {
+			return nil, "", fmt.Errorf("%w: sticky requires destinations", ErrInvalidSplit)
+		}
+		return nil, "", nil
+	}
+	if len(items) < minVariants || len(items) > maxVariants {
+		return nil, "", fmt.Errorf("%w: between %d and %d destinations are required", ErrInvalidSplit, minVariants, maxVariants)
+	}
+
+	variants := make([]Variant, len(items))
+	seen := make(map[string]bool)
+	for i, item := range items {
+		v := Variant{Name: item.Name, URL: item.URL, Weight: 1}
+		if v.Name == "" {
+			v.Name = string(rune('a' + i))
+		}
+		if err := validateVariantName(v.Name); err != nil {
+			return nil, "", err
+		}
+		if seen[v.Name] {
+			return nil, "", fmt.Errorf("%w: variant %q is repeated", ErrInvalidSplit, v.Name)
+		}
+		seen[v.Name] = true
+		if item.Weight != nil {
+			v.Weight = *item.Weight
+		}
+		if v.Weight < 1 || v.Weight > maxVariantWeight {
+			return nil, "", fmt.Errorf("%w: weight of variant %q must be between 1 and %d", ErrInvalidSplit, v.Name, maxVariantWeight)
+		}
+		variants[i] = v
+	}
+
+	switch sticky {
+	case "none":
+		sticky = stickyNone
+	case stickyNone, stickyCookie, stickyHash:
+	default:
+		return nil, "", fmt.Errorf("%w: sticky must be none, cookie or hash", ErrInvalidSplit)
+	}
+	return variants, sticky, nil
+}
+
+// validateVariantName accepts names usable in cookies and stats
+func validateVariantName(name string) error {
+	if len(name) > maxVariantNameLength {
+		return fmt.Errorf("%w: variant names are at most %d characters", ErrInvalidSplit, maxVariantNameLength)
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return fmt.Errorf("%w: variant %q may only contain letters, digits, - and _", ErrInvalidSplit, name)
+		}
+	}
+	return nil
+}
+
+// chooseVariant picks the destination of a split link for a visit. With
+// cookie stickiness the variant remembered by the visitor wins while it
+// exists. With hash stickiness the pick is derived from the visitor's address
+// and user agent, so repeated visits land on the same variant. Otherwise it
+// is random, in proportion to the weights.
+func chooseVariant(variants []Variant, sticky, shortCode string, visit Visit) Variant {
+	if sticky == stickyCookie && visit.Variant != "" {
+		for _, v := range variants {
+			if v.Name == visit.Variant {
+				return v
+			}
+		}
+	}
+
+	total := 0
+	for _, v := range variants {
+		total += v.Weight
+	}
+	var n int
+	if sticky == stickyHash {
+		h := fnv.New64a()
+		for _, part := range []string{shortCode, visit.IP.String(), visit.UserAgent} {
+			h.Write([]byte(part))
+			h.Write([]byte{0})
+		}
+		n = int(h.Sum64() % uint64(total))
+	} else {
+		n = rand.IntN(total)
+	}
+	for _, v := range variants {
+		if n < v.Weight {
+			return v
+		}
+		n -= v.Weight
+	}
+	return variants[len(variants)-1]
+}
+
+// variantCookieName returns the cookie remembering the variant of shortCode.
+// Short codes may contain characters not allowed in cookie names, so they
+// are encoded.
+func variantCookieName(shortCode string) string {
+	return variantCookiePrefix + base64.RawURLEncoding.EncodeToString([]byte(shortCode))
+}
+
+// setVariantCookie keeps the visitor on variant for later resolves
+func setVariantCookie(w http.ResponseWriter, shortCode, variant string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     variantCookieName(shortCode),
+		Value:    variant,
+		Path:     "/",
+		MaxAge:   int(variantCookieMaxAge.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Time series bucket sizes
+const (
+	IntervalMinute = "minute"
+	IntervalHour   = "hour"
+	IntervalDay    = "day"
+)
+
+// Sources a time series can be aggregated from, cheapest last
+const (
+	sourceEvents = "events"
+	sourceHourly = "hourly"
+	sourceDaily  = "daily"
+)
+
+// maxTimeSeriesBuckets bounds the size of a single time series response
+const maxTimeSeriesBuckets = 10000
+
+// defaultTimeSeriesSpan is the range used when from is omitted
+var defaultTimeSeriesSpan = map[string]time.Duration{
+	IntervalMinute: time.Hour,
+	IntervalHour:   7 * 24 * time.Hour,
+	IntervalDay:    30 * 24 * time.Hour,
+}
+
+// TimeSeriesQuery selects the clicks of one entry bucketed by interval in the
+// given location. From is aligned to a bucket start and To is exclusive.
+type TimeSeriesQuery struct {
+	ShortCode string
+	From      time.Time
+	To        time.Time
+	Interval  string
+	Location  *time.Location
+}
+
+// TimeBucket is the number of clicks in the bucket starting at Start
+type TimeBucket struct {
+	Start  time.Time `json:"start"`
+	Clicks int       `json:"clicks"`
+}
+
+// parseTimeSeriesQuery reads from, to, interval and tz from the query string.
+// from and to accept RFC 3339 timestamps or dates interpreted in tz.
+func parseTimeSeriesQuery(shortCode string, values url.Values, now time.Time) (TimeSeriesQuery, error) {
+	q := TimeSeriesQuery{ShortCode: shortCode, Interval: IntervalHour, Location: time.UTC}
+
+	if interval := values.Get("interval"); interval != "" {
+		if _, ok := defaultTimeSeriesSpan[interval]; !ok {
+			return q, fmt.Errorf("interval must be minute, hour or day")
+		}
+		q.Interval = interval
+	}
+
+	if tz := values.Get("tz"); tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			return q, fmt.Errorf("unknown time zone %q", tz)
+		}
+		q.Location = loc
+	}
+
+	var err error
+	q.To = now
+	if raw := values.Get("to"); raw != "" {
+		if q.To, err = parseTimeParam(raw, q.Location); err != nil {
+			return q, fmt.Errorf("invalid to: %w", err)
+		}
+	}
+	q.From = q.To.Add(-defaultTimeSeriesSpan[q.Interval])
+	if raw := values.Get("from"); raw != "" {
+		if q.From, err = parseTimeParam(raw, q.Location); err != nil {
+			return q, fmt.Errorf("invalid from: %w", err)
+		}
+	}
+	if !q.From.Before(q.To) {
+		return q, fmt.Errorf("from must be before to")
+	}
+
+	q.From = truncateToBucket(q.From, q.Interval, q.Location)
+	if len(q.bucketStarts()) > maxTimeSeriesBuckets {
+		return q, fmt.Errorf("range spans more than %d buckets, use a larger interval", maxTimeSeriesBuckets)
+	}
+	return q, nil
+}
+
+// parseTimeParam parses an RFC 3339 timestamp or a plain date in loc
+func parseTimeParam(raw string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation(time.DateOnly, raw, loc); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("%q is neither an RFC 3339 timestamp nor a YYYY-MM-DD date", raw)
+}
+
+// truncateToBucket returns the start of the bucket containing t, using wall
+// clock boundaries in loc so days start at local midnight
+func truncateToBucket(t time.Time, interval string, loc *time.Location) time.Time {
+	t = t.In(loc)
+	switch interval {
+	case IntervalMinute:
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, loc)
+	case IntervalHour:
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, loc)
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	}
+}
+
+// nextBucket returns the start of the bucket following start
+func nextBucket(start time.Time, interval string, loc *time.Location) time.Time {
+	switch interval {
+	case IntervalMinute:
+		return start.Add(time.Minute)
+	case IntervalHour:
+		return truncateToBucket(start.Add(time.Hour), interval, loc)
+	default:
+		// AddDate keeps local midnight across DST changes
+		return truncateToBucket(start.AddDate(0, 0, 1), interval, loc)
+	}
+}
+
+// bucketStarts lists every bucket start in the query range, stopping early
+// once the limit is exceeded
+func (q TimeSeriesQuery) bucketStarts() []time.Time {
+	var starts []time.Time
+	for t := q.From; t.Before(q.To) && len(starts) <= maxTimeSeriesBuckets; t = nextBucket(t, q.Interval, q.Location) {
+		starts = append(starts, t)
+	}
+	return starts
+}
+
+// end returns the exclusive upper bound of the last bucket
+func (q TimeSeriesQuery) end() time.Time {
+	starts := q.bucketStarts()
+	return nextBucket(starts[len(starts)-1], q.Interval, q.Location)
+}
+
+// source picks the cheapest table able to answer q. Rollups are stored in UTC,
+// so hourly rollups only serve zones whose offset is a whole number of hours
+// and daily rollups only serve UTC days.
+func (q TimeSeriesQuery) source() string {
+	if q.Interval == IntervalMinute {
+		return sourceEvents
+	}
+	if q.Interval == IntervalDay && q.Location == time.UTC {
+		return sourceDaily
+	}
+	for _, t := range []time.Time{q.From, q.To} {
+		if _, offset := t.In(q.Location).Zone(); offset%3600 != 0 {
+			return sourceEvents
+		}
+	}
+	return sourceHourly
+}
+
+// zeroFill returns one bucket per interval in the range, using counts where
+// present. Counts are keyed by bucket start in Unix seconds.
+func (q TimeSeriesQuery) zeroFill(counts map[int64]int) []TimeBucket {
+	starts := q.bucketStarts()
+	buckets := make([]TimeBucket, 0, len(starts))
+	for _, start := range starts {
+		buckets = append(buckets, TimeBucket{Start: start, Clicks: counts[start.Unix()]})
+	}
+	return buckets
+}
+
+// defaultVisitorRangeDays is the unique visitor range used when from is omitted
+const defaultVisitorRangeDays = 30
+
+// parseDayRange reads the inclusive UTC day range from and to (YYYY-MM-DD),
+// defaulting to the last 30 days
+func parseDayRange(values url.Values, now time.Time) (time.Time, time.Time, error) {
+	to := truncateToBucket(now, IntervalDay, time.UTC)
+	if raw := values.Get("to"); raw != "" {
+		t, err := time.ParseInLocation(time.DateOnly, raw, time.UTC)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid to: %q is not a YYYY-MM-DD date", raw)
+		}
+		to = t
+	}
+
+	from := to.AddDate(0, 0, 1-defaultVisitorRangeDays)
+	if raw := values.Get("from"); raw != "" {
+		t, err := time.ParseInLocation(time.DateOnly, raw, time.UTC)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid from: %q is not a YYYY-MM-DD date", raw)
+		}
+		from = t
+	}
+
+	if from.After(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("from must not be after to")
+	}
+	if to.Sub(from) >= maxVisitorRangeDays*24*time.Hour {
+		return time.Time{}, time.Time{}, fmt.Errorf("range must not exceed %d days", maxVisitorRangeDays)
+	}
+	return from, to, nil
+}
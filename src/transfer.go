@@ -0,0 +1,565 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Supported import/export formats
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+)
+
+// How an import treats records whose short code already exists
+const (
+	ConflictSkip      = "skip"
+	ConflictOverwrite = "overwrite"
+	ConflictFail      = "fail"
+)
+
+const (
+	// defaultImportBatchSize is the number of records written per transaction
+	defaultImportBatchSize = 500
+	// exportFlushEvery controls how often streamed exports are flushed
+	exportFlushEvery = 500
+	// maxImportErrors bounds the per-line errors kept in an ImportReport
+	maxImportErrors = 1000
+	// maxJSONLLine bounds the size of a single JSON Lines record
+	maxJSONLLine = 1 << 20
+)
+
+// linkRecordColumns is the CSV header written on export and expected on import
+var linkRecordColumns = []string{"short_code", "original_url", "owner", "clicks", "created_at", "metadata",
+	"title", "description", "notes", "tags"}
+
+// LinkRecord is the portable form of an entry used by import and export
+type LinkRecord struct {
+	ShortCode   string         `json:"short_code"`
+	OriginalURL string         `json:"original_url"`
+	Owner       string         `json:"owner,omitempty"`
+	Clicks      int            `json:"clicks"`
+	CreatedAt   time.Time      `json:"created_at"`
+	Metadata    map[string]any `json:"metadata,omitempty"`
+	Title       string         `json:"title,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Notes       string         `json:"notes,omitempty"`
+	// Tags are comma separated in CSV
+	Tags []string `json:"tags,omitempty"`
+}
+
+// linkRecordOf converts an entry to its portable form
+func linkRecordOf(e Entry) LinkRecord {
+	return LinkRecord{
+		ShortCode:   e.ShortCode,
+		OriginalURL: e.OriginalURL,
+		Owner:       e.Owner,
+		Clicks:      e.Clicks,
+		CreatedAt:   e.CreatedAt.UTC(),
+		Metadata:    e.Metadata,
+		Title:       e.Details.Title,
+		Description: e.Details.Description,
+		Notes:       e.Details.Notes,
+		Tags:        e.Details.Tags,
+	}
+}
+
+// ExportFilter restricts which entries are exported. Zero values match all.
+type ExportFilter struct {
+	Owner string
+	Tag   string
+	// FolderID matches the links of a folder and of its subfolders
+	FolderID      *int64
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+}
+
+// ImportOptions controls an import run
+type ImportOptions struct {
+	Format     string
+	OnConflict string
+	// StartLine skips every record on or before this line, to resume a run
+	StartLine int
+	BatchSize int
+}
+
+// ImportError describes a record that could not be imported
+type ImportError struct {
+	Line      int    `json:"line"`
+	ShortCode string `json:"short_code,omitempty"`
+	Error     string `json:"error"`
+}
+
+// ImportReport summarizes an import run. LastLine is the last line whose
+// outcome is final; passing it as StartLine resumes the run.
+type ImportReport struct {
+	Processed   int           `json:"processed"`
+	Created     int           `json:"created"`
+	Overwritten int           `json:"overwritten"`
+	Skipped     int           `json:"skipped"`
+	Failed      int           `json:"failed"`
+	LastLine    int           `json:"last_line"`
+	Aborted     bool          `json:"aborted"`
+	Errors      []ImportError `json:"errors"`
+}
+
+func (r *ImportReport) addError(line int, shortCode string, err error) {
+	r.Failed++
+	if len(r.Errors) < maxImportErrors {
+		r.Errors = append(r.Errors, ImportError{Line: line, ShortCode: shortCode, Error: err.Error()})
+	}
+}
+
+// importOutcome is what happened to a single record of an import batch
+type importOutcome int
+
+const (
+	outcomeNotProcessed importOutcome = iota
+	outcomeCreated
+	outcomeOverwritten
+	outcomeSkipped
+	outcomeConflict
+)
+
+// validFormat reports whether format is csv or jsonl
+func validFormat(format string) bool {
+	return format == FormatCSV || format == FormatJSONL
+}
+
+// validConflictMode reports whether mode is skip, overwrite or fail
+func validConflictMode(mode string) bool {
+	return mode == ConflictSkip || mode == ConflictOverwrite || mode == ConflictFail
+}
+
+// ExportLinks streams the entries matching filter to w and returns how many
+// were written. w is flushed periodically when it supports it.
+func (s *Service) ExportLinks(ctx context.Context, w io.Writer, format string, filter ExportFilter) (int, error) {
+	rw, err := newRecordWriter(w, format)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	err = s.repo.ExportEntries(ctx, filter, func(e Entry) error {
+		if err := rw.Write(linkRecordOf(e)); err != nil {
+			return err
+		}
+		count++
+		if count%exportFlushEvery == 0 {
+			return flush(w, rw)
+		}
+		return nil
+	})
+	if err != nil {
+		return count, fmt.Errorf("export failed after %d records: %w", count, err)
+	}
+	return count, flush(w, rw)
+}
+
+// flush drains the record writer and the underlying HTTP response, if any
+func flush(w io.Writer, rw recordWriter) error {
+	if err := rw.Flush(); err != nil {
+		return err
+	}
+	hw, ok := w.(http.ResponseWriter)
+	if !ok {
+		return nil
+	}
+	if err := http.NewResponseController(hw).Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	return nil
+}
+
+// ImportLinks reads records from r and writes them in batches. Invalid
+// records are reported per line without stopping the run; conflicting short
+// codes are skipped, overwritten or abort the run depending on the options.
+// onCommit, if set, is called with LastLine after every committed batch.
+func (s *Service) ImportLinks(ctx context.Context, r io.Reader, opts ImportOptions, onCommit func(lastLine int)) (ImportReport, error) {
+	report := ImportReport{LastLine: opts.StartLine, Errors: []ImportError{}}
+	if !validConflictMode(opts.OnConflict) {
+		return report, fmt.Errorf("unknown conflict mode %q", opts.OnConflict)
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultImportBatchSize
+	}
+
+	reader, err := newRecordReader(r, opts.Format)
+	if err != nil {
+		return report, err
+	}
+
+	var lines []int
+	var entries []Entry
+	commit := func(lastRead int) error {
+		if len(entries) > 0 {
+			outcomes, err := s.repo.ImportBatch(ctx, entries, opts.OnConflict)
+			if err != nil {
+				return fmt.Errorf("failed to write batch ending at line %d: %w", lastRead, err)
+			}
+
+			var overwritten []string
+			for i, outcome := range outcomes {
+				switch outcome {
+				case outcomeCreated:
+					report.Created++
+					s.emitLinkEvent(ctx, EventLinkCreated, entries[i], "")
+				case outcomeOverwritten:
+					report.Overwritten++
+					overwritten = append(overwritten, entries[i].ShortCode)
+					s.emitLinkEvent(ctx, EventLinkUpdated, entries[i], "import")
+				case outcomeSkipped:
+					report.Skipped++
+				case outcomeConflict:
+					report.addError(lines[i], entries[i].ShortCode, errors.New("short code already exists"))
+					report.Aborted = true
+					// Everything before the conflict is final
+					report.LastLine = lines[i] - 1
+				}
+			}
+			s.invalidate(ctx, overwritten)
+		}
+		if !report.Aborted {
+			report.LastLine = lastRead
+		}
+		lines, entries = lines[:0], entries[:0]
+		if onCommit != nil {
+			onCommit(report.LastLine)
+		}
+		return nil
+	}
+
+	lastRead := opts.StartLine
+	for !report.Aborted {
+		rec, line, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil && line == 0 {
+			// The input itself is unreadable, not just this record
+			return report, err
+		}
+		if line <= opts.StartLine {
+			continue
+		}
+		lastRead = line
+
+		report.Processed++
+		if err == nil {
+			err = s.validateRecord(ctx, &rec)
+		}
+		if err != nil {
+			report.addError(line, rec.ShortCode, err)
+			continue
+		}
+
+		lines = append(lines, line)
+		entries = append(entries, Entry{
+			ShortCode:   rec.ShortCode,
+			OriginalURL: rec.OriginalURL,
+			Owner:       rec.Owner,
+			Clicks:      rec.Clicks,
+			CreatedAt:   rec.CreatedAt,
+			Metadata:    rec.Metadata,
+			Details: LinkDetails{
+				Title:       rec.Title,
+				Description: rec.Description,
+				Notes:       rec.Notes,
+				Tags:        rec.Tags,
+			},
+		})
+		if len(entries) >= opts.BatchSize {
+			if err := commit(lastRead); err != nil {
+				return report, err
+			}
+		}
+	}
+	if !report.Aborted {
+		if err := commit(lastRead); err != nil {
+			return report, err
+		}
+	}
+
+	slog.InfoContext(ctx, "Imported links",
+		"processed", report.Processed, "created", report.Created, "overwritten", report.Overwritten,
+		"skipped", report.Skipped, "failed", report.Failed, "aborted", report.Aborted)
+	return report, nil
+}
+
+// invalidate drops cached entries and routing rules of overwritten links
+func (s *Service) invalidate(ctx context.Context, shortCodes []string) {
+	if len(shortCodes) == 0 {
+		return
+	}
+	for _, code := range shortCodes {
+		s.rules.forget(code)
+	}
+	if err := s.redis.Del(ctx, shortCodes...); err != nil {
+		slog.WarnContext(ctx, "Failed to invalidate cached entries", "count", len(shortCodes), "error", err)
+	}
+}
+
+// validateRecord checks an imported record and fills in defaults
+func (s *Service) validateRecord(ctx context.Context, rec *LinkRecord) error {
+	rec.ShortCode = strings.TrimSpace(rec.ShortCode)
+	if rec.ShortCode == "" {
+		return errors.New("short_code is required")
+	}
+	if len(rec.ShortCode) > 255 {
+		return errors.New("short_code is longer than 255 characters")
+	}
+	normalized, err := s.destinations.Normalize(rec.OriginalURL)
+	if err != nil {
+		return fmt.Errorf("original_url: %w", err)
+	}
+	if verdict, blocked := s.screen(ctx, screenStageImport, normalized); blocked {
+		return fmt.Errorf("original_url: %w by the %s list", ErrBlockedURL, verdict.List)
+	}
+	rec.OriginalURL = normalized
+	if rec.Clicks < 0 {
+		return errors.New("clicks must not be negative")
+	}
+	if rec.CreatedAt.IsZero() {
+		rec.CreatedAt = time.Now().UTC()
+	}
+
+	details := LinkDetails{Title: rec.Title, Description: rec.Description, Notes: rec.Notes, Tags: rec.Tags}
+	liftDetails(rec.Metadata, &details)
+	if err := validateDetails(&details); err != nil {
+		return err
+	}
+	rec.Title, rec.Description, rec.Notes, rec.Tags = details.Title, details.Description, details.Notes, details.Tags
+	return nil
+}
+
+// recordWriter encodes LinkRecords in one of the export formats
+type recordWriter interface {
+	Write(rec LinkRecord) error
+	Flush() error
+}
+
+func newRecordWriter(w io.Writer, format string) (recordWriter, error) {
+	switch format {
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(linkRecordColumns); err != nil {
+			return nil, err
+		}
+		return &csvRecordWriter{w: cw}, nil
+	case FormatJSONL:
+		bw := bufio.NewWriter(w)
+		return &jsonlRecordWriter{bw: bw, enc: json.NewEncoder(bw)}, nil
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+}
+
+type csvRecordWriter struct {
+	w *csv.Writer
+}
+
+func (c *csvRecordWriter) Write(rec LinkRecord) error {
+	metadata := ""
+	if len(rec.Metadata) > 0 {
+		data, err := json.Marshal(rec.Metadata)
+		if err != nil {
+			return err
+		}
+		metadata = string(data)
+	}
+	return c.w.Write([]string{
+		rec.ShortCode,
+		rec.OriginalURL,
+		rec.Owner,
+		strconv.Itoa(rec.Clicks),
+		rec.CreatedAt.Format(time.RFC3339),
+		metadata,
+		rec.Title,
+		rec.Description,
+		rec.Notes,
+		strings.Join(rec.Tags, ","),
+	})
+}
+
+func (c *csvRecordWriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type jsonlRecordWriter struct {
+	bw  *bufio.Writer
+	enc *json.Encoder
+}
+
+func (j *jsonlRecordWriter) Write(rec LinkRecord) error {
+	return j.enc.Encode(rec)
+}
+
+func (j *jsonlRecordWriter) Flush() error {
+	return j.bw.Flush()
+}
+
+// recordReader decodes LinkRecords one at a time. Next returns the line the
+// record started on and io.EOF once the input is exhausted. Malformed records
+// return an error for that line but leave the reader usable.
+type recordReader interface {
+	Next() (LinkRecord, int, error)
+}
+
+func newRecordReader(r io.Reader, format string) (recordReader, error) {
+	switch format {
+	case FormatCSV:
+		cr := csv.NewReader(r)
+		cr.FieldsPerRecord = -1
+		cr.ReuseRecord = true
+		header, err := cr.Read()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV header: %w", err)
+		}
+		columns := make(map[string]int, len(header))
+		for i, name := range header {
+			columns[strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))] = i
+		}
+		for _, required := range []string{"short_code", "original_url"} {
+			if _, ok := columns[required]; !ok {
+				return nil, fmt.Errorf("CSV header is missing the %s column", required)
+			}
+		}
+		return &csvRecordReader{r: cr, columns: columns}, nil
+	case FormatJSONL:
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), maxJSONLLine)
+		return &jsonlRecordReader{scanner: scanner}, nil
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+}
+
+type csvRecordReader struct {
+	r       *csv.Reader
+	columns map[string]int
+}
+
+func (c *csvRecordReader) Next() (LinkRecord, int, error) {
+	fields, err := c.r.Read()
+	if err == io.EOF {
+		return LinkRecord{}, 0, io.EOF
+	}
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return LinkRecord{}, parseErr.StartLine, fmt.Errorf("invalid CSV: %w", parseErr.Err)
+	}
+	if err != nil {
+		return LinkRecord{}, 0, err
+	}
+	line, _ := c.r.FieldPos(0)
+
+	get := func(name string) string {
+		if i, ok := c.columns[name]; ok && i < len(fields) {
+			return strings.TrimSpace(fields[i])
+		}
+		return ""
+	}
+
+	rec := LinkRecord{
+		ShortCode:   get("short_code"),
+		OriginalURL: get("original_url"),
+		Owner:       get("owner"),
+		Title:       get("title"),
+		Description: get("description"),
+		Notes:       get("notes"),
+	}
+	if raw := get("tags"); raw != "" {
+		rec.Tags = strings.Split(raw, ",")
+	}
+	if raw := get("clicks"); raw != "" {
+		if rec.Clicks, err = strconv.Atoi(raw); err != nil {
+			return rec, line, fmt.Errorf("invalid clicks %q", raw)
+		}
+	}
+	if raw := get("created_at"); raw != "" {
+		if rec.CreatedAt, err = time.Parse(time.RFC3339, raw); err != nil {
+			return rec, line, fmt.Errorf("invalid created_at %q", raw)
+		}
+	}
+	if raw := get("metadata"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &rec.Metadata); err != nil {
+			return rec, line, fmt.Errorf("invalid metadata: %w", err)
+		}
+	}
+	return rec, line, nil
+}
+
+type jsonlRecordReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func (j *jsonlRecordReader) Next() (LinkRecord, int, error) {
+	for j.scanner.Scan() {
+		j.line++
+		data := strings.TrimSpace(j.scanner.Text())
+		if data == "" {
+			continue
+		}
+
+		var rec LinkRecord
+		dec := json.NewDecoder(strings.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&rec); err != nil {
+			return rec, j.line, fmt.Errorf("invalid JSON: %w", err)
+		}
+		return rec, j.line, nil
+	}
+	if err := j.scanner.Err(); err != nil {
+		// The scanner cannot recover from an oversized line
+		return LinkRecord{}, 0, fmt.Errorf("failed to read line %d: %w", j.line+1, err)
+	}
+	return LinkRecord{}, 0, io.EOF
+}
+
+// parseExportFilter reads owner, tag, folder, created_after and
+// created_before from the query string. Dates accept RFC 3339 timestamps or
+// UTC days.
+func parseExportFilter(values url.Values) (ExportFilter, error) {
+	filter := ExportFilter{Owner: values.Get("owner"), Tag: values.Get("tag")}
+	var err error
+	if raw := values.Get("folder"); raw != "" {
+		id, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return filter, fmt.Errorf("invalid folder %q", raw)
+		}
+		filter.FolderID = &id
+	}
+	if raw := values.Get("created_after"); raw != "" {
+		if filter.CreatedAfter, err = parseTimeParam(raw, time.UTC); err != nil {
+			return filter, fmt.Errorf("invalid created_after: %w", err)
+		}
+	}
+	if raw := values.Get("created_before"); raw != "" {
+		if filter.CreatedBefore, err = parseTimeParam(raw, time.UTC); err != nil {
+			return filter, fmt.Errorf("invalid created_before: %w", err)
+		}
+	}
+	if !filter.CreatedAfter.IsZero() && !filter.CreatedBefore.IsZero() && !filter.CreatedAfter.Before(filter.CreatedBefore) {
+		return filter, fmt.Errorf("created_after must be before created_before")
+	}
+	return filter, nil
+}
+
+// formatContentTypes maps each format to the media type it is served as
+var formatContentTypes = map[string]string{
+	FormatCSV:   "text/csv; charset=utf-8",
+	FormatJSONL: "application/x-ndjson",
+}
@@ -0,0 +1,188 @@
+package useragent
+
+import (
+	_ "embed"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// Device classes
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceBot     = "bot"
+)
+
+// Unknown is reported for a browser or OS no rule matched
+const Unknown = "Other"
+
+//go:embed rules.yaml
+var defaultRules []byte
+
+// Agent is the classification of a User-Agent header
+type Agent struct {
+	Browser        string
+	BrowserVersion string
+	OS             string
+	OSVersion      string
+	Device         string
+	// Bot is set for crawlers and automated clients; BotName identifies known ones
+	Bot     bool
+	BotName string
+}
+
+// ruleFile mirrors the layout of rules.yaml
+type ruleFile struct {
+	Bots []struct {
+		Name    string `yaml:"name"`
+		Pattern string `yaml:"pattern"`
+	} `yaml:"bots"`
+	Browsers []struct {
+		Family  string `yaml:"family"`
+		Pattern string `yaml:"pattern"`
+	} `yaml:"browsers"`
+	OS []struct {
+		Family  string `yaml:"family"`
+		Pattern string `yaml:"pattern"`
+	} `yaml:"os"`
+	Devices []struct {
+		Class   string `yaml:"class"`
+		Pattern string `yaml:"pattern"`
+		Exclude string `yaml:"exclude"`
+	} `yaml:"devices"`
+}
+
+// rule is a compiled pattern producing a name
+type rule struct {
+	name    string
+	pattern *regexp.Regexp
+	exclude *regexp.Regexp
+}
+
+// match reports whether ua matches and returns the captured version, if any
+func (r rule) match(ua string) (bool, string) {
+	m := r.pattern.FindStringSubmatch(ua)
+	if m == nil {
+		return false, ""
+	}
+	if r.exclude != nil && r.exclude.MatchString(ua) {
+		return false, ""
+	}
+	if len(m) > 1 {
+		return true, strings.ReplaceAll(m[1], "_", ".")
+	}
+	return true, ""
+}
+
+// Parser classifies User-Agent strings with ordered regular expression rules
+type Parser struct {
+	bots     []rule
+	browsers []rule
+	os       []rule
+	devices  []rule
+}
+
+var (
+	defaultParser     *Parser
+	defaultParserOnce sync.Once
+)
+
+// Default returns a Parser for the embedded rules file
+func Default() *Parser {
+	defaultParserOnce.Do(func() {
+		p, err := New(defaultRules)
+		if err != nil {
+			panic(fmt.Sprintf("useragent: invalid embedded rules: %v", err))
+		}
+		defaultParser = p
+	})
+	return defaultParser
+}
+
+// New compiles a Parser from YAML rules in the format of rules.yaml
+func New(rules []byte) (*Parser, error) {
+	var file ruleFile
+	if err := yaml.Unmarshal(rules, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse rules: %w", err)
+	}
+
+	p := &Parser{}
+	var err error
+	compile := func(section, name, pattern, exclude string) rule {
+		r := rule{name: name}
+		if err != nil {
+			return r
+		}
+		if r.pattern, err = regexp.Compile(pattern); err != nil {
+			err = fmt.Errorf("%s rule %q: %w", section, name, err)
+			return r
+		}
+		if exclude != "" {
+			if r.exclude, err = regexp.Compile(exclude); err != nil {
+				err = fmt.Errorf("%s rule %q exclude: %w", section, name, err)
+			}
+		}
+		return r
+	}
+
+	for _, b := range file.Bots {
+		p.bots = append(p.bots, compile("bot", b.Name, b.Pattern, ""))
+	}
+	for _, b := range file.Browsers {
+		p.browsers = append(p.browsers, compile("browser", b.Family, b.Pattern, ""))
+	}
+	for _, o := range file.OS {
+		p.os = append(p.os, compile("os", o.Family, o.Pattern, ""))
+	}
+	for _, d := range file.Devices {
+		p.devices = append(p.devices, compile("device", d.Class, d.Pattern, d.Exclude))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Parse classifies ua. An empty header is treated as an automated client.
+func (p *Parser) Parse(ua string) Agent {
+	agent := Agent{Browser: Unknown, OS: Unknown, Device: DeviceDesktop}
+
+	ua = strings.TrimSpace(ua)
+	if ua == "" {
+		agent.Device = DeviceBot
+		agent.Bot = true
+		return agent
+	}
+
+	for _, r := range p.browsers {
+		if ok, version := r.match(ua); ok {
+			agent.Browser, agent.BrowserVersion = r.name, version
+			break
+		}
+	}
+	for _, r := range p.os {
+		if ok, version := r.match(ua); ok {
+			agent.OS, agent.OSVersion = r.name, version
+			break
+		}
+	}
+
+	for _, r := range p.bots {
+		if ok, _ := r.match(ua); ok {
+			agent.Bot, agent.BotName, agent.Device = true, r.name, DeviceBot
+			return agent
+		}
+	}
+	for _, r := range p.devices {
+		if ok, _ := r.match(ua); ok {
+			agent.Device = r.name
+			break
+		}
+	}
+	return agent
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mahopon/SmolEarl/infra/redis"
+)
+
+// Redis keys used for unique visitor counting
+const (
+	visitorSaltKeyPrefix = "visitors:salt:"
+	visitorHLLKeyPrefix  = "visitors:hll:"
+	visitorDirtyKey      = "visitors:dirty"
+)
+
+const (
+	// visitorSaltTTL keeps yesterday's salt around for clicks racing midnight.
+	// Once it expires visitor hashes can no longer be linked to an IP.
+	visitorSaltTTL = 48 * time.Hour
+	// visitorHLLTTL bounds how long daily HyperLogLogs stay in Redis; older
+	// days are restored from PostgreSQL on demand
+	visitorHLLTTL = 35 * 24 * time.Hour
+	// visitorPersistBatch is how many dirty HyperLogLogs are persisted per round trip
+	visitorPersistBatch = 100
+	// maxVisitorRangeDays bounds the range of a unique visitor query
+	maxVisitorRangeDays = 366
+)
+
+// DailyVisitors is the approximate number of unique visitors on one UTC day
+type DailyVisitors struct {
+	Day      string `json:"day"`
+	Visitors int64  `json:"visitors"`
+}
+
+// visitorCounter counts unique visitors per link and day with Redis
+// HyperLogLogs. Visitors are identified by an HMAC of their IP and user agent
+// keyed with a random salt that changes daily, so the stored hashes cannot be
+// reversed or linked across days.
+type visitorCounter struct {
+	redis *redis.Redis
+	repo  *EntryRepository
+
+	mu        sync.Mutex
+	saltDay   string
+	saltValue []byte
+}
+
+// newVisitorCounter creates a visitorCounter
+func newVisitorCounter(r *redis.Redis, repo *EntryRepository) *visitorCounter {
+	return &visitorCounter{redis: r, repo: repo}
+}
+
+// dayKey formats t as the UTC day used in keys
+func dayKey(t time.Time) string {
+	return t.UTC().Format(time.DateOnly)
+}
+
+// hllKey returns the HyperLogLog key of a link and day
+func hllKey(shortCode, day string) string {
+	return visitorHLLKeyPrefix + shortCode + ":" + day
+}
+
+// parseHLLKey splits an HyperLogLog key into its link and day
+func parseHLLKey(key string) (string, string, bool) {
+	rest, ok := strings.CutPrefix(key, visitorHLLKeyPrefix)
+	if !ok {
+		return "", "", false
+	}
+	i := strings.LastIndexByte(rest, ':')
+	if i <= 0 {
+		return "", "", false
+	}
+	return rest[:i], rest[i+1:], true
+}
+
+// salt returns the shared salt of day, creating it if this is the first
+// replica to need it
+func (v *visitorCounter) salt(ctx context.Context, day string) ([]byte, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.saltDay == day {
+		return v.saltValue, nil
+	}
+
+	key := visitorSaltKeyPrefix + day
+	candidate := make([]byte, 32)
+	if _, err := rand.Read(candidate); err != nil {
+		return nil, fmt.Errorf("failed to generate visitor salt: %w", err)
+	}
+	if _, err := v.redis.SetNX(ctx, key, hex.EncodeToString(candidate), visitorSaltTTL); err != nil {
+		return nil, fmt.Errorf("failed to store visitor salt: %w", err)
+	}
+	stored, err := v.redis.Get(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load visitor salt: %w", err)
+	}
+	salt, err := hex.DecodeString(stored)
+	if err != nil {
+		return nil, fmt.Errorf("invalid visitor salt: %w", err)
+	}
+
+	v.saltDay, v.saltValue = day, salt
+	return salt, nil
+}
+
+// Track adds the visitor behind visit to the link's HyperLogLog for that day
+func (v *visitorCounter) Track(ctx context.Context, shortCode string, visit Visit) error {
+	day := dayKey(visit.At)
+	salt, err := v.salt(ctx, day)
+	if err != nil {
+		return err
+	}
+
+	mac := hmac.New(sha256.New, salt)
+	mac.Write([]byte(visit.IP.String()))
+	mac.Write([]byte{0})
+	mac.Write([]byte(visit.UserAgent))
+	visitor := hex.EncodeToString(mac.Sum(nil)[:16])
+
+	key := hllKey(shortCode, day)
+	if err := v.redis.AddToHyperLogLog(ctx, key, visitorHLLTTL, visitor); err != nil {
+		return fmt.Errorf("failed to add visitor: %w", err)
+	}
+	if err := v.redis.AddToSet(ctx, visitorDirtyKey, key); err != nil {
+		return fmt.Errorf("failed to mark visitors dirty: %w", err)
+	}
+	return nil
+}
+
+// Count returns the unique visitors of a link per day between from and to
+// (inclusive UTC days) and across the whole range. Days evicted from Redis
+// are restored from their persisted copy first, so a range that is fully in
+// Redis takes one round trip.
+func (v *visitorCounter) Count(ctx context.Context, shortCode string, from, to time.Time) ([]DailyVisitors, int64, error) {
+	var days, keys []string
+	for t := from.UTC(); !t.After(to); t = t.AddDate(0, 0, 1) {
+		day := dayKey(t)
+		days = append(days, day)
+		keys = append(keys, hllKey(shortCode, day))
+	}
+
+	counts, exists, total, err := v.redis.CountHyperLogLogs(ctx, keys)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count visitors: %w", err)
+	}
+	var missing []string
+	for i, ok := range exists {
+		if !ok {
+			missing = append(missing, days[i])
+		}
+	}
+	if len(missing) > 0 {
+		restored, err := v.restore(ctx, shortCode, missing)
+		if err != nil {
+			return nil, 0, err
+		}
+		if restored {
+			if counts, _, total, err = v.redis.CountHyperLogLogs(ctx, keys); err != nil {
+				return nil, 0, fmt.Errorf("failed to count visitors: %w", err)
+			}
+		}
+	}
+
+	daily := make([]DailyVisitors, len(days))
+	for i, day := range days {
+		daily[i] = DailyVisitors{Day: day, Visitors: counts[i]}
+	}
+	return daily, total, nil
+}
+
+// restore merges the persisted HyperLogLogs of days back into Redis and
+// reports whether any were found
+func (v *visitorCounter) restore(ctx context.Context, shortCode string, days []string) (bool, error) {
+	persisted, err := v.repo.GetVisitorHLLs(ctx, shortCode, days)
+	if err != nil {
+		return false, fmt.Errorf("failed to load persisted visitors: %w", err)
+	}
+	if len(persisted) == 0 {
+		return false, nil
+	}
+	values := make(map[string][]byte, len(persisted))
+	for day, raw := range persisted {
+		values[hllKey(shortCode, day)] = raw
+	}
+	if err := v.redis.MergeHyperLogLogs(ctx, values, visitorHLLTTL); err != nil {
+		return false, fmt.Errorf("failed to restore visitors: %w", err)
+	}
+	return true, nil
+}
+
+// Persist copies every HyperLogLog changed since the last run to PostgreSQL
+func (v *visitorCounter) Persist(ctx context.Context) error {
+	for {
+		keys, err := v.redis.PopFromSet(ctx, visitorDirtyKey, visitorPersistBatch)
+		if err != nil {
+			return fmt.Errorf("failed to read dirty visitor keys: %w", err)
+		}
+		if len(keys) == 0 {
+			return nil
+		}
+
+		for i, key := range keys {
+			shortCode, day, ok := parseHLLKey(key)
+			if !ok {
+				continue
+			}
+			raw, err := v.redis.Get(ctx, key)
+			if redis.IsNotFound(err) {
+				continue
+			}
+			if err == nil {
+				err = v.repo.SaveVisitorHLL(ctx, shortCode, day, []byte(raw))
+			}
+			if err != nil {
+				// Put the unprocessed keys back so the next run retries them
+				remaining := make([]any, 0, len(keys)-i)
+				for _, k := range keys[i:] {
+					remaining = append(remaining, k)
+				}
+				if err := v.redis.AddToSet(ctx, visitorDirtyKey, remaining...); err != nil {
+					slog.ErrorContext(ctx, "Failed to requeue visitor keys", "count", len(remaining), "error", err)
+				}
+				return fmt.Errorf("failed to persist visitors %s: %w", key, err)
+			}
+		}
+	}
+}
+
+// Run persists dirty HyperLogLogs every interval until ctx is cancelled
+func (v *visitorCounter) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := v.Persist(ctx); err != nil {
+				slog.ErrorContext(ctx, "Failed to persist unique visitors", "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,676 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	mathrand "math/rand/v2"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mahopon/SmolEarl/config"
+	infra_prom "github.com/mahopon/SmolEarl/infra/prometheus"
+)
+
+// Events delivered to webhooks
+const (
+	EventLinkCreated = "link.created"
+	EventLinkUpdated = "link.updated"
+	EventLinkDeleted = "link.deleted"
+	EventLinkExpired = "link.expired"
+	EventClick       = "click"
+)
+
+// webhookEvents lists the events endpoints may subscribe to
+var webhookEvents = []string{EventLinkCreated, EventLinkUpdated, EventLinkDeleted, EventLinkExpired, EventClick}
+
+// Delivery states
+const (
+	deliveryPending   = "pending"
+	deliveryDelivered = "delivered"
+	deliveryDead      = "dead"
+)
+
+// Headers sent with every delivery
+const (
+	webhookEventHeader     = "X-SmolEarl-Event"
+	webhookDeliveryHeader  = "X-SmolEarl-Delivery"
+	webhookSignatureHeader = "X-SmolEarl-Signature"
+)
+
+const (
+	// webhookLeaseMargin is added to the request timeout to lease a
+	// delivery for the time needed to send it and record the outcome
+	webhookLeaseMargin = 5 * time.Second
+	// webhookPollInterval is how often idle workers look for due deliveries
+	webhookPollInterval = time.Second
+	// webhookMaxBackoff caps the delay between two attempts
+	webhookMaxBackoff = 6 * time.Hour
+	// webhookExpiryInterval is how often expired links are looked for
+	webhookExpiryInterval = 30 * time.Second
+	// webhookExpiryBatch is how many expired links are notified per
+	// transaction
+	webhookExpiryBatch = 500
+	// webhookClickBatchSize flushes buffered clicks early once reached
+	webhookClickBatchSize = 500
+	// webhookRetention is how long delivered deliveries are kept in the log
+	webhookRetention = 30 * 24 * time.Hour
+	// webhookPruneInterval is how often old deliveries are removed
+	webhookPruneInterval = time.Hour
+	// maxWebhookErrorLength bounds the error stored for a failed attempt
+	maxWebhookErrorLength = 512
+	// defaultDeliveryLimit and maxDeliveryLimit bound delivery log responses
+	defaultDeliveryLimit = 50
+	maxDeliveryLimit     = 500
+)
+
+// ErrInvalidWebhook is wrapped by every webhook endpoint validation failure
+var ErrInvalidWebhook = newError(CodeInvalidInput, "invalid webhook")
+
+// WebhookEndpoint is a URL receiving the events of an owner's links. The
+// secret is only returned on creation.
+type WebhookEndpoint struct {
+	ID        int64     `json:"id"`
+	Owner     string    `json:"owner" openapi:"required"`
+	URL       string    `json:"url" openapi:"required"`
+	Events    []string  `json:"events" openapi:"required"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookDelivery is one event queued for an endpoint, as shown in its
+// delivery log
+type WebhookDelivery struct {
+	ID             int64           `json:"id"`
+	Event          string          `json:"event"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	LastStatusCode int             `json:"last_status_code,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+	Payload        json.RawMessage `json:"payload"`
+}
+
+// webhookJob is a claimed delivery with what is needed to send it
+type webhookJob struct {
+	ID       int64
+	Event    string
+	Payload  []byte
+	Attempts int
+	URL      string
+	Secret   string
+	// Claim is the lease expiry set when the delivery was claimed
+	Claim time.Time
+}
+
+// errLeaseLost is returned when the outcome of a delivery is recorded after
+// its lease expired and it was claimed again, retried or deleted
+var errLeaseLost = errors.New("webhook delivery lease lost")
+
+// webhookEnvelope wraps the data of every event. The ID stays the same
+// across retries so receivers can drop duplicates.
+type webhookEnvelope struct {
+	ID        string    `json:"id"`
+	Event     string    `json:"event"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+// linkEventData describes the link of a lifecycle event
+type linkEventData struct {
+	ShortCode string     `json:"short_code"`
+	URL       string     `json:"url"`
+	Owner     string     `json:"owner,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// Change names what was updated, for link.updated
+	Change string `json:"change,omitempty"`
+}
+
+// clickEventData is one click of a batched click event
+type clickEventData struct {
+	ShortCode      string    `json:"short_code"`
+	OccurredAt     time.Time `json:"occurred_at"`
+	Country        string    `json:"country,omitempty"`
+	Browser        string    `json:"browser,omitempty"`
+	OS             string    `json:"os,omitempty"`
+	Device         string    `json:"device,omitempty"`
+	Bot            bool      `json:"bot"`
+	ReferrerDomain string    `json:"referrer_domain,omitempty"`
+	Channel        string    `json:"channel,omitempty"`
+	UTM            UTM       `json:"utm"`
+	Variant        string    `json:"variant,omitempty"`
+}
+
+// WebhookOptions tune webhook delivery
+type WebhookOptions struct {
+	Workers      int
+	MaxAttempts  int
+	Timeout      time.Duration
+	Backoff      time.Duration
+	ClickBatch   time.Duration
+	AllowPrivate bool
+}
+
+// webhookOptions reads the webhook settings of a configuration
+func webhookOptions(cfg *config.Config) WebhookOptions {
+	return WebhookOptions{
+		Workers:      cfg.WebhookWorkers,
+		MaxAttempts:  cfg.WebhookMaxAttempts,
+		Timeout:      cfg.WebhookTimeout,
+		Backoff:      cfg.WebhookBackoff,
+		ClickBatch:   cfg.WebhookClickBatchInterval,
+		AllowPrivate: cfg.WebhookAllowPrivate,
+	}
+}
+
+// webhookDispatcher queues events in PostgreSQL and delivers them with a
+// pool of workers. Queued deliveries survive restarts and are shared by all
+// instances; each claim leases a delivery for the request timeout so it is
+// retried elsewhere if this instance stops mid-attempt.
+type webhookDispatcher struct {
+	repo    *EntryRepository
+	client  *http.Client
+	opts    WebhookOptions
+	metrics *infra_prom.WebhookMetrics
+
+	mu     sync.Mutex
+	clicks []Click
+
+	wake   chan struct{}
+	stop   chan struct{}
+	wg     sync.WaitGroup
+	closed sync.Once
+}
+
+// newWebhookDispatcher creates a webhookDispatcher. Events can be queued
+// right away; they are only delivered once Start is called.
+func newWebhookDispatcher(repo *EntryRepository, opts WebhookOptions, metrics *infra_prom.WebhookMetrics) *webhookDispatcher {
+	dialer := &net.Dialer{Timeout: opts.Timeout}
+	if !opts.AllowPrivate {
+		dialer.Control = rejectPrivateAddress
+	}
+	return &webhookDispatcher{
+		repo: repo,
+		client: &http.Client{
+			Timeout:   opts.Timeout,
+			Transport: &http.Transport{DialContext: dialer.DialContext},
+			// A redirect is treated as a failed delivery
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		opts:    opts,
+		metrics: metrics,
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+	}
+}
+
+// rejectPrivateAddress keeps webhooks from reaching internal services
+func rejectPrivateAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	ip = ip.Unmap()
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsUnspecified() || ip.IsMulticast() {
+		return fmt.Errorf("webhook address %s is not public", ip)
+	}
+	return nil
+}
+
+// Start launches the delivery workers and the click batcher
+func (d *webhookDispatcher) Start() {
+	for i := 0; i < d.opts.Workers; i++ {
+		d.wg.Add(1)
+		go d.work(i == 0)
+	}
+	d.wg.Add(2)
+	go d.batchClicks()
+	go d.sweepExpired()
+}
+
+// Shutdown stops claiming deliveries, waits for attempts in flight and
+// queues the buffered clicks. Deliveries interrupted when ctx expires are
+// retried once their lease runs out.
+func (d *webhookDispatcher) Shutdown(ctx context.Context) error {
+	d.closed.Do(func() { close(d.stop) })
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return d.flushClicks(ctx)
+}
+
+// newEvent encodes data in the envelope of a new event
+func newEvent(event string, data any) ([]byte, error) {
+	id := make([]byte, 12)
+	rand.Read(id)
+	payload, err := json.Marshal(webhookEnvelope{
+		ID:        "evt_" + hex.EncodeToString(id),
+		Event:     event,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal event: %w", err)
+	}
+	return payload, nil
+}
+
+// Enqueue queues an event for every endpoint subscribed to it
+func (d *webhookDispatcher) Enqueue(ctx context.Context, event, owner string, data any) error {
+	payload, err := newEvent(event, data)
+	if err != nil {
+		return err
+	}
+	if owner == "" {
+		// Endpoints belong to an owner, so links without one have none
+		return nil
+	}
+	queued, err := d.repo.EnqueueWebhookEvent(ctx, event, owner, payload)
+	if err != nil {
+		return fmt.Errorf("failed to queue event: %w", err)
+	}
+	if queued > 0 {
+		d.notify()
+	}
+	return nil
+}
+
+// notify wakes an idle worker
+func (d *webhookDispatcher) notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// sweepExpired queues link.expired events for links that expired since the
+// last sweep, until stopped
+func (d *webhookDispatcher) sweepExpired() {
+	defer d.wg.Done()
+	ticker := time.NewTicker(webhookExpiryInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := d.expireLinks(context.Background()); err != nil {
+			slog.Error("Failed to queue link expiry events", "error", err)
+		}
+		select {
+		case <-d.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// expireLinks marks every expired link as notified, queueing its
+// link.expired event in the same transaction
+func (d *webhookDispatcher) expireLinks(ctx context.Context) error {
+	for {
+		expired, queued, err := d.repo.ExpireEntries(ctx, webhookExpiryBatch, func(e Entry) ([]byte, error) {
+			return newEvent(EventLinkExpired, linkEventOf(e, ""))
+		})
+		if err != nil {
+			return err
+		}
+		if queued > 0 {
+			d.notify()
+		}
+		if len(expired) > 0 {
+			slog.Info("Links expired", "count", len(expired), "deliveries", queued)
+		}
+		if len(expired) < webhookExpiryBatch || d.stopping() {
+			return nil
+		}
+	}
+}
+
+// AddClick buffers a click for the next click event batch
+func (d *webhookDispatcher) AddClick(click Click) {
+	d.mu.Lock()
+	d.clicks = append(d.clicks, click)
+	full := len(d.clicks) >= webhookClickBatchSize
+	d.mu.Unlock()
+	if full {
+		go func() {
+			if err := d.flushClicks(context.Background()); err != nil {
+				slog.Error("Failed to queue click events", "error", err)
+			}
+		}()
+	}
+}
+
+// batchClicks queues the buffered clicks periodically until stopped
+func (d *webhookDispatcher) batchClicks() {
+	defer d.wg.Done()
+	ticker := time.NewTicker(d.opts.ClickBatch)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.stop:
+			return
+		case <-ticker.C:
+			if err := d.flushClicks(context.Background()); err != nil {
+				slog.Error("Failed to queue click events", "error", err)
+			}
+		}
+	}
+}
+
+// flushClicks queues the buffered clicks as one click event per owner
+func (d *webhookDispatcher) flushClicks(ctx context.Context) error {
+	d.mu.Lock()
+	clicks := d.clicks
+	d.clicks = nil
+	d.mu.Unlock()
+	if len(clicks) == 0 {
+		return nil
+	}
+
+	codes := make([]string, 0, len(clicks))
+	for _, c := range clicks {
+		codes = append(codes, c.ShortCode)
+	}
+	owners, err := d.repo.GetOwners(ctx, slices.Compact(slices.Sorted(slices.Values(codes))))
+	if err != nil {
+		return fmt.Errorf("failed to look up link owners: %w", err)
+	}
+
+	batches := make(map[string][]clickEventData)
+	for _, c := range clicks {
+		owner := owners[c.ShortCode]
+		batches[owner] = append(batches[owner], clickEventData{
+			ShortCode:      c.ShortCode,
+			OccurredAt:     c.OccurredAt,
+			Country:        c.Country,
+			Browser:        c.Browser,
+			OS:             c.OS,
+			Device:         c.Device,
+			Bot:            c.Bot,
+			ReferrerDomain: c.ReferrerDomain,
+			Channel:        c.Channel,
+			UTM:            c.UTM,
+			Variant:        c.Variant,
+		})
+	}
+	var errs []error
+	for owner, batch := range batches {
+		if err := d.Enqueue(ctx, EventClick, owner, map[string]any{"clicks": batch}); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// work delivers due deliveries until stopped. One worker also prunes the
+// delivery log.
+func (d *webhookDispatcher) work(prune bool) {
+	defer d.wg.Done()
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+	var lastPrune time.Time
+
+	for !d.stopping() {
+		job, err := d.repo.ClaimWebhookDelivery(context.Background(), d.opts.Timeout+webhookLeaseMargin)
+		if err != nil {
+			slog.Error("Failed to claim webhook delivery", "error", err)
+		}
+		if job != nil {
+			d.deliver(*job)
+		}
+
+		if prune && time.Since(lastPrune) >= webhookPruneInterval {
+			lastPrune = time.Now()
+			if pruned, err := d.repo.PruneWebhookDeliveries(context.Background(), lastPrune.Add(-webhookRetention)); err != nil {
+				slog.Error("Failed to prune webhook deliveries", "error", err)
+			} else if pruned > 0 {
+				slog.Info("Pruned webhook deliveries", "deleted", pruned)
+			}
+		}
+
+		if job != nil {
+			continue
+		}
+		select {
+		case <-d.stop:
+			return
+		case <-d.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// stopping reports whether Shutdown was called
+func (d *webhookDispatcher) stopping() bool {
+	select {
+	case <-d.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// deliver sends one delivery and records the outcome
+func (d *webhookDispatcher) deliver(job webhookJob) {
+	ctx := context.Background()
+	status, err := d.send(ctx, job)
+
+	outcome := deliveryDelivered
+	if err == nil {
+		err = d.repo.CompleteWebhookDelivery(ctx, job, status)
+	} else {
+		attempt := job.Attempts + 1
+		dead, recordErr := d.repo.FailWebhookDelivery(ctx, job, status, truncate(err.Error(), maxWebhookErrorLength),
+			d.opts.MaxAttempts, d.backoff(attempt))
+		outcome = "retry"
+		if dead {
+			outcome = deliveryDead
+			slog.Warn("Webhook delivery dead-lettered", "delivery", job.ID, "event", job.Event, "attempts", attempt, "error", err)
+		}
+		err = recordErr
+	}
+	if errors.Is(err, errLeaseLost) {
+		// Another worker owns the delivery now and records its own attempt
+		slog.Warn("Webhook delivery outcome discarded", "delivery", job.ID, "error", err)
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to record webhook delivery", "delivery", job.ID, "error", err)
+	}
+	if d.metrics != nil {
+		d.metrics.Deliveries.WithLabelValues(job.Event, outcome).Inc()
+	}
+}
+
+// send posts a delivery and returns the response status. Any status other
+// than 2xx is an error.
+func (d *webhookDispatcher) send(ctx context.Context, job webhookJob) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, job.URL, bytes.NewReader(job.Payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "SmolEarl-Webhooks/1")
+	req.Header.Set(webhookEventHeader, job.Event)
+	req.Header.Set(webhookDeliveryHeader, strconv.FormatInt(job.ID, 10))
+	req.Header.Set(webhookSignatureHeader, "t="+timestamp+",v1="+signWebhook(job.Secret, timestamp, job.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint responded %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// signWebhook returns the hex HMAC-SHA256 of "timestamp.payload" keyed with
+// the endpoint's secret
+func signWebhook(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// backoff returns the delay before the attempt following attempt: the base
+// delay doubled per attempt, capped, with up to 20% jitter
+func (d *webhookDispatcher) backoff(attempt int) time.Duration {
+	delay := d.opts.Backoff << min(attempt-1, 30)
+	if delay <= 0 || delay > webhookMaxBackoff {
+		delay = webhookMaxBackoff
+	}
+	return delay + time.Duration(mathrand.Int64N(int64(delay)/5+1))
+}
+
+// truncate shortens s to at most n bytes without splitting a UTF-8 sequence
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// validateWebhookEndpoint checks the URL and events of a new endpoint
+func validateWebhookEndpoint(endpoint *WebhookEndpoint) error {
+	endpoint.Owner = strings.TrimSpace(endpoint.Owner)
+	if endpoint.Owner == "" {
+		return fmt.Errorf("%w: owner is required", ErrInvalidWebhook)
+	}
+	u, err := url.Parse(endpoint.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: url must be an absolute http or https URL", ErrInvalidWebhook)
+	}
+	if u.User != nil {
+		return fmt.Errorf("%w: url must not contain credentials", ErrInvalidWebhook)
+	}
+	if len(endpoint.Events) == 0 {
+		return fmt.Errorf("%w: at least one event is required", ErrInvalidWebhook)
+	}
+	for _, event := range endpoint.Events {
+		if !slices.Contains(webhookEvents, event) {
+			return fmt.Errorf("%w: unknown event %q", ErrInvalidWebhook, event)
+		}
+	}
+	slices.Sort(endpoint.Events)
+	endpoint.Events = slices.Compact(endpoint.Events)
+	return nil
+}
+
+// SetWebhooks enables webhook events
+func (s *Service) SetWebhooks(webhooks *webhookDispatcher) {
+	s.webhooks = webhooks
+}
+
+// emitLinkEvent queues a lifecycle event of a link. Failures are logged
+// rather than failing the change that caused them.
+func (s *Service) emitLinkEvent(ctx context.Context, event string, entry Entry, change string) {
+	if s.webhooks == nil {
+		return
+	}
+	if err := s.webhooks.Enqueue(ctx, event, entry.Owner, linkEventOf(entry, change)); err != nil {
+		slog.WarnContext(ctx, "Failed to queue webhook event", "event", event, "code", entry.ShortCode, "error", err)
+	}
+}
+
+// linkEventOf describes entry in a link event
+func linkEventOf(entry Entry, change string) linkEventData {
+	return linkEventData{
+		ShortCode: entry.ShortCode,
+		URL:       entry.OriginalURL,
+		Owner:     entry.Owner,
+		CreatedAt: entry.CreatedAt,
+		ExpiresAt: entry.ExpiresAt,
+		Change:    change,
+	}
+}
+
+// CreateWebhook registers an endpoint and generates its signing secret
+func (s *Service) CreateWebhook(ctx context.Context, endpoint WebhookEndpoint) (WebhookEndpoint, error) {
+	if err := validateWebhookEndpoint(&endpoint); err != nil {
+		return WebhookEndpoint{}, err
+	}
+	secret := make([]byte, 32)
+	rand.Read(secret)
+	endpoint.Secret = "whsec_" + hex.EncodeToString(secret)
+	if err := s.repo.CreateWebhook(ctx, &endpoint); err != nil {
+		return WebhookEndpoint{}, fmt.Errorf("failed to store in PostgreSQL: %w", err)
+	}
+	slog.InfoContext(ctx, "Created webhook endpoint", "webhook", endpoint.ID, "owner", endpoint.Owner)
+	return endpoint, nil
+}
+
+// ListWebhooks returns the endpoints of owner
+func (s *Service) ListWebhooks(ctx context.Context, owner string) ([]WebhookEndpoint, error) {
+	if owner == "" {
+		return nil, fmt.Errorf("%w: owner is required", ErrInvalidWebhook)
+	}
+	return s.repo.ListWebhooks(ctx, owner)
+}
+
+// DeleteWebhook removes an endpoint with its delivery log and reports
+// whether it existed
+func (s *Service) DeleteWebhook(ctx context.Context, id int64) (bool, error) {
+	return s.repo.DeleteWebhook(ctx, id)
+}
+
+// ListWebhookDeliveries returns the delivery log of an endpoint, newest
+// first, optionally only in one status
+func (s *Service) ListWebhookDeliveries(ctx context.Context, id int64, status string, limit int) ([]WebhookDelivery, error) {
+	if status != "" && status != deliveryPending && status != deliveryDelivered && status != deliveryDead {
+		return nil, fmt.Errorf("%w: status must be pending, delivered or dead", ErrInvalidWebhook)
+	}
+	return s.repo.ListWebhookDeliveries(ctx, id, status, limit)
+}
+
+// RetryWebhookDelivery queues a delivery of an endpoint again with a fresh
+// attempt budget and reports whether it exists
+func (s *Service) RetryWebhookDelivery(ctx context.Context, id, deliveryID int64) (bool, error) {
+	found, err := s.repo.RetryWebhookDelivery(ctx, id, deliveryID)
+	if found && s.webhooks != nil {
+		select {
+		case s.webhooks.wake <- struct{}{}:
+		default:
+		}
+	}
+	return found, err
+}